@@ -0,0 +1,118 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/opendevstack/ods-pipeline-image/internal/oci"
+	"github.com/opendevstack/ods-pipeline/pkg/nexus"
+	"github.com/opendevstack/ods-pipeline/pkg/pipelinectxt"
+)
+
+// ociArchivesPath is the artifacts path of OCI archives of images.
+const ociArchivesPath = pipelinectxt.ArtifactsPath + "/image-archives"
+
+// saveOCIArchive saves the pushed image together with its signatures and
+// attestations as OCI archive artifact with a SHA-256 checksum file, and
+// uploads both to Nexus if a repository is configured.
+func (p *packageImage) saveOCIArchive() error {
+	dir := filepath.Join(buildahWorkdir, fmt.Sprintf("%s-archive", p.imageNameNoSha()))
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	if err := NewCosignClient("").WithRegistryAccess(p.registryAccess()).Save(imageRef(p.artifactImage()), dir); err != nil {
+		return fmt.Errorf("save image: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := tagArchivedImage(dir, p.imageDigest, p.imageId.GitCommitSHA); err != nil {
+		return err
+	}
+
+	archivesDir := filepath.Join(p.opts.checkoutDir, ociArchivesPath)
+	if err := os.MkdirAll(archivesDir, 0755); err != nil {
+		return fmt.Errorf("create %s: %w", archivesDir, err)
+	}
+	archive := filepath.Join(archivesDir, fmt.Sprintf("%s.oci.tar", p.imageNameNoSha()))
+	checksum, err := writeOCIArchive(dir, archive)
+	if err != nil {
+		return err
+	}
+	checksumFile := archive + ".sha256"
+	err = os.WriteFile(checksumFile, []byte(fmt.Sprintf("%s  %s\n", checksum, filepath.Base(archive))), 0644)
+	if err != nil {
+		return fmt.Errorf("write checksum: %w", err)
+	}
+	p.logger.Infof("Saved image %s as %s (sha256:%s)", p.imageName(), filepath.Join(ociArchivesPath, filepath.Base(archive)), checksum)
+
+	if p.opts.ociArchiveNexusRepository == "" {
+		return nil
+	}
+	return p.uploadToNexus(p.opts.ociArchiveNexusRepository, "image-archives", archive, checksumFile)
+}
+
+// tagArchivedImage references the image with given digest in the OCI layout
+// at dir by tag, so that it can be addressed as oci-archive:<file>:<tag>
+// next to the signatures and attestations saved with it.
+func tagArchivedImage(dir, digest, tag string) error {
+	l, err := oci.Open(dir)
+	if err != nil {
+		return err
+	}
+	for i, m := range l.Index.Manifests {
+		if m.Digest == digest {
+			if m.Annotations == nil {
+				l.Index.Manifests[i].Annotations = map[string]string{}
+			}
+			l.Index.Manifests[i].Annotations[oci.RefNameAnnotation] = tag
+			return l.WriteIndex()
+		}
+	}
+	return fmt.Errorf("image %s not found in %s", digest, dir)
+}
+
+// writeOCIArchive writes the OCI layout at dir as archive to filename and
+// returns the hex encoded SHA-256 checksum of the archive.
+func writeOCIArchive(dir, filename string) (string, error) {
+	f, err := os.Create(filename)
+	if err != nil {
+		return "", fmt.Errorf("create %s: %w", filename, err)
+	}
+	defer f.Close()
+	h := sha256.New()
+	if err := oci.WriteArchive(dir, io.MultiWriter(f, h)); err != nil {
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", fmt.Errorf("write %s: %w", filename, err)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// uploadToNexus uploads files as raw assets into the group of the ODS context
+// with given subdir in the Nexus repository.
+func (p *packageImage) uploadToNexus(repository, subdir string, files ...string) error {
+	if p.opts.nexusURL == "" {
+		return fmt.Errorf("upload to Nexus repository %s requires the Nexus URL", repository)
+	}
+	c, err := nexus.NewClient(&nexus.ClientConfig{
+		BaseURL:  p.opts.nexusURL,
+		Username: p.opts.nexusUsername,
+		Password: p.opts.nexusPassword,
+		Logger:   p.logger,
+	})
+	if err != nil {
+		return err
+	}
+	group := nexus.ArtifactGroup(p.ctxt.Project, p.ctxt.Repository, p.ctxt.GitCommitSHA, subdir)
+	for _, f := range files {
+		link, err := c.Upload(repository, group, f)
+		if err != nil {
+			return fmt.Errorf("upload %s: %w", filepath.Base(f), err)
+		}
+		p.logger.Infof("Uploaded %s to %s", filepath.Base(f), link)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opendevstack/ods-pipeline-image/internal/oci"
+	"github.com/opendevstack/ods-pipeline-image/internal/oci/ocitest"
+)
+
+func TestTagArchivedImage(t *testing.T) {
+	dir := t.TempDir()
+	ocitest.WriteImage(t, dir, "", oci.ContainerConfig{},
+		ocitest.Layer{Files: map[string]string{"app/server": "binary"}},
+	)
+	l, err := oci.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := l.Index.Manifests[0].Digest
+	if err := tagArchivedImage(dir, "sha256:unknown", "abc"); err == nil {
+		t.Fatal("want error for unknown digest, got none")
+	}
+	if err := tagArchivedImage(dir, digest, "abc"); err != nil {
+		t.Fatal(err)
+	}
+	l, err = oci.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc, err := l.ManifestDescriptor("abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if desc.Digest != digest {
+		t.Fatalf("want %s, got %s", digest, desc.Digest)
+	}
+}
+
+func TestWriteOCIArchive(t *testing.T) {
+	dir := t.TempDir()
+	ocitest.WriteImage(t, dir, "abc", oci.ContainerConfig{},
+		ocitest.Layer{Files: map[string]string{"app/server": "binary"}},
+	)
+	archive := filepath.Join(t.TempDir(), "app.oci.tar")
+	checksum, err := writeOCIArchive(dir, archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprintf("%x", sha256.Sum256(b)); checksum != want {
+		t.Fatalf("want checksum %s, got %s", want, checksum)
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/shlex"
+)
+
+// copySpec describes files of the checkout directory to copy into an image
+// assembled without a Dockerfile.
+type copySpec struct {
+	// pattern is a path relative to the checkout directory, which may
+	// contain glob patterns.
+	pattern string
+	// dest is the absolute destination in the image. If it ends with "/",
+	// it is a directory into which the sources are copied.
+	dest string
+}
+
+// parseCopySpecs parses copy entries separated by newlines or semicolons,
+// each in the form "<pattern> -> <destination>", e.g.
+// ".ods/artifacts/*.jar -> /app/". Without destination, files are copied
+// into workdir.
+func parseCopySpecs(s, workdir string) ([]copySpec, error) {
+	var specs []copySpec
+	for _, entry := range strings.FieldsFunc(s, func(r rune) bool { return r == '\n' || r == ';' }) {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		pattern, dest, ok := strings.Cut(entry, "->")
+		cs := copySpec{pattern: strings.TrimSpace(pattern), dest: strings.TrimSpace(dest)}
+		if !ok {
+			cs.dest = strings.TrimSuffix(workdir, "/") + "/"
+		}
+		if cs.pattern == "" || !path.IsAbs(cs.dest) {
+			return nil, fmt.Errorf("invalid copy entry %q, must be <path> -> <absolute destination>", entry)
+		}
+		if filepath.IsAbs(cs.pattern) || !filepath.IsLocal(cs.pattern) {
+			return nil, fmt.Errorf("source of copy entry %q must be within the checkout directory", entry)
+		}
+		if _, err := filepath.Match(cs.pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern of copy entry %q: %w", entry, err)
+		}
+		specs = append(specs, cs)
+	}
+	return specs, nil
+}
+
+// sources returns the files of dir matching the pattern of cs. It fails if
+// there is no match, as this most likely means an earlier task did not
+// produce the expected artifacts.
+func (cs copySpec) sources(dir string) ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, cs.pattern))
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("no files match %s", cs.pattern)
+	}
+	return matches, nil
+}
+
+// assembleConfigArgs returns the args of buildah config setting the workdir,
+// user, entrypoint and exposed ports given in opts.
+func assembleConfigArgs(opts options) ([]string, error) {
+	var args []string
+	if opts.workdir != "" {
+		if !path.IsAbs(opts.workdir) {
+			return nil, fmt.Errorf("workdir %s must be absolute", opts.workdir)
+		}
+		args = append(args, fmt.Sprintf("--workingdir=%s", opts.workdir))
+	}
+	if opts.user != "" {
+		args = append(args, fmt.Sprintf("--user=%s", opts.user))
+	}
+	if strings.TrimSpace(opts.entrypoint) != "" {
+		entrypoint, err := shlex.Split(opts.entrypoint)
+		if err != nil {
+			return nil, fmt.Errorf("parse entrypoint (%s): %w", opts.entrypoint, err)
+		}
+		b, err := json.Marshal(entrypoint)
+		if err != nil {
+			return nil, err
+		}
+		// Like ENTRYPOINT in a Dockerfile, the command of the base image is
+		// reset so that it is not passed as arguments to the entrypoint.
+		args = append(args, fmt.Sprintf("--entrypoint=%s", b), "--cmd=")
+	}
+	for _, port := range strings.Fields(opts.expose) {
+		number, protocol, _ := strings.Cut(normalizePort(port), "/")
+		if number == "" || strings.Trim(number, "0123456789") != "" || (protocol != "tcp" && protocol != "udp") {
+			return nil, fmt.Errorf("invalid port %q, must be <number>[/tcp|/udp]", port)
+		}
+		args = append(args, fmt.Sprintf("--port=%s", normalizePort(port)))
+	}
+	return args, nil
+}
+
+// assembled returns whether the image is assembled onto a base image
+// instead of built from a Dockerfile.
+func (p *packageImage) assembled() bool {
+	return p.opts.baseImage != ""
+}
+
+// buildahAssemble assembles the image from the base image and the files to
+// copy, and commits it as a local image tagged with the image reference.
+func (p *packageImage) buildahAssemble(outWriter, errWriter io.Writer) error {
+	specs, err := parseCopySpecs(p.opts.copyFiles, p.opts.workdir)
+	if err != nil {
+		return err
+	}
+	configArgs, err := assembleConfigArgs(p.opts)
+	if err != nil {
+		return err
+	}
+	base := p.assembleBase
+	if base == "" {
+		base = p.opts.baseImage
+	}
+	container, err := p.buildahFrom(base, true)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := p.buildahRm(container); err != nil {
+			p.logger.Warnf("Could not remove container %s: %s", container, err)
+		}
+	}()
+
+	for _, cs := range specs {
+		sources, err := cs.sources(p.opts.checkoutDir)
+		if err != nil {
+			return err
+		}
+		args := []string{
+			fmt.Sprintf("--storage-driver=%s", p.opts.storageDriver),
+			"copy",
+		}
+		if p.opts.user != "" {
+			args = append(args, fmt.Sprintf("--chown=%s", p.opts.user))
+		}
+		args = append(args, container)
+		args = append(args, sources...)
+		args = append(args, cs.dest)
+		p.logger.Infof("Copying %s to %s", cs.pattern, cs.dest)
+		if err := runCmdInDir(buildahBin, args, []string{}, buildahWorkdir, outWriter, errWriter); err != nil {
+			return fmt.Errorf("buildah copy: %w", err)
+		}
+	}
+
+	if len(configArgs) > 0 {
+		args := append([]string{
+			fmt.Sprintf("--storage-driver=%s", p.opts.storageDriver),
+			"config",
+		}, configArgs...)
+		args = append(args, container)
+		if err := runCmdInDir(buildahBin, args, []string{}, buildahWorkdir, outWriter, errWriter); err != nil {
+			return fmt.Errorf("buildah config: %w", err)
+		}
+	}
+
+	args := []string{
+		fmt.Sprintf("--storage-driver=%s", p.opts.storageDriver),
+		"commit",
+		fmt.Sprintf("--format=%s", p.opts.format),
+	}
+	if p.opts.debug {
+		args = append(args, "--log-level=debug")
+	}
+	args = append(args, container, p.imageRef())
+	if err := runCmdInDir(buildahBin, args, []string{}, buildahWorkdir, outWriter, errWriter); err != nil {
+		return fmt.Errorf("buildah commit: %w", err)
+	}
+	return nil
+}
+
+// buildahFrom creates a working container from ref and returns its name. If
+// pull is false, ref must be a local image.
+func (p *packageImage) buildahFrom(ref string, pull bool) (string, error) {
+	args := []string{
+		fmt.Sprintf("--storage-driver=%s", p.opts.storageDriver),
+		"from",
+	}
+	if pull {
+		args = append(args,
+			"--quiet",
+			fmt.Sprintf("--tls-verify=%v", p.opts.tlsVerify),
+			fmt.Sprintf("--cert-dir=%s", p.opts.certDir),
+		)
+	} else {
+		args = append(args, "--pull=never")
+	}
+	args = append(args, ref)
+	var stdout bytes.Buffer
+	err := runCmdInDir(buildahBin, args, []string{}, buildahWorkdir, &stdout, os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("buildah from: %w", err)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseCopySpecs(t *testing.T) {
+	tests := map[string]struct {
+		s       string
+		workdir string
+		want    []copySpec
+		wantErr bool
+	}{
+		"empty": {
+			s: "",
+		},
+		"with destination": {
+			s:    ".ods/artifacts/app.jar -> /deployments/app.jar",
+			want: []copySpec{{pattern: ".ods/artifacts/app.jar", dest: "/deployments/app.jar"}},
+		},
+		"without destination": {
+			s:       "docker/app\nconfig/*.yaml",
+			workdir: "/app",
+			want: []copySpec{
+				{pattern: "docker/app", dest: "/app/"},
+				{pattern: "config/*.yaml", dest: "/app/"},
+			},
+		},
+		"without destination and workdir": {
+			s:    "app",
+			want: []copySpec{{pattern: "app", dest: "/"}},
+		},
+		"semicolon separated": {
+			s: "lib/*.jar -> /app/lib/; app.jar -> /app/",
+			want: []copySpec{
+				{pattern: "lib/*.jar", dest: "/app/lib/"},
+				{pattern: "app.jar", dest: "/app/"},
+			},
+		},
+		"relative destination": {
+			s:       "app.jar -> app/",
+			wantErr: true,
+		},
+		"source outside of checkout dir": {
+			s:       "../app.jar -> /app/",
+			wantErr: true,
+		},
+		"absolute source": {
+			s:       "/etc/passwd -> /app/",
+			wantErr: true,
+		},
+		"invalid pattern": {
+			s:       "[app.jar -> /app/",
+			wantErr: true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := parseCopySpecs(tc.s, tc.workdir)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("want error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, got, cmp.AllowUnexported(copySpec{})); diff != "" {
+				t.Fatalf("copy specs mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCopySpecSources(t *testing.T) {
+	dir := t.TempDir()
+	for _, f := range []string{"lib/a.jar", "lib/b.jar", "lib/readme.txt"} {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(f)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, f), []byte(f), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := copySpec{pattern: "lib/*.jar"}.sources(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(dir, "lib/a.jar"), filepath.Join(dir, "lib/b.jar")}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("sources mismatch (-want +got):\n%s", diff)
+	}
+	if _, err := (copySpec{pattern: "lib/*.war"}).sources(dir); err == nil {
+		t.Fatal("want error for pattern without matches, got none")
+	}
+}
+
+func TestAssembleConfigArgs(t *testing.T) {
+	tests := map[string]struct {
+		workdir    string
+		user       string
+		entrypoint string
+		expose     string
+		want       []string
+		wantErr    bool
+	}{
+		"none": {},
+		"all": {
+			workdir:    "/app",
+			user:       "1001",
+			entrypoint: "java -jar '/app/my app.jar'",
+			expose:     "8080 9000/UDP",
+			want: []string{
+				"--workingdir=/app",
+				"--user=1001",
+				`--entrypoint=["java","-jar","/app/my app.jar"]`,
+				"--cmd=",
+				"--port=8080/tcp",
+				"--port=9000/udp",
+			},
+		},
+		"relative workdir": {
+			workdir: "app",
+			wantErr: true,
+		},
+		"invalid port": {
+			expose:  "http",
+			wantErr: true,
+		},
+		"invalid protocol": {
+			expose:  "8080/sctp",
+			wantErr: true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			opts := defaultOptions
+			opts.workdir, opts.user, opts.entrypoint, opts.expose = tc.workdir, tc.user, tc.entrypoint, tc.expose
+			got, err := assembleConfigArgs(opts)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("want error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Fatalf("config args mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
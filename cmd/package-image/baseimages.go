@@ -0,0 +1,224 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/shlex"
+	"github.com/opendevstack/ods-pipeline-image/internal/dockerfile"
+	"github.com/opendevstack/ods-pipeline-image/internal/image"
+	"github.com/opendevstack/ods-pipeline/pkg/artifact"
+)
+
+// baseImage is an image a stage of the Dockerfile is based on.
+type baseImage struct {
+	// Stage is the name of the stage, or its index if it has no name.
+	Stage string `json:"stage"`
+	// Ref is the reference given in the Dockerfile with ARGs expanded.
+	Ref string `json:"ref"`
+	// Mirror is the reference the image is pulled from instead of Ref, if a
+	// registry mirror applies.
+	Mirror string `json:"mirror,omitempty"`
+	// Digest is the resolved digest of the image. It is empty if it could
+	// not be resolved.
+	Digest string `json:"digest,omitempty"`
+
+	index int
+	ref   image.Reference
+}
+
+// effectiveRef returns the reference the image is pulled from.
+func (b baseImage) effectiveRef() string {
+	if b.Mirror != "" {
+		return b.Mirror
+	}
+	return b.Ref
+}
+
+// pinned returns the reference of the base image pinned to its digest.
+func (b baseImage) pinned() string {
+	return fmt.Sprintf("%s@%s", b.ref.Name(), b.Digest)
+}
+
+// imageArtifact is the image artifact written by the task. It extends the
+// artifact of the ODS pipeline with the base images the image is built from.
+type imageArtifact struct {
+	artifact.Image
+	BaseImages []baseImage `json:"baseImages,omitempty"`
+}
+
+// dockerfilePath returns the path of the Dockerfile, which is relative to the
+// context directory.
+func (p *packageImage) dockerfilePath() string {
+	if filepath.IsAbs(p.opts.dockerfile) {
+		return p.opts.dockerfile
+	}
+	return filepath.Join(p.opts.checkoutDir, p.opts.contextDir, p.opts.dockerfile)
+}
+
+// buildArgs returns the build args passed to buildah.
+func (p *packageImage) buildArgs() (map[string]string, error) {
+	args, err := p.buildahBuildArgs(p.imageRef())
+	if err != nil {
+		return nil, err
+	}
+	return buildArgsFromArgs(args), nil
+}
+
+// externalBaseImages returns the images the stages of df are based on,
+// skipping stages based on earlier stages or on scratch.
+func externalBaseImages(df *dockerfile.Dockerfile, buildArgs map[string]string) ([]baseImage, error) {
+	var bases []baseImage
+	for i, s := range df.Stages {
+		ref, stage := df.Base(i, buildArgs)
+		if stage >= 0 || ref == dockerfile.Scratch {
+			continue
+		}
+		name := s.Name
+		if name == "" {
+			name = fmt.Sprint(i)
+		}
+		r, err := image.ParseReference(ref)
+		if err != nil {
+			return nil, fmt.Errorf("stage %s (line %d): %w", name, s.From.StartLine, err)
+		}
+		bases = append(bases, baseImage{Stage: name, Ref: ref, Digest: r.Digest, index: i, ref: r})
+	}
+	return bases, nil
+}
+
+// checkBaseImageAllowlist returns a violation for each base image which is
+// not located within one of the allowed registry or repository prefixes.
+func checkBaseImageAllowlist(bases []baseImage, allowed []string) []string {
+	var violations []string
+	for _, b := range bases {
+		ok := false
+		for _, a := range allowed {
+			if b.ref.MatchesPrefix(a) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			violations = append(violations, fmt.Sprintf("- stage %s: %s is not within %s", b.Stage, b.Ref, strings.Join(allowed, ", ")))
+		}
+	}
+	return violations
+}
+
+// parseDockerfile parses the Dockerfile. An image assembled onto a base image
+// is treated like a Dockerfile consisting of a single FROM instruction.
+func (p *packageImage) parseDockerfile() (*dockerfile.Dockerfile, error) {
+	if p.assembled() {
+		return dockerfile.Parse([]byte(fmt.Sprintf("FROM %s\n", p.opts.baseImage)))
+	}
+	return dockerfile.ParseFile(p.dockerfilePath())
+}
+
+// checkBaseImages parses the Dockerfile, checks the base images of all stages
+// against the allowlist, maps them to registry mirrors and resolves their
+// digests. If base images are mirrored or shall be pinned, a Dockerfile with
+// rewritten FROM lines is written and used for the build.
+func (p *packageImage) checkBaseImages() error {
+	df, err := p.parseDockerfile()
+	if err != nil {
+		return err
+	}
+	if p.target != "" && !hasStage(df, p.target) {
+		return fmt.Errorf("target stage %s does not exist in %s", p.target, p.opts.dockerfile)
+	}
+	buildArgs, err := p.buildArgs()
+	if err != nil {
+		return err
+	}
+	bases, err := externalBaseImages(df, buildArgs)
+	if err != nil {
+		return err
+	}
+
+	// The allowlist applies to the registries named in the Dockerfile, not to
+	// the mirrors the images are pulled from.
+	allowed, err := shlex.Split(p.opts.baseImageAllowlist)
+	if err != nil {
+		return fmt.Errorf("parse base image allowlist (%s): %w", p.opts.baseImageAllowlist, err)
+	}
+	if len(allowed) > 0 {
+		if violations := checkBaseImageAllowlist(bases, allowed); len(violations) > 0 {
+			return fmt.Errorf("base images are not allowed:\n%s", strings.Join(violations, "\n"))
+		}
+	}
+
+	mirrors, err := parseRegistryMirrors(p.opts.registryMirrors, p.opts.nexusURL)
+	if err != nil {
+		return err
+	}
+	for i, b := range bases {
+		if m, ok := mirrorReference(b.ref, mirrors); ok {
+			bases[i].ref = m
+			bases[i].Mirror = m.String()
+			p.logger.Infof("Pulling base image of stage %s from mirror: %s", b.Stage, m)
+		}
+	}
+
+	for i, b := range bases {
+		if b.Digest != "" {
+			continue
+		}
+		ra := newRegistryAccess(b.ref.Registry, p.opts.tlsVerify, p.opts.certDir, p.opts.debug)
+		d, err := skopeoInspectDigest(b.ref.String(), ra, os.Stderr)
+		if err != nil {
+			if p.opts.pinBaseImages {
+				return fmt.Errorf("resolve digest of base image %s: %w", b.effectiveRef(), err)
+			}
+			p.logger.Warnf("Could not resolve digest of base image %s: %s", b.effectiveRef(), err)
+			continue
+		}
+		bases[i].Digest = d
+		p.logger.Infof("Base image of stage %s: %s@%s", b.Stage, b.effectiveRef(), d)
+	}
+	p.baseImages = bases
+
+	rewritten := map[int]string{}
+	for _, b := range bases {
+		if p.opts.pinBaseImages {
+			rewritten[b.index] = b.pinned()
+		} else if b.Mirror != "" {
+			rewritten[b.index] = b.Mirror
+		}
+	}
+	if p.assembled() {
+		p.assembleBase = rewritten[0]
+		return nil
+	}
+	if len(rewritten) > 0 {
+		f := filepath.Join(buildahWorkdir, fmt.Sprintf("%s.Dockerfile", p.imageNameNoSha()))
+		if err := p.writeBuildDockerfile(f, df.WithBases(rewritten)); err != nil {
+			return fmt.Errorf("write rewritten Dockerfile: %w", err)
+		}
+		p.buildDockerfile = f
+	}
+	return nil
+}
+
+// writeBuildDockerfile writes the Dockerfile content to be built to f. As
+// buildah looks for <Dockerfile>.dockerignore next to the Dockerfile it
+// builds, the one of the original Dockerfile is copied along.
+func (p *packageImage) writeBuildDockerfile(f string, content []byte) error {
+	if err := os.WriteFile(f, content, 0644); err != nil {
+		return err
+	}
+	ignore, err := os.ReadFile(p.dockerfilePath() + ".dockerignore")
+	if errors.Is(err, os.ErrNotExist) {
+		if err := os.Remove(f + ".dockerignore"); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(f+".dockerignore", ignore, 0644)
+}
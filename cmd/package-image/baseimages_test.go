@@ -0,0 +1,81 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/opendevstack/ods-pipeline-image/internal/dockerfile"
+)
+
+func TestExternalBaseImages(t *testing.T) {
+	df, err := dockerfile.Parse([]byte(`ARG RUNTIME=registry.access.redhat.com/ubi9/ubi-minimal
+FROM golang:1.21 AS build
+FROM build AS test
+FROM scratch AS empty
+FROM ${RUNTIME}@sha256:abc
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bases, err := externalBaseImages(df, map[string]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	type result struct {
+		Stage, Ref, Digest, Pinned string
+	}
+	var got []result
+	for _, b := range bases {
+		got = append(got, result{b.Stage, b.Ref, b.Digest, b.pinned()})
+	}
+	want := []result{
+		{"build", "golang:1.21", "", "docker.io/library/golang@"},
+		{"3", "registry.access.redhat.com/ubi9/ubi-minimal@sha256:abc", "sha256:abc", "registry.access.redhat.com/ubi9/ubi-minimal@sha256:abc"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("base images mismatch (-want +got):\n%s", diff)
+	}
+
+	violations := checkBaseImageAllowlist(bases, []string{"registry.access.redhat.com", "docker.io/library/alpine"})
+	wantViolations := []string{"- stage build: golang:1.21 is not within registry.access.redhat.com, docker.io/library/alpine"}
+	if diff := cmp.Diff(wantViolations, violations); diff != "" {
+		t.Fatalf("violations mismatch (-want +got):\n%s", diff)
+	}
+	if violations := checkBaseImageAllowlist(bases, []string{"registry.access.redhat.com", "docker.io/library"}); len(violations) > 0 {
+		t.Fatalf("want no violations, got %v", violations)
+	}
+}
+
+func TestWriteBuildDockerfile(t *testing.T) {
+	opts := defaultOptions
+	opts.checkoutDir = t.TempDir()
+	opts.contextDir = "."
+	ignoreFile := filepath.Join(opts.checkoutDir, "Dockerfile.dockerignore")
+	if err := os.WriteFile(ignoreFile, []byte("*.log\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p := packageImage{opts: opts}
+	f := filepath.Join(t.TempDir(), "app.Dockerfile")
+	if err := p.writeBuildDockerfile(f, []byte("FROM mirror.example.com/ubi9\n")); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(f + ".dockerignore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "*.log\n" {
+		t.Fatalf("unexpected .dockerignore %q", got)
+	}
+
+	if err := os.Remove(ignoreFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.writeBuildDockerfile(f, []byte("FROM mirror.example.com/ubi9\n")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(f + ".dockerignore"); !os.IsNotExist(err) {
+		t.Fatalf("want stale .dockerignore removed, got %v", err)
+	}
+}
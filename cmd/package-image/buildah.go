@@ -24,6 +24,53 @@ func (p *packageImage) buildahBuild(outWriter, errWriter io.Writer) error {
 	if err != nil {
 		return fmt.Errorf("assemble build args: %w", err)
 	}
+	secrets := p.secretBuildArgValues(args)
+	p.logger.Infof("Build args: %s", strings.Join(maskedBuildArgs(args, newSecretMatcher(secrets)), ", "))
+	return runCmdInDir(buildahBin, args, []string{}, buildahWorkdir, outWriter, errWriter)
+}
+
+// buildahBuildStage builds the given stage of the Dockerfile, tagging the
+// resulting image with given tag.
+func (p *packageImage) buildahBuildStage(stage, tag string, outWriter, errWriter io.Writer) error {
+	args, err := p.buildahBuildStageArgs(stage, tag)
+	if err != nil {
+		return fmt.Errorf("assemble build args: %w", err)
+	}
+	return runCmdInDir(buildahBin, args, []string{}, buildahWorkdir, outWriter, errWriter)
+}
+
+// buildahBuildStageArgs assembles the args to build the given stage. The
+// layers cached by the build of the image are reused, so that instructions
+// shared with the image, such as running tests, are not executed again.
+func (p *packageImage) buildahBuildStageArgs(stage, tag string) ([]string, error) {
+	s := *p
+	s.target = stage
+	s.cacheLayers = true
+	s.reuseLayers = true
+	return s.buildahBuildArgs(tag)
+}
+
+// buildahRemoveImage removes the local image with given tag.
+func (p *packageImage) buildahRemoveImage(tag string, outWriter, errWriter io.Writer) error {
+	args := []string{
+		fmt.Sprintf("--storage-driver=%s", p.opts.storageDriver),
+		"rmi",
+		tag,
+	}
+	return runCmdInDir(buildahBin, args, []string{}, buildahWorkdir, outWriter, errWriter)
+}
+
+// buildahPushOCI pushes the local image source to the OCI layout at dir,
+// referenced by ref within the layout.
+func (p *packageImage) buildahPushOCI(source, dir, ref string, outWriter, errWriter io.Writer) error {
+	args := []string{
+		fmt.Sprintf("--storage-driver=%s", p.opts.storageDriver),
+		"push",
+	}
+	if p.opts.debug {
+		args = append(args, "--log-level=debug")
+	}
+	args = append(args, source, fmt.Sprintf("oci:%s:%s", dir, ref))
 	return runCmdInDir(buildahBin, args, []string{}, buildahWorkdir, outWriter, errWriter)
 }
 
@@ -32,12 +79,16 @@ func (p *packageImage) buildahPushTar(outWriter, errWriter io.Writer) error {
 	args := []string{
 		fmt.Sprintf("--storage-driver=%s", p.opts.storageDriver),
 		"push",
-		fmt.Sprintf("--digestfile=%s", tektonResultsImageDigestFile),
+		fmt.Sprintf("--digestfile=%s", p.digestFile()),
 	}
 	if p.opts.debug {
 		args = append(args, "--log-level=debug")
 	}
-	args = append(args, p.imageRef(), fmt.Sprintf("oci:%s", filepath.Join(p.opts.checkoutDir, p.imageName())))
+	dir, err := p.ociLayoutDir()
+	if err != nil {
+		return err
+	}
+	args = append(args, p.imageRef(), fmt.Sprintf("oci:%s:%s", dir, p.imageId.GitCommitSHA))
 	return runCmdInDir(buildahBin, args, []string{}, buildahWorkdir, outWriter, errWriter)
 }
 
@@ -86,6 +137,10 @@ func (p *packageImage) buildahBuildArgs(tag string) ([]string, error) {
 	if err != nil {
 		return nil, fmt.Errorf("abs dir: %w", err)
 	}
+	dockerfile := opts.dockerfile
+	if p.buildDockerfile != "" {
+		dockerfile = p.buildDockerfile
+	}
 
 	args := []string{
 		fmt.Sprintf("--storage-driver=%s", opts.storageDriver),
@@ -93,10 +148,28 @@ func (p *packageImage) buildahBuildArgs(tag string) ([]string, error) {
 		fmt.Sprintf("--format=%s", opts.format),
 		fmt.Sprintf("--tls-verify=%v", opts.tlsVerify),
 		fmt.Sprintf("--cert-dir=%s", opts.certDir),
-		"--no-cache",
-		fmt.Sprintf("--file=%s", opts.dockerfile),
+	}
+	if p.cacheLayers {
+		args = append(args, "--layers")
+	}
+	if !p.reuseLayers {
+		args = append(args, "--no-cache")
+	}
+	args = append(args,
+		fmt.Sprintf("--file=%s", dockerfile),
 		fmt.Sprintf("--tag=%s", tag),
+	)
+	if p.target != "" {
+		args = append(args, fmt.Sprintf("--target=%s", p.target))
+	}
+	// Later build args take precedence, so explicit extra args override the
+	// build args file, which overrides the built-in build args.
+	args = append(args, builtinBuildArgs(p.ctxt, p.buildTime)...)
+	fileArgs, err := p.fileBuildArgs()
+	if err != nil {
+		return nil, err
 	}
+	args = append(args, fileArgs...)
 	args = append(args, extraArgs...)
 	nexusArgs, err := p.nexusBuildArgs()
 	if err != nil {
@@ -90,6 +90,48 @@ func TestBuildahBuildArgs(t *testing.T) {
 	}
 }
 
+func TestBuildahBuildArgsOfStageImage(t *testing.T) {
+	basePath, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := packageImage{opts: defaultOptions, target: "debug", cacheLayers: true, reuseLayers: true}
+	got, err := p.buildahBuildArgs("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"--storage-driver=vfs", "bud", "--format=oci",
+		"--tls-verify=true", "--cert-dir=/etc/containers/certs.d",
+		"--layers",
+		"--file=./Dockerfile", "--tag=foo", "--target=debug", filepath.Join(basePath, "docker"),
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("args mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestBuildahBuildStageArgs(t *testing.T) {
+	basePath, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := packageImage{opts: defaultOptions, primary: true}
+	got, err := p.buildahBuildStageArgs("test", "localhost/foo-test:abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"--storage-driver=vfs", "bud", "--format=oci",
+		"--tls-verify=true", "--cert-dir=/etc/containers/certs.d",
+		"--layers",
+		"--file=./Dockerfile", "--tag=localhost/foo-test:abc", "--target=test", filepath.Join(basePath, "docker"),
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("args mismatch (-want +got):\n%s", diff)
+	}
+}
+
 func TestNexusBuildArgs(t *testing.T) {
 	tests := map[string]struct {
 		nexusUrl           string
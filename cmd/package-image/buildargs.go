@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/opendevstack/ods-pipeline/pkg/pipelinectxt"
+)
+
+var buildArgNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// builtinBuildArgs returns the build args passed to every build, describing
+// the commit being built and the time of the build.
+func builtinBuildArgs(ctxt *pipelinectxt.ODSContext, buildTime time.Time) []string {
+	if ctxt == nil {
+		return nil
+	}
+	return []string{
+		fmt.Sprintf("--build-arg=GIT_COMMIT=%s", ctxt.GitCommitSHA),
+		fmt.Sprintf("--build-arg=GIT_REF=%s", ctxt.GitRef),
+		fmt.Sprintf("--build-arg=GIT_URL=%s", ctxt.GitURL),
+		fmt.Sprintf("--build-arg=BUILD_DATE=%s", buildTime.UTC().Format(time.RFC3339)),
+	}
+}
+
+// parseBuildArgsFile parses KEY=VALUE lines. Empty lines and lines starting
+// with # are ignored. Values are Go templates rendered with the ODS context,
+// e.g. "VERSION={{.GitRef}}". Surrounding quotes of values are removed.
+func parseBuildArgsFile(content []byte, ctxt *pipelinectxt.ODSContext) ([]string, error) {
+	var args []string
+	sc := bufio.NewScanner(bytes.NewReader(content))
+	n := 0
+	for sc.Scan() {
+		n++
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(line, "=")
+		name = strings.TrimSpace(name)
+		if !ok || !buildArgNameRegexp.MatchString(name) {
+			return nil, fmt.Errorf("line %d: must be KEY=VALUE", n)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		tmpl, err := template.New(name).Option("missingkey=error").Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		var rendered bytes.Buffer
+		if err := tmpl.Execute(&rendered, ctxt); err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		args = append(args, fmt.Sprintf("--build-arg=%s=%s", name, rendered.String()))
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return args, nil
+}
+
+// fileBuildArgs returns the build args of the build args file, if any.
+func (p *packageImage) fileBuildArgs() ([]string, error) {
+	if p.opts.buildArgsFile == "" {
+		return nil, nil
+	}
+	filename := filepath.Join(p.opts.checkoutDir, p.opts.buildArgsFile)
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("read build args file: %w", err)
+	}
+	if p.ctxt == nil {
+		return nil, fmt.Errorf("build args file %s requires the ODS context", p.opts.buildArgsFile)
+	}
+	args, err := parseBuildArgsFile(content, p.ctxt)
+	if err != nil {
+		return nil, fmt.Errorf("parse build args file %s: %w", p.opts.buildArgsFile, err)
+	}
+	return args, nil
+}
+
+// maskedBuildArgs renders the build args in args as sorted NAME=VALUE list.
+// Values of build args with secret-like names are masked entirely, other
+// values have secrets and credentials masked.
+func maskedBuildArgs(args []string, m secretMatcher) []string {
+	var rendered []string
+	for name, value := range buildArgsFromArgs(args) {
+		if isSecretName(name) {
+			value = "***"
+		} else {
+			value = m.mask(value)
+		}
+		rendered = append(rendered, fmt.Sprintf("%s=%s", name, value))
+	}
+	sort.Strings(rendered)
+	return rendered
+}
@@ -0,0 +1,415 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/google/shlex"
+	"github.com/opendevstack/ods-pipeline-image/internal/oci"
+	"github.com/opendevstack/ods-pipeline-image/internal/registry"
+	"github.com/opendevstack/ods-pipeline/pkg/artifact"
+	"github.com/opendevstack/ods-pipeline/pkg/logging"
+	"github.com/opendevstack/ods-pipeline/pkg/pipelinectxt"
+)
+
+const (
+	// bundleIndexFile is the file of a bundle listing the images it contains.
+	bundleIndexFile = "bundle.json"
+	// bundlePublicKeyFile is the file of a bundle holding the public key the
+	// images are signed with.
+	bundlePublicKeyFile = "cosign.pub"
+)
+
+// bundleIndex is the manifest index of a bundle.
+type bundleIndex struct {
+	Images []bundleImage `json:"images"`
+	// PublicKey is the file of the public key within the bundle, if any.
+	PublicKey string `json:"publicKey,omitempty"`
+}
+
+// bundleImage is an image of a bundle, described by its image artifact.
+type bundleImage struct {
+	artifact.Image
+	// Layout is the directory within the bundle of the OCI layout holding
+	// the image together with its signatures, attestations and SBOMs.
+	Layout string `json:"layout"`
+	// Referrers are the artifacts referring to the image, such as attached
+	// SBOMs, which are stored in the OCI layout as well.
+	Referrers []oci.Descriptor `json:"referrers,omitempty"`
+}
+
+type exportBundleOptions struct {
+	checkoutDir string
+	artifacts   string
+	publicKey   string
+	output      string
+	certDir     string
+	tlsVerify   bool
+	debug       bool
+}
+
+type importBundleOptions struct {
+	checkoutDir    string
+	bundle         string
+	registry       string
+	imageNamespace string
+	publicKey      string
+	certDir        string
+	tlsVerify      bool
+	debug          bool
+}
+
+// runExportBundle writes the images described by image artifacts, together
+// with their signatures, attestations, referrers such as SBOMs and the public
+// key, into one tarball for delivery into environments without registry
+// access.
+func runExportBundle(args []string) error {
+	opts := exportBundleOptions{}
+	fs := flag.NewFlagSet("export-bundle", flag.ExitOnError)
+	fs.StringVar(&opts.checkoutDir, "checkout-dir", defaultOptions.checkoutDir, "Checkout dir")
+	fs.StringVar(&opts.artifacts, "artifacts", pipelinectxt.ImageDigestsPath+"/*.json", "Glob patterns (space separated, relative to checkout dir) of image artifact JSON files describing the images to export")
+	fs.StringVar(&opts.publicKey, "public-key", "", "cosign public key (relative to checkout dir) to include in the bundle")
+	fs.StringVar(&opts.output, "output", "image-bundle.tar", "Bundle file to write (relative to checkout dir)")
+	fs.StringVar(&opts.certDir, "cert-dir", defaultOptions.certDir, "Use certificates at the specified path to access the registries")
+	fs.BoolVar(&opts.tlsVerify, "tls-verify", defaultOptions.tlsVerify, "TLS verify")
+	fs.BoolVar(&opts.debug, "debug", defaultOptions.debug, "debug mode")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	logger := newLogger(opts.debug)
+
+	images, err := readImageArtifacts(opts.checkoutDir, opts.artifacts)
+	if err != nil {
+		return err
+	}
+	dir, err := os.MkdirTemp(buildahWorkdir, "bundle-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	index := bundleIndex{}
+	seen := map[string]bool{}
+	for _, a := range images {
+		layout := path.Join("images", a.Repository, a.Name, a.Tag)
+		if seen[layout] {
+			return fmt.Errorf("image %s is listed more than once", a.Ref)
+		}
+		seen[layout] = true
+		logger.Infof("Exporting image %s ...", imageRef(a))
+		layoutDir := filepath.Join(dir, filepath.FromSlash(layout))
+		ra := newRegistryAccess(a.Registry, opts.tlsVerify, opts.certDir, opts.debug)
+		if err := NewCosignClient("").WithRegistryAccess(ra).Save(imageRef(a), layoutDir); err != nil {
+			return fmt.Errorf("save image %s: %w", a.Ref, err)
+		}
+		referrers, err := saveBundleReferrers(a, opts, layoutDir)
+		if err != nil {
+			return fmt.Errorf("save referrers of image %s: %w", a.Ref, err)
+		}
+		if err := checkBundleLayout(layoutDir, a.Digest); err != nil {
+			return fmt.Errorf("image %s: %w", a.Ref, err)
+		}
+		index.Images = append(index.Images, bundleImage{Image: a, Layout: layout, Referrers: referrers})
+	}
+	if opts.publicKey != "" {
+		key, err := os.ReadFile(filepath.Join(opts.checkoutDir, opts.publicKey))
+		if err != nil {
+			return fmt.Errorf("read public key: %w", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, bundlePublicKeyFile), key, 0644); err != nil {
+			return err
+		}
+		index.PublicKey = bundlePublicKeyFile
+	}
+	b, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, bundleIndexFile), b, 0644); err != nil {
+		return err
+	}
+
+	output := filepath.Join(opts.checkoutDir, opts.output)
+	if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+		return err
+	}
+	checksum, err := writeOCIArchive(dir, output)
+	if err != nil {
+		return err
+	}
+	logger.Infof("Wrote bundle %s with %d images (sha256:%s)", opts.output, len(index.Images), checksum)
+	return nil
+}
+
+// runImportBundle pushes the images of a bundle into a registry, and checks
+// that their digests and signatures are still valid. An image artifact is
+// written for each imported image.
+func runImportBundle(args []string) error {
+	opts := importBundleOptions{}
+	fs := flag.NewFlagSet("import-bundle", flag.ExitOnError)
+	fs.StringVar(&opts.checkoutDir, "checkout-dir", defaultOptions.checkoutDir, "Checkout dir")
+	fs.StringVar(&opts.bundle, "bundle", "", "Bundle file to import (relative to checkout dir)")
+	fs.StringVar(&opts.registry, "registry", "", "Registry to push the images to")
+	fs.StringVar(&opts.imageNamespace, "image-namespace", "", "Image namespace to push the images to. Defaults to the namespace of each image")
+	fs.StringVar(&opts.publicKey, "public-key", "", "cosign public key (relative to checkout dir) to verify the signatures with. Signatures are not verified if not set")
+	fs.StringVar(&opts.certDir, "cert-dir", defaultOptions.certDir, "Use certificates at the specified path to access the registry")
+	fs.BoolVar(&opts.tlsVerify, "tls-verify", defaultOptions.tlsVerify, "TLS verify")
+	fs.BoolVar(&opts.debug, "debug", defaultOptions.debug, "debug mode")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if opts.bundle == "" || opts.registry == "" {
+		return errors.New("bundle and registry must be set")
+	}
+	logger := newLogger(opts.debug)
+
+	dir, err := os.MkdirTemp(buildahWorkdir, "bundle-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	if err := extractBundle(filepath.Join(opts.checkoutDir, opts.bundle), dir); err != nil {
+		return err
+	}
+	var index bundleIndex
+	if err := readBundleIndex(filepath.Join(dir, bundleIndexFile), &index); err != nil {
+		return err
+	}
+	// The public key of the bundle travels with the images it is meant to
+	// verify, so it is only compared against the trusted public key given.
+	publicKey := ""
+	if opts.publicKey != "" {
+		publicKey = filepath.Join(opts.checkoutDir, opts.publicKey)
+		if index.PublicKey != "" {
+			if err := checkBundlePublicKey(publicKey, filepath.Join(dir, filepath.FromSlash(index.PublicKey))); err != nil {
+				return err
+			}
+		}
+	} else {
+		logger.Warnf("No public key given, signatures are not verified")
+	}
+
+	ra := newRegistryAccess(opts.registry, opts.tlsVerify, opts.certDir, opts.debug)
+	for _, bi := range index.Images {
+		if err := importBundleImage(logger, dir, bi, opts, ra, publicKey); err != nil {
+			return fmt.Errorf("import image %s: %w", bi.Ref, err)
+		}
+	}
+	return nil
+}
+
+// importBundleImage pushes a single image of the bundle extracted to dir.
+func importBundleImage(logger logging.LeveledLoggerInterface, dir string, bi bundleImage, opts importBundleOptions, ra registryAccess, publicKey string) error {
+	layoutDir := filepath.Join(dir, filepath.FromSlash(bi.Layout))
+	if err := checkBundleLayout(layoutDir, bi.Digest); err != nil {
+		return err
+	}
+	namespace := opts.imageNamespace
+	if namespace == "" {
+		namespace = bi.Repository
+	}
+	target := promotedArtifactImage(bi.Image, opts.registry, namespace, "", "")
+	logger.Infof("Pushing image %s ...", target.Ref)
+	if err := NewCosignClient("").WithRegistryAccess(ra).Load(layoutDir, target.Ref); err != nil {
+		return fmt.Errorf("push: %w", err)
+	}
+	d, err := skopeoInspectDigest(target.Ref, ra, os.Stderr)
+	if err != nil {
+		return fmt.Errorf("resolve digest of pushed image: %w", err)
+	}
+	if d != bi.Digest {
+		return fmt.Errorf("digest of pushed image (%s) does not match digest in bundle (%s)", d, bi.Digest)
+	}
+	if len(bi.Referrers) > 0 {
+		logger.Infof("Pushing %d referrers of image %s ...", len(bi.Referrers), target.Ref)
+		if err := loadBundleReferrers(bi, target, opts, layoutDir); err != nil {
+			return fmt.Errorf("push referrers: %w", err)
+		}
+	}
+	if publicKey != "" {
+		logger.Infof("Verifying signature of image %s ...", imageRef(target))
+		if err := NewCosignClient(publicKey).WithRegistryAccess(ra).Verify(imageRef(target)); err != nil {
+			return fmt.Errorf("verify signature: %w", err)
+		}
+	}
+	filename := fmt.Sprintf("%s-%s.json", target.Name, target.Repository)
+	logger.Infof("Writing image artifact %s ...", filename)
+	return pipelinectxt.WriteJsonArtifact(target, filepath.Join(opts.checkoutDir, pipelinectxt.ImageDigestsPath), filename)
+}
+
+// checkBundlePublicKey checks that the public key of the bundle, if any, is
+// the trusted public key.
+func checkBundlePublicKey(publicKey, bundlePublicKey string) error {
+	want, err := os.ReadFile(publicKey)
+	if err != nil {
+		return fmt.Errorf("read public key: %w", err)
+	}
+	got, err := os.ReadFile(bundlePublicKey)
+	if err != nil {
+		return fmt.Errorf("read public key of bundle: %w", err)
+	}
+	if !bytes.Equal(bytes.TrimSpace(want), bytes.TrimSpace(got)) {
+		return errors.New("public key of bundle does not match public key")
+	}
+	return nil
+}
+
+// saveBundleReferrers adds the artifacts referring to image a, which cosign
+// does not save, to the OCI layout at dir.
+func saveBundleReferrers(a artifact.Image, opts exportBundleOptions, dir string) ([]oci.Descriptor, error) {
+	host, repository := registryRepository(a.Registry, a.Repository, a.Name)
+	c, err := registry.NewClient(host, registryTLSVerify(a.Registry, opts.tlsVerify), opts.certDir)
+	if err != nil {
+		return nil, err
+	}
+	l, err := oci.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	return c.SaveReferrers(repository, a.Digest, l)
+}
+
+// loadBundleReferrers pushes the artifacts referring to the image bi from the
+// OCI layout at dir to the repository of the imported image target.
+func loadBundleReferrers(bi bundleImage, target artifact.Image, opts importBundleOptions, dir string) error {
+	host, repository := registryRepository(target.Registry, target.Repository, target.Name)
+	c, err := registry.NewClient(host, registryTLSVerify(target.Registry, opts.tlsVerify), opts.certDir)
+	if err != nil {
+		return err
+	}
+	l, err := oci.Open(dir)
+	if err != nil {
+		return err
+	}
+	return c.LoadReferrers(l, repository, bi.Digest, bi.Referrers)
+}
+
+// readImageArtifacts reads the image artifacts matching the space separated
+// glob patterns, relative to dir, in lexical order of their files.
+func readImageArtifacts(dir, patterns string) ([]artifact.Image, error) {
+	ps, err := shlex.Split(patterns)
+	if err != nil {
+		return nil, fmt.Errorf("parse artifacts (%s): %w", patterns, err)
+	}
+	var files []string
+	for _, p := range ps {
+		matches, err := filepath.Glob(filepath.Join(dir, p))
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %s: %w", p, err)
+		}
+		files = append(files, matches...)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no image artifacts match %s", patterns)
+	}
+	sort.Strings(files)
+	var images []artifact.Image
+	for _, f := range files {
+		a, err := artifact.ReadFromFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("read image artifact %s: %w", f, err)
+		}
+		if a.Digest == "" {
+			return nil, fmt.Errorf("image artifact %s does not specify a digest", f)
+		}
+		images = append(images, *a)
+	}
+	return images, nil
+}
+
+// checkBundleLayout checks the integrity of the OCI layout at dir, which must
+// contain the image with given digest.
+func checkBundleLayout(dir, digest string) error {
+	l, err := oci.Open(dir)
+	if err != nil {
+		return err
+	}
+	if err := l.Verify(); err != nil {
+		return err
+	}
+	for _, m := range l.Index.Manifests {
+		if m.Digest == digest {
+			return nil
+		}
+	}
+	return fmt.Errorf("image %s not found in %s", digest, dir)
+}
+
+func readBundleIndex(filename string, index *bundleIndex) error {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("read bundle index: %w", err)
+	}
+	if err := json.Unmarshal(b, index); err != nil {
+		return fmt.Errorf("parse bundle index: %w", err)
+	}
+	for _, bi := range index.Images {
+		if bi.Digest == "" || !filepath.IsLocal(bi.Layout) {
+			return fmt.Errorf("invalid image %s in bundle index", bi.Ref)
+		}
+	}
+	if index.PublicKey != "" && !filepath.IsLocal(index.PublicKey) {
+		return fmt.Errorf("invalid public key %s in bundle index", index.PublicKey)
+	}
+	return nil
+}
+
+// extractBundle extracts the tarball filename into dir. Only directories and
+// regular files within dir are allowed.
+func extractBundle(filename, dir string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("open bundle: %w", err)
+	}
+	defer f.Close()
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read bundle: %w", err)
+		}
+		if !filepath.IsLocal(hdr.Name) {
+			return fmt.Errorf("bundle entry %s is outside of the bundle", hdr.Name)
+		}
+		target := filepath.Join(dir, filepath.FromSlash(hdr.Name))
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			if err := extractFile(tr, target); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("bundle entry %s is not a regular file or directory", hdr.Name)
+		}
+	}
+}
+
+func extractFile(r io.Reader, target string) error {
+	f, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := io.Copy(f, r); err != nil {
+		return fmt.Errorf("extract %s: %w", target, err)
+	}
+	return f.Close()
+}
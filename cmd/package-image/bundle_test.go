@@ -0,0 +1,135 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/opendevstack/ods-pipeline-image/internal/oci"
+	"github.com/opendevstack/ods-pipeline-image/internal/oci/ocitest"
+	"github.com/opendevstack/ods-pipeline/pkg/artifact"
+	"github.com/opendevstack/ods-pipeline/pkg/pipelinectxt"
+)
+
+func TestReadImageArtifacts(t *testing.T) {
+	dir := t.TempDir()
+	artifactsDir := filepath.Join(dir, pipelinectxt.ImageDigestsPath)
+	for _, a := range []artifact.Image{
+		{Ref: "registry.example.com/foo/b:abc", Registry: "registry.example.com", Repository: "foo", Name: "b", Tag: "abc", Digest: "sha256:bbb"},
+		{Ref: "registry.example.com/foo/a:abc", Registry: "registry.example.com", Repository: "foo", Name: "a", Tag: "abc", Digest: "sha256:aaa"},
+	} {
+		if err := pipelinectxt.WriteJsonArtifact(a, artifactsDir, a.Name+".json"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	images, err := readImageArtifacts(dir, pipelinectxt.ImageDigestsPath+"/*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, i := range images {
+		got = append(got, i.Digest)
+	}
+	if diff := cmp.Diff([]string{"sha256:aaa", "sha256:bbb"}, got); diff != "" {
+		t.Fatalf("images mismatch (-want +got):\n%s", diff)
+	}
+	if _, err := readImageArtifacts(dir, "other/*.json"); err == nil {
+		t.Fatal("want error for pattern without matches, got none")
+	}
+
+	noDigest := artifact.Image{Ref: "registry.example.com/foo/c:abc", Name: "c"}
+	if err := pipelinectxt.WriteJsonArtifact(noDigest, artifactsDir, "c.json"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readImageArtifacts(dir, pipelinectxt.ImageDigestsPath+"/*.json"); err == nil {
+		t.Fatal("want error for artifact without digest, got none")
+	}
+}
+
+func TestBundleRoundTrip(t *testing.T) {
+	bundleDir := t.TempDir()
+	layoutDir := filepath.Join(bundleDir, "images", "foo", "app", "abc")
+	l := ocitest.WriteImage(t, layoutDir, "", oci.ContainerConfig{},
+		ocitest.Layer{Files: map[string]string{"app/server": "binary"}},
+	)
+	digest := l.Index.Manifests[0].Digest
+	if err := os.WriteFile(filepath.Join(bundleDir, bundleIndexFile), []byte(`{"images":[{"image":"registry.example.com/foo/app:abc","digest":"`+digest+`","layout":"images/foo/app/abc"}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	bundle := filepath.Join(t.TempDir(), "bundle.tar")
+	if _, err := writeOCIArchive(bundleDir, bundle); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	if err := extractBundle(bundle, dir); err != nil {
+		t.Fatal(err)
+	}
+	var index bundleIndex
+	if err := readBundleIndex(filepath.Join(dir, bundleIndexFile), &index); err != nil {
+		t.Fatal(err)
+	}
+	if len(index.Images) != 1 || index.Images[0].Digest != digest {
+		t.Fatalf("want one image with digest %s, got %+v", digest, index.Images)
+	}
+	if err := checkBundleLayout(filepath.Join(dir, index.Images[0].Layout), digest); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkBundleLayout(filepath.Join(dir, index.Images[0].Layout), "sha256:other"); err == nil {
+		t.Fatal("want error for image missing in layout, got none")
+	}
+}
+
+func TestExtractBundleOutsideOfBundle(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := tw.WriteHeader(&tar.Header{Name: "../evil", Typeflag: tar.TypeReg, Mode: 0644, Size: 4}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write([]byte("evil")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	bundle := filepath.Join(t.TempDir(), "bundle.tar")
+	if err := os.WriteFile(bundle, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := extractBundle(bundle, t.TempDir()); err == nil {
+		t.Fatal("want error for entry outside of bundle, got none")
+	}
+}
+
+func TestReadBundleIndexInvalidLayout(t *testing.T) {
+	f := filepath.Join(t.TempDir(), bundleIndexFile)
+	if err := os.WriteFile(f, []byte(`{"images":[{"digest":"sha256:aaa","layout":"../images"}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := readBundleIndex(f, &bundleIndex{}); err == nil {
+		t.Fatal("want error for layout outside of bundle, got none")
+	}
+}
+
+func TestCheckBundlePublicKey(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"trusted.pub": "-----BEGIN PUBLIC KEY-----\nabc\n-----END PUBLIC KEY-----\n",
+		"same.pub":    "-----BEGIN PUBLIC KEY-----\nabc\n-----END PUBLIC KEY-----",
+		"other.pub":   "-----BEGIN PUBLIC KEY-----\nxyz\n-----END PUBLIC KEY-----\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	trusted := filepath.Join(dir, "trusted.pub")
+	if err := checkBundlePublicKey(trusted, filepath.Join(dir, "same.pub")); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkBundlePublicKey(trusted, filepath.Join(dir, "other.pub")); err == nil {
+		t.Fatal("want error for different public key, got none")
+	}
+}
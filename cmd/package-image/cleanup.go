@@ -0,0 +1,240 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/opendevstack/ods-pipeline/pkg/logging"
+)
+
+var (
+	// gitSHATagPattern matches the primary tags pushed by the package task.
+	gitSHATagPattern = regexp.MustCompile(`^[0-9a-f]{40}$`)
+	// attachmentTagPattern matches the tags under which cosign stores
+	// signatures, attestations and SBOMs of an image, as well as the
+	// referrers tag schema fallback tags (without suffix) under which the
+	// index of OCI referrers of an image is stored.
+	attachmentTagPattern = regexp.MustCompile(`^(sha256)-([0-9a-f]{64})(\.(sig|att|sbom))?$`)
+)
+
+type cleanupOptions struct {
+	registry            string
+	imageNamespace      string
+	imageStream         string
+	keepLast            int
+	keepTags            string
+	keepYoungerThanDays int
+	dryRun              bool
+	certDir             string
+	tlsVerify           bool
+	debug               bool
+}
+
+type cleanupImages struct {
+	logger logging.LeveledLoggerInterface
+	opts   cleanupOptions
+	ra     registryAccess
+}
+
+// taggedImage is a manifest in a repository together with the tags
+// referencing it.
+type taggedImage struct {
+	digest  string
+	created time.Time
+	tags    []string
+}
+
+// retentionPolicy determines which images to keep.
+// Only images having a Git commit SHA tag are subject to deletion.
+type retentionPolicy struct {
+	// keepLast is the number of most recent images with a Git commit SHA tag to keep.
+	keepLast int
+	// keepTagPatterns are glob patterns. Images having a matching tag are kept.
+	keepTagPatterns []string
+	// keepYoungerThan keeps images created within this duration. Zero disables the rule.
+	keepYoungerThan time.Duration
+}
+
+// runCleanup deletes images of an image stream according to retention rules,
+// together with signatures and attestations which are no longer attached
+// to any image.
+func runCleanup(args []string) error {
+	opts := cleanupOptions{}
+	fs := flag.NewFlagSet("cleanup", flag.ExitOnError)
+	fs.StringVar(&opts.registry, "registry", defaultOptions.registry, "Registry")
+	fs.StringVar(&opts.imageNamespace, "image-namespace", "", "Image namespace")
+	fs.StringVar(&opts.imageStream, "image-stream", "", "Image stream to clean up")
+	fs.IntVar(&opts.keepLast, "keep-last", 10, "Number of most recent images with a Git commit SHA tag to keep")
+	fs.StringVar(&opts.keepTags, "keep-tags", "latest", "Glob patterns (e.g. 'latest v*') of tags. Images referenced by a matching tag are kept")
+	fs.IntVar(&opts.keepYoungerThanDays, "keep-younger-than-days", 0, "Keep images created less than the given number of days ago. 0 disables this rule")
+	fs.BoolVar(&opts.dryRun, "dry-run", false, "Only log what would be deleted")
+	fs.StringVar(&opts.certDir, "cert-dir", defaultOptions.certDir, "Use certificates at the specified path to access the registry")
+	fs.BoolVar(&opts.tlsVerify, "tls-verify", defaultOptions.tlsVerify, "TLS verify")
+	fs.BoolVar(&opts.debug, "debug", defaultOptions.debug, "debug mode")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if opts.imageNamespace == "" || opts.imageStream == "" {
+		return errors.New("image-namespace and image-stream must be set")
+	}
+	policy, err := newRetentionPolicy(opts.keepLast, opts.keepTags, opts.keepYoungerThanDays)
+	if err != nil {
+		return err
+	}
+	c := &cleanupImages{
+		logger: newLogger(opts.debug),
+		opts:   opts,
+		ra:     newRegistryAccess(opts.registry, opts.tlsVerify, opts.certDir, opts.debug),
+	}
+	return c.run(policy, time.Now())
+}
+
+func newRetentionPolicy(keepLast int, keepTags string, keepYoungerThanDays int) (retentionPolicy, error) {
+	if keepLast < 0 || keepYoungerThanDays < 0 {
+		return retentionPolicy{}, errors.New("keep-last and keep-younger-than-days must not be negative")
+	}
+	patterns, err := parseTagPatterns(keepTags)
+	if err != nil {
+		return retentionPolicy{}, fmt.Errorf("keep tags: %w", err)
+	}
+	return retentionPolicy{
+		keepLast:        keepLast,
+		keepTagPatterns: patterns,
+		keepYoungerThan: time.Duration(keepYoungerThanDays) * 24 * time.Hour,
+	}, nil
+}
+
+func (c *cleanupImages) repository() string {
+	return fmt.Sprintf("%s/%s/%s", c.opts.registry, c.opts.imageNamespace, c.opts.imageStream)
+}
+
+func (c *cleanupImages) run(policy retentionPolicy, now time.Time) error {
+	repo := c.repository()
+	c.logger.Infof("Listing tags of %s ...", repo)
+	tags, err := skopeoListTags(repo, c.ra, os.Stderr)
+	if err != nil {
+		return err
+	}
+	imageTags, attachmentTags := splitAttachmentTags(tags)
+	images := map[string]*taggedImage{}
+	for _, tag := range imageTags {
+		i, err := skopeoInspect(fmt.Sprintf("%s:%s", repo, tag), c.ra, os.Stderr)
+		if err != nil {
+			return err
+		}
+		if _, ok := images[i.Digest]; !ok {
+			images[i.Digest] = &taggedImage{digest: i.Digest}
+			if i.Created != nil {
+				images[i.Digest].created = *i.Created
+			}
+		}
+		images[i.Digest].tags = append(images[i.Digest].tags, tag)
+	}
+	var all []taggedImage
+	for _, i := range images {
+		all = append(all, *i)
+	}
+
+	remaining := map[string]bool{}
+	for d := range images {
+		remaining[d] = true
+	}
+	for _, i := range policy.selectForDeletion(all, now) {
+		ref := fmt.Sprintf("%s@%s", repo, i.digest)
+		if err := c.delete(ref, fmt.Sprintf("image %s (tags: %s)", ref, strings.Join(i.tags, ", "))); err != nil {
+			return err
+		}
+		delete(remaining, i.digest)
+	}
+	for _, tag := range orphanedAttachmentTags(attachmentTags, remaining) {
+		ref := fmt.Sprintf("%s:%s", repo, tag)
+		if err := c.delete(ref, fmt.Sprintf("orphaned attachment %s", ref)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *cleanupImages) delete(ref, description string) error {
+	if c.opts.dryRun {
+		c.logger.Infof("Would delete %s (dry run)", description)
+		return nil
+	}
+	c.logger.Infof("Deleting %s ...", description)
+	return skopeoDelete(ref, c.ra, os.Stdout, os.Stderr)
+}
+
+// selectForDeletion returns the images which are not retained by the policy.
+func (rp retentionPolicy) selectForDeletion(images []taggedImage, now time.Time) []taggedImage {
+	var candidates []taggedImage
+	for _, i := range images {
+		if i.hasTagMatching(func(tag string) bool { return gitSHATagPattern.MatchString(tag) }) {
+			candidates = append(candidates, i)
+		}
+	}
+	sort.SliceStable(candidates, func(a, b int) bool {
+		if candidates[a].created.Equal(candidates[b].created) {
+			return candidates[a].digest < candidates[b].digest
+		}
+		return candidates[a].created.After(candidates[b].created)
+	})
+	var deletions []taggedImage
+	for n, i := range candidates {
+		if n < rp.keepLast {
+			continue
+		}
+		if rp.keepYoungerThan > 0 && now.Sub(i.created) < rp.keepYoungerThan {
+			continue
+		}
+		if i.hasTagMatching(func(tag string) bool { return matchesAnyPattern(tag, rp.keepTagPatterns) }) {
+			continue
+		}
+		deletions = append(deletions, i)
+	}
+	return deletions
+}
+
+func (i taggedImage) hasTagMatching(match func(tag string) bool) bool {
+	for _, t := range i.tags {
+		if match(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitAttachmentTags splits tags into tags of images and tags of
+// attachments such as signatures or referrers indexes, which must not be
+// inspected as images.
+func splitAttachmentTags(tags []string) (imageTags, attachmentTags []string) {
+	for _, tag := range tags {
+		if attachmentTagPattern.MatchString(tag) {
+			attachmentTags = append(attachmentTags, tag)
+		} else {
+			imageTags = append(imageTags, tag)
+		}
+	}
+	return imageTags, attachmentTags
+}
+
+// orphanedAttachmentTags returns the attachment tags in tags whose image
+// digest is not contained in digests.
+func orphanedAttachmentTags(tags []string, digests map[string]bool) []string {
+	var orphaned []string
+	for _, tag := range tags {
+		m := attachmentTagPattern.FindStringSubmatch(tag)
+		if m == nil {
+			continue
+		}
+		if !digests[fmt.Sprintf("%s:%s", m[1], m[2])] {
+			orphaned = append(orphaned, tag)
+		}
+	}
+	return orphaned
+}
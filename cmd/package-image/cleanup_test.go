@@ -0,0 +1,98 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSelectForDeletion(t *testing.T) {
+	now := time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC)
+	sha := func(c string) string { return strings.Repeat(c, 40) }
+	daysAgo := func(d int) time.Time { return now.Add(-time.Duration(d) * 24 * time.Hour) }
+	images := []taggedImage{
+		{digest: "sha256:1", created: daysAgo(1), tags: []string{sha("1")}},
+		{digest: "sha256:2", created: daysAgo(2), tags: []string{sha("2"), "latest"}},
+		{digest: "sha256:3", created: daysAgo(3), tags: []string{sha("3")}},
+		{digest: "sha256:4", created: daysAgo(4), tags: []string{sha("4"), "v1.0.0"}},
+		{digest: "sha256:5", created: daysAgo(5), tags: []string{sha("5")}},
+		{digest: "sha256:6", created: daysAgo(30), tags: []string{"manual"}},
+	}
+	tests := map[string]struct {
+		keepLast            int
+		keepTags            string
+		keepYoungerThanDays int
+		wantDigests         []string
+	}{
+		"keep last": {
+			keepLast:    2,
+			wantDigests: []string{"sha256:3", "sha256:4", "sha256:5"},
+		},
+		"keep last and tag patterns": {
+			keepLast:    1,
+			keepTags:    "latest v*",
+			wantDigests: []string{"sha256:3", "sha256:5"},
+		},
+		"keep younger than": {
+			keepLast:            0,
+			keepYoungerThanDays: 4,
+			wantDigests:         []string{"sha256:4", "sha256:5"},
+		},
+		"keep everything": {
+			keepLast: 10,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			rp, err := newRetentionPolicy(tc.keepLast, tc.keepTags, tc.keepYoungerThanDays)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, i := range rp.selectForDeletion(images, now) {
+				got = append(got, i.digest)
+			}
+			if diff := cmp.Diff(tc.wantDigests, got); diff != "" {
+				t.Fatalf("deletions mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestOrphanedAttachmentTags(t *testing.T) {
+	kept := strings.Repeat("a", 64)
+	deleted := strings.Repeat("b", 64)
+	tags := []string{
+		"sha256-" + kept + ".sig",
+		"sha256-" + kept + ".att",
+		"sha256-" + deleted + ".sig",
+		"sha256-" + deleted + ".sbom",
+		"sha256-" + kept,
+		"sha256-" + deleted,
+		"sha256-" + deleted + ".unknown",
+		"latest",
+	}
+	got := orphanedAttachmentTags(tags, map[string]bool{"sha256:" + kept: true})
+	want := []string{"sha256-" + deleted + ".sig", "sha256-" + deleted + ".sbom", "sha256-" + deleted}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("orphaned tags mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestSplitAttachmentTags(t *testing.T) {
+	digest := strings.Repeat("a", 64)
+	imageTags, attachmentTags := splitAttachmentTags([]string{
+		"latest",
+		"sha256-" + digest + ".sig",
+		"sha256-" + digest,
+		strings.Repeat("c", 40),
+	})
+	if diff := cmp.Diff([]string{"latest", strings.Repeat("c", 40)}, imageTags); diff != "" {
+		t.Fatalf("image tags mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"sha256-" + digest + ".sig", "sha256-" + digest}, attachmentTags); diff != "" {
+		t.Fatalf("attachment tags mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -2,18 +2,38 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"sync"
+	"time"
 )
 
 // runCmdInDir invokes exe with given args and env. Stdout and stderr
 // are streamed to outWriter and errWriter, respectively.
 // If dir is non-empty, the workdir of exe will be set to it.
 func runCmdInDir(exe string, args []string, env []string, dir string, outWriter, errWriter io.Writer) error {
-	cmd := exec.Command(exe, args...)
+	return runCmdInDirWithTimeout(0, exe, args, env, dir, outWriter, errWriter)
+}
+
+// runCmdInDirWithTimeout is like runCmdInDir, but kills exe if it does not
+// finish within timeout. A zero timeout does not limit the runtime. If exe is
+// killed because of the timeout, the returned error wraps
+// context.DeadlineExceeded.
+func runCmdInDirWithTimeout(timeout time.Duration, exe string, args []string, env []string, dir string, outWriter, errWriter io.Writer) error {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, exe, args...)
+	// Do not wait for the output of processes started by exe forever once
+	// exe has been killed.
+	cmd.WaitDelay = 10 * time.Second
 	cmd.Env = append(os.Environ(), env...)
 	cmdStderr, err := cmd.StderrPipe()
 	if err != nil {
@@ -36,7 +56,11 @@ func runCmdInDir(exe string, args []string, env []string, dir string, outWriter,
 		return fmt.Errorf("collect output: %w", err)
 	}
 
-	return cmd.Wait()
+	err = cmd.Wait()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%s did not finish within %s: %w", exe, timeout, context.DeadlineExceeded)
+	}
+	return err
 }
 
 func collectOutput(rcStdout, rcStderr io.ReadCloser, wStdout, wStderr io.Writer) error {
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestRunCmdInDirWithTimeout(t *testing.T) {
+	err := runCmdInDirWithTimeout(100*time.Millisecond, "sleep", []string{"5"}, []string{}, "", io.Discard, io.Discard)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("want deadline exceeded error, got %v", err)
+	}
+	err = runCmdInDirWithTimeout(5*time.Second, "true", []string{}, []string{}, "", io.Discard, io.Discard)
+	if err != nil {
+		t.Fatalf("want no error, got %s", err)
+	}
+}
@@ -0,0 +1,419 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/google/shlex"
+	"github.com/opendevstack/ods-pipeline-image/internal/oci"
+	"github.com/opendevstack/ods-pipeline/pkg/pipelinectxt"
+)
+
+// contentScanReportsPath is the artifacts path of content scan reports.
+const contentScanReportsPath = pipelinectxt.ArtifactsPath + "/content-scan-reports"
+
+const (
+	// contentScannerSecret scans the files of the image for secrets. It is
+	// enabled by the secret scan mode secretScanLayers.
+	contentScannerSecret = "secret"
+	// contentScannerMisconfig scans the files of the image for
+	// misconfigurations.
+	contentScannerMisconfig = "misconfig"
+)
+
+const (
+	contentFindingSecret           = "secret"
+	contentFindingMisconfiguration = "misconfiguration"
+)
+
+// trivyLayer identifies the layer of a finding in trivy JSON reports.
+type trivyLayer struct {
+	Digest    string `json:"Digest"`
+	DiffID    string `json:"DiffID"`
+	CreatedBy string `json:"CreatedBy"`
+}
+
+// trivySecret holds the fields of secrets in trivy JSON reports. The matched
+// value is deliberately not read so that it cannot end up in the report.
+type trivySecret struct {
+	RuleID    string     `json:"RuleID"`
+	Category  string     `json:"Category"`
+	Severity  string     `json:"Severity"`
+	Title     string     `json:"Title"`
+	StartLine int        `json:"StartLine"`
+	EndLine   int        `json:"EndLine"`
+	Layer     trivyLayer `json:"Layer"`
+}
+
+// trivyMisconfiguration holds the fields of misconfigurations in trivy
+// JSON reports.
+type trivyMisconfiguration struct {
+	ID            string `json:"ID"`
+	Title         string `json:"Title"`
+	Message       string `json:"Message"`
+	Resolution    string `json:"Resolution"`
+	Severity      string `json:"Severity"`
+	Status        string `json:"Status"`
+	CauseMetadata struct {
+		StartLine int `json:"StartLine"`
+		EndLine   int `json:"EndLine"`
+	} `json:"CauseMetadata"`
+	Layer trivyLayer `json:"Layer"`
+}
+
+// trivyContentReport is a trivy JSON report of a secret and misconfiguration
+// scan.
+type trivyContentReport struct {
+	Results []struct {
+		Target            string                  `json:"Target"`
+		Secrets           []trivySecret           `json:"Secrets"`
+		Misconfigurations []trivyMisconfiguration `json:"Misconfigurations"`
+	} `json:"Results"`
+}
+
+// trivySecretRule is a custom rule of the trivy secret scanner.
+type trivySecretRule struct {
+	ID       string `json:"id"`
+	Category string `json:"category"`
+	Title    string `json:"title"`
+	Severity string `json:"severity"`
+	Regex    string `json:"regex"`
+}
+
+// trivySecretConfig is a trivy secret config. Custom rules are used in
+// addition to the built-in rules of trivy.
+type trivySecretConfig struct {
+	Rules []trivySecretRule `json:"rules"`
+}
+
+// contentFinding is a secret or misconfiguration found in a file of the
+// image.
+type contentFinding struct {
+	Kind       string `json:"kind"`
+	ID         string `json:"id"`
+	Title      string `json:"title"`
+	Severity   string `json:"severity"`
+	File       string `json:"file"`
+	StartLine  int    `json:"startLine,omitempty"`
+	EndLine    int    `json:"endLine,omitempty"`
+	Message    string `json:"message,omitempty"`
+	Resolution string `json:"resolution,omitempty"`
+	// Blocking is whether the finding fails the task.
+	Blocking bool `json:"blocking"`
+}
+
+func (f contentFinding) String() string {
+	location := f.File
+	if f.StartLine > 0 {
+		location = fmt.Sprintf("%s:%d", location, f.StartLine)
+	}
+	return fmt.Sprintf("%s: %s (%s %s, %s)", location, f.Title, f.Kind, f.ID, f.Severity)
+}
+
+// layerFindings are the findings in the files of one layer, together with
+// the Dockerfile instruction which created the layer.
+type layerFindings struct {
+	// Layer is the 1-based index of the layer, 0 if the layer is unknown.
+	Layer     int              `json:"layer"`
+	Digest    string           `json:"digest,omitempty"`
+	DiffID    string           `json:"diffID,omitempty"`
+	CreatedBy string           `json:"createdBy,omitempty"`
+	Findings  []contentFinding `json:"findings"`
+}
+
+func (l layerFindings) String() string {
+	if l.Layer == 0 {
+		return "unknown layer"
+	}
+	if l.CreatedBy == "" {
+		return fmt.Sprintf("layer %d (%s)", l.Layer, l.Digest)
+	}
+	return fmt.Sprintf("layer %d (%s, created by %q)", l.Layer, l.Digest, l.CreatedBy)
+}
+
+// contentScanReport is the content scan report artifact.
+type contentScanReport struct {
+	Image    string          `json:"image"`
+	Scanners []string        `json:"scanners"`
+	Layers   []layerFindings `json:"layers"`
+}
+
+// parseContentScanners parses the comma separated content scanners. The
+// secret scanner is not accepted as it is enabled by the secret scan mode.
+func parseContentScanners(s string) ([]string, error) {
+	var scanners []string
+	for _, scanner := range strings.Split(s, ",") {
+		scanner = strings.TrimSpace(scanner)
+		switch scanner {
+		case "":
+			continue
+		case contentScannerMisconfig:
+			scanners = append(scanners, scanner)
+		case contentScannerSecret:
+			return nil, fmt.Errorf("content scanner %q is enabled by setting secret-scan to %q", scanner, secretScanLayers)
+		default:
+			return nil, fmt.Errorf("unknown content scanner %q, must be %q", scanner, contentScannerMisconfig)
+		}
+	}
+	return scanners, nil
+}
+
+// contentScanners returns the trivy scanners to scan the files of the image
+// with: the secret scanner if the files in the layers shall be scanned for
+// secrets, and the scanners given by the content scanners option.
+func (p *packageImage) contentScanners() ([]string, error) {
+	scanners, err := parseContentScanners(p.opts.contentScanners)
+	if err != nil {
+		return nil, err
+	}
+	if p.opts.secretScan == secretScanLayers {
+		scanners = append([]string{contentScannerSecret}, scanners...)
+	}
+	return scanners, nil
+}
+
+// newTrivySecretConfig returns a trivy secret config with a rule for each of
+// the secret values of m, so that trivy finds them in the files of the image
+// in addition to the credentials matched by its built-in rules.
+func newTrivySecretConfig(m secretMatcher) trivySecretConfig {
+	values := make([]string, 0, len(m.values))
+	for value := range m.values {
+		values = append(values, value)
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if m.values[values[i]] == m.values[values[j]] {
+			return values[i] < values[j]
+		}
+		return m.values[values[i]] < m.values[values[j]]
+	})
+	var c trivySecretConfig
+	for i, value := range values {
+		c.Rules = append(c.Rules, trivySecretRule{
+			ID:       fmt.Sprintf("secret-value-%d", i+1),
+			Category: "SecretValue",
+			Title:    m.values[value],
+			Severity: "CRITICAL",
+			Regex:    regexp.QuoteMeta(value),
+		})
+	}
+	return c
+}
+
+// groupContentFindings groups the findings of the trivy report by the layer
+// of the image they were found in, in layer order. Secrets with a severity
+// in failSeverities are marked as blocking. Secrets in the instructions which
+// created the layers are masked with m.
+func groupContentFindings(report *trivyContentReport, manifest *oci.Manifest, config *oci.ImageConfig, m secretMatcher, failSeverities map[string]bool) []layerFindings {
+	history := oci.LayerHistory(config, len(manifest.Layers))
+	groups := map[int]*layerFindings{}
+	add := func(layer trivyLayer, f contentFinding) {
+		i := layerIndex(layer, manifest, config)
+		g, ok := groups[i]
+		if !ok {
+			g = &layerFindings{Layer: i, Digest: layer.Digest, DiffID: layer.DiffID, CreatedBy: m.mask(layer.CreatedBy)}
+			if i > 0 {
+				g.Digest = manifest.Layers[i-1].Digest
+				g.CreatedBy = m.mask(history[i-1].CreatedBy)
+				if i <= len(config.RootFS.DiffIDs) {
+					g.DiffID = config.RootFS.DiffIDs[i-1]
+				}
+			}
+			groups[i] = g
+		}
+		g.Findings = append(g.Findings, f)
+	}
+	for _, r := range report.Results {
+		file := "/" + strings.TrimPrefix(r.Target, "/")
+		for _, s := range r.Secrets {
+			add(s.Layer, contentFinding{
+				Kind:      contentFindingSecret,
+				ID:        s.RuleID,
+				Title:     s.Title,
+				Severity:  s.Severity,
+				File:      file,
+				StartLine: s.StartLine,
+				EndLine:   s.EndLine,
+				Blocking:  failSeverities[s.Severity],
+			})
+		}
+		for _, mc := range r.Misconfigurations {
+			if mc.Status != "" && mc.Status != "FAIL" {
+				continue
+			}
+			add(mc.Layer, contentFinding{
+				Kind:       contentFindingMisconfiguration,
+				ID:         mc.ID,
+				Title:      mc.Title,
+				Severity:   mc.Severity,
+				File:       file,
+				StartLine:  mc.CauseMetadata.StartLine,
+				EndLine:    mc.CauseMetadata.EndLine,
+				Message:    mc.Message,
+				Resolution: mc.Resolution,
+			})
+		}
+	}
+	indexes := make([]int, 0, len(groups))
+	for i := range groups {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	layers := make([]layerFindings, len(indexes))
+	for j, i := range indexes {
+		layers[j] = *groups[i]
+	}
+	return layers
+}
+
+// layerIndex returns the 1-based index of the given layer in the image, or
+// 0 if it is not part of the image.
+func layerIndex(layer trivyLayer, manifest *oci.Manifest, config *oci.ImageConfig) int {
+	for i, diffID := range config.RootFS.DiffIDs {
+		if layer.DiffID != "" && diffID == layer.DiffID && i < len(manifest.Layers) {
+			return i + 1
+		}
+	}
+	for i, l := range manifest.Layers {
+		if layer.Digest != "" && l.Digest == layer.Digest {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// blockingContentFindings returns a description of each blocking finding.
+func blockingContentFindings(layers []layerFindings) []string {
+	var lines []string
+	for _, l := range layers {
+		for _, f := range l.Findings {
+			if f.Blocking {
+				lines = append(lines, fmt.Sprintf("- %s in %s", f, l))
+			}
+		}
+	}
+	return lines
+}
+
+// scanImageContent scans the files of the image in the local OCI layout with
+// the given trivy scanners for secrets and misconfigurations, writes the
+// findings grouped by layer as artifact and fails if blocking secrets have
+// been found. The secret scanner looks for the values of secret-bearing build
+// args as well.
+func (p *packageImage) scanImageContent(scanners []string) error {
+	values := map[string]string{}
+	var secretConfig string
+	if slices.Contains(scanners, contentScannerSecret) {
+		v, err := p.secretBuildArgs()
+		if err != nil {
+			return fmt.Errorf("determine secret build args: %w", err)
+		}
+		values = v
+	}
+	m := newSecretMatcher(values)
+	if len(m.values) > 0 {
+		b, err := json.Marshal(newTrivySecretConfig(m))
+		if err != nil {
+			return err
+		}
+		// JSON is valid YAML, which trivy expects.
+		secretConfig = filepath.Join(trivyWorkdir, fmt.Sprintf("%s-secret.yaml", p.imageNameNoSha()))
+		if err := os.WriteFile(secretConfig, b, 0600); err != nil {
+			return fmt.Errorf("write trivy secret config: %w", err)
+		}
+		defer os.Remove(secretConfig)
+	}
+	failSeverities := map[string]bool{}
+	for _, severity := range strings.Split(p.opts.contentScanFailSeverities, ",") {
+		failSeverities[strings.ToUpper(strings.TrimSpace(severity))] = true
+	}
+	trivyReport := filepath.Join(trivyWorkdir, fmt.Sprintf("%s-content.json", p.imageNameNoSha()))
+	if err := p.runTrivyContentScan(scanners, secretConfig, trivyReport); err != nil {
+		return fmt.Errorf("trivy content scan: %w", err)
+	}
+	b, err := os.ReadFile(trivyReport)
+	if err != nil {
+		return fmt.Errorf("read trivy report: %w", err)
+	}
+	var tr trivyContentReport
+	if err := json.Unmarshal(b, &tr); err != nil {
+		return fmt.Errorf("parse trivy report: %w", err)
+	}
+	l, err := p.openOCILayout()
+	if err != nil {
+		return err
+	}
+	manifest, _, err := l.Manifest(p.imageId.GitCommitSHA)
+	if err != nil {
+		return err
+	}
+	config, err := l.Config(manifest)
+	if err != nil {
+		return err
+	}
+	layers := groupContentFindings(&tr, manifest, config, m, failSeverities)
+	report := contentScanReport{Image: p.imageName(), Scanners: scanners, Layers: layers}
+	if err := pipelinectxt.WriteJsonArtifact(report, filepath.Join(p.opts.checkoutDir, contentScanReportsPath), fmt.Sprintf("%s.json", p.imageNameNoSha())); err != nil {
+		return err
+	}
+	for _, l := range layers {
+		p.logger.Infof("Findings in %s:", l)
+		for _, f := range l.Findings {
+			if f.Kind == contentFindingSecret {
+				p.logger.Warnf("- %s", f)
+			} else {
+				p.logger.Infof("- %s", f)
+			}
+		}
+	}
+	if lines := blockingContentFindings(layers); len(lines) > 0 {
+		return fmt.Errorf("image contains secrets:\n%s", strings.Join(lines, "\n"))
+	}
+	if len(layers) == 0 {
+		p.logger.Infof("No findings in image %s", p.imageName())
+	}
+	return nil
+}
+
+// runTrivyContentScan scans the files of the image in the local OCI layout
+// with the given trivy scanners and writes the trivy JSON report to output.
+// If secretConfig is not empty, the secret scanner uses its custom rules.
+func (p *packageImage) runTrivyContentScan(scanners []string, secretConfig, output string) error {
+	extraArgs, err := shlex.Split(p.opts.trivyContentExtraArgs)
+	if err != nil {
+		return fmt.Errorf("parse extra args (%s): %w", p.opts.trivyContentExtraArgs, err)
+	}
+	input, err := p.trivyInput()
+	if err != nil {
+		return err
+	}
+	args := []string{
+		"image",
+		"--format=json",
+		fmt.Sprintf("--scanners=%s", strings.Join(scanners, ",")),
+		fmt.Sprintf("--input=%s", input),
+		fmt.Sprintf("--output=%s", output),
+	}
+	dbArgs, err := p.trivyDBArgs()
+	if err != nil {
+		return err
+	}
+	args = append(args, dbArgs...)
+	if p.opts.trivySkipDBUpdate {
+		// Use the misconfiguration checks built into trivy.
+		args = append(args, "--skip-policy-update")
+	}
+	if secretConfig != "" {
+		args = append(args, fmt.Sprintf("--secret-config=%s", secretConfig))
+	}
+	if p.opts.debug {
+		args = append(args, "--debug=true")
+	}
+	args = append(args, extraArgs...)
+	return p.runTrivy(args, os.Stdout, os.Stderr)
+}
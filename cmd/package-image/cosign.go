@@ -3,17 +3,32 @@ package main
 import (
 	"bytes"
 	"fmt"
+	"os"
 	"os/exec"
 	"strings"
 )
 
+// defaultCertDirs are the directories in which Go looks for system
+// certificates on Linux if SSL_CERT_DIR is not set.
+var defaultCertDirs = []string{"/etc/ssl/certs", "/etc/pki/tls/certs"}
+
 type CosignClient struct {
 	exe string
 	key string
+	// ra is how registries other than the KinD registry are accessed.
+	ra registryAccess
 }
 
 func NewCosignClient(key string) *CosignClient {
-	return &CosignClient{exe: "cosign", key: key}
+	return &CosignClient{exe: "cosign", key: key, ra: registryAccess{tlsVerify: true}}
+}
+
+// WithRegistryAccess returns a copy of the client which accesses registries
+// with the TLS settings of ra.
+func (c *CosignClient) WithRegistryAccess(ra registryAccess) *CosignClient {
+	cc := *c
+	cc.ra = ra
+	return &cc
 }
 
 func (c *CosignClient) Sign(imageRef string) error {
@@ -26,16 +41,87 @@ func (c *CosignClient) Attest(imageRef, aType, aPredicate string) error {
 	return c.runCmd(append(args, "--type", aType, "--predicate", aPredicate, imageRef)...)
 }
 
+// Copy copies the image srcRef together with its signatures, attestations
+// and SBOMs to dstRef.
+func (c *CosignClient) Copy(srcRef, dstRef string) error {
+	args := []string{"copy", "--force"}
+	args = append(args, c.registryArgs(srcRef, dstRef)...)
+	return c.runCmd(append(args, srcRef, dstRef)...)
+}
+
+// Save saves the image imageRef together with its signatures, attestations
+// and SBOMs as OCI layout into dir.
+func (c *CosignClient) Save(imageRef, dir string) error {
+	args := []string{"save", "--dir", dir}
+	args = append(args, c.registryArgs(imageRef)...)
+	return c.runCmd(append(args, imageRef)...)
+}
+
+// Load pushes the image saved as OCI layout in dir together with its
+// signatures, attestations and SBOMs to imageRef.
+func (c *CosignClient) Load(dir, imageRef string) error {
+	args := []string{"load", "--dir", dir}
+	args = append(args, c.registryArgs(imageRef)...)
+	return c.runCmd(append(args, imageRef)...)
+}
+
+// Verify verifies the signature of imageRef against the public key of the
+// client. As images are signed without transparency log upload, the
+// transparency log is not checked.
+func (c *CosignClient) Verify(imageRef string) error {
+	args := []string{"verify", "--key", c.key, "--insecure-ignore-tlog=true"}
+	args = append(args, c.registryArgs(imageRef)...)
+	return c.runCmd(append(args, imageRef)...)
+}
+
+// DownloadAttestations returns the attestations of imageRef with given
+// predicate type, one DSSE envelope per line.
+func (c *CosignClient) DownloadAttestations(imageRef, predicateType string) ([]byte, error) {
+	args := []string{"download", "attestation", "--predicate-type", predicateType}
+	args = append(args, c.registryArgs(imageRef)...)
+	return c.output(append(args, imageRef)...)
+}
+
 func (c *CosignClient) commonArgs(imageRef string) []string {
 	args := []string{"--tlog-upload=false", "--key", c.key}
-	if strings.HasPrefix(imageRef, kindRegistry) {
-		args = append(args, "--allow-insecure-registry=true", "--allow-http-registry=true")
-	}
+	args = append(args, c.registryArgs(imageRef)...)
 	return args
 }
 
+// registryArgs returns the args of cosign to access the registries of refs.
+func (c *CosignClient) registryArgs(refs ...string) []string {
+	for _, ref := range refs {
+		if strings.HasPrefix(ref, kindRegistry) {
+			return insecureRegistryArgs()
+		}
+	}
+	if !c.ra.tlsVerify {
+		return []string{"--allow-insecure-registry=true"}
+	}
+	return nil
+}
+
+func insecureRegistryArgs() []string {
+	return []string{"--allow-insecure-registry=true", "--allow-http-registry=true"}
+}
+
+// env returns the environment of cosign. The certificates in the cert dir
+// are trusted in addition to the system certificates, like skopeo does.
+// It returns nil to inherit the environment unchanged.
+func (c *CosignClient) env() []string {
+	if !c.ra.tlsVerify || c.ra.certDir == "" {
+		return nil
+	}
+	dirs := append([]string{c.ra.certDir}, defaultCertDirs...)
+	if d := os.Getenv("SSL_CERT_DIR"); d != "" {
+		dirs = []string{c.ra.certDir, d}
+	}
+	return append(os.Environ(), "SSL_CERT_DIR="+strings.Join(dirs, ":"))
+}
+
 func (c *CosignClient) runCmd(args ...string) error {
 	cmd := exec.Command(c.exe, args...)
+	cmd.Env = c.env()
 	buf := new(bytes.Buffer)
 	cmd.Stderr = buf
 	err := cmd.Run()
@@ -44,3 +130,16 @@ func (c *CosignClient) runCmd(args ...string) error {
 	}
 	return nil
 }
+
+// output runs cosign and returns its stdout.
+func (c *CosignClient) output(args ...string) ([]byte, error) {
+	cmd := exec.Command(c.exe, args...)
+	cmd.Env = c.env()
+	buf := new(bytes.Buffer)
+	cmd.Stderr = buf
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("cosign cmd: %s - %s", err, buf.String())
+	}
+	return out, nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCosignRegistryArgs(t *testing.T) {
+	tests := map[string]struct {
+		ra   registryAccess
+		refs []string
+		want []string
+	}{
+		"verified": {
+			ra:   registryAccess{tlsVerify: true, certDir: "/etc/certs"},
+			refs: []string{"registry.example.com/foo/bar:1.0"},
+		},
+		"not verified": {
+			ra:   registryAccess{tlsVerify: false},
+			refs: []string{"registry.example.com/foo/bar:1.0"},
+			want: []string{"--allow-insecure-registry=true"},
+		},
+		"kind registry": {
+			ra:   registryAccess{tlsVerify: true},
+			refs: []string{"registry.example.com/foo/bar:1.0", kindRegistry + "/foo/bar:1.0"},
+			want: []string{"--allow-insecure-registry=true", "--allow-http-registry=true"},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := NewCosignClient("").WithRegistryAccess(tc.ra)
+			if diff := cmp.Diff(tc.want, c.registryArgs(tc.refs...)); diff != "" {
+				t.Fatalf("args mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCosignEnv(t *testing.T) {
+	t.Setenv("SSL_CERT_DIR", "")
+	if env := NewCosignClient("").env(); env != nil {
+		t.Fatalf("want inherited environment, got %v", env)
+	}
+	c := NewCosignClient("").WithRegistryAccess(registryAccess{tlsVerify: true, certDir: "/etc/certs"})
+	env := c.env()
+	if got := env[len(env)-1]; got != "SSL_CERT_DIR=/etc/certs:/etc/ssl/certs:/etc/pki/tls/certs" {
+		t.Fatalf("unexpected cert dirs %s", got)
+	}
+	t.Setenv("SSL_CERT_DIR", "/custom/certs")
+	env = c.env()
+	if got := env[len(env)-1]; got != "SSL_CERT_DIR=/etc/certs:/custom/certs" {
+		t.Fatalf("unexpected cert dirs %s", got)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+)
+
+const (
+	// digestMismatchFail fails the task if the pushed digest differs from
+	// the digest of the local build.
+	digestMismatchFail = "fail"
+	// digestMismatchRecord records the pushed digest if it differs from
+	// the digest of the local build.
+	digestMismatchRecord = "record"
+)
+
+// validateDigestMismatchPolicy fails if policy is not a known digest
+// mismatch policy.
+func validateDigestMismatchPolicy(policy string) error {
+	switch policy {
+	case digestMismatchFail, digestMismatchRecord:
+		return nil
+	default:
+		return fmt.Errorf("unknown digest mismatch policy %q, must be one of %q or %q", policy, digestMismatchFail, digestMismatchRecord)
+	}
+}
+
+// reconcilePushedDigest compares the digest of the local build with the
+// digest resolved from the registry after the push and returns the digest
+// which should be recorded, depending on policy.
+func reconcilePushedDigest(localDigest, pushedDigest, policy string) (string, error) {
+	if pushedDigest == "" {
+		return "", fmt.Errorf("could not resolve digest of pushed image")
+	}
+	if localDigest == pushedDigest {
+		return localDigest, nil
+	}
+	switch policy {
+	case digestMismatchFail:
+		return "", fmt.Errorf(
+			"digest of pushed image (%s) does not match digest of local build (%s). "+
+				"This happens when the registry stores the image in a different format or compression. "+
+				"Set on-digest-mismatch=%s to record the pushed digest instead",
+			pushedDigest, localDigest, digestMismatchRecord,
+		)
+	case digestMismatchRecord:
+		return pushedDigest, nil
+	default:
+		return "", validateDigestMismatchPolicy(policy)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestReconcilePushedDigest(t *testing.T) {
+	tests := map[string]struct {
+		local      string
+		pushed     string
+		policy     string
+		wantDigest string
+		wantErr    bool
+	}{
+		"matching digests": {
+			local:      "sha256:aaa",
+			pushed:     "sha256:aaa",
+			policy:     digestMismatchFail,
+			wantDigest: "sha256:aaa",
+		},
+		"mismatch with fail policy": {
+			local:   "sha256:aaa",
+			pushed:  "sha256:bbb",
+			policy:  digestMismatchFail,
+			wantErr: true,
+		},
+		"mismatch with record policy": {
+			local:      "sha256:aaa",
+			pushed:     "sha256:bbb",
+			policy:     digestMismatchRecord,
+			wantDigest: "sha256:bbb",
+		},
+		"mismatch with unknown policy": {
+			local:   "sha256:aaa",
+			pushed:  "sha256:bbb",
+			policy:  "ignore",
+			wantErr: true,
+		},
+		"unresolved pushed digest": {
+			local:   "sha256:aaa",
+			pushed:  "",
+			policy:  digestMismatchRecord,
+			wantErr: true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := reconcilePushedDigest(tc.local, tc.pushed, tc.policy)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("want error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.wantDigest {
+				t.Fatalf("want digest %q, got %q", tc.wantDigest, got)
+			}
+		})
+	}
+}
+
+func TestValidateDigestMismatchPolicy(t *testing.T) {
+	for _, policy := range []string{digestMismatchFail, digestMismatchRecord} {
+		if err := validateDigestMismatchPolicy(policy); err != nil {
+			t.Fatalf("want no error for %q, got %s", policy, err)
+		}
+	}
+	for _, policy := range []string{"", "ignore", "Fail"} {
+		if err := validateDigestMismatchPolicy(policy); err == nil {
+			t.Fatalf("want error for %q, got none", policy)
+		}
+	}
+}
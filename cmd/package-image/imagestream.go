@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/opendevstack/ods-pipeline/pkg/pipelinectxt"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+)
+
+const annotationPrefix = "pipeline.opendevstack.org/"
+
+var (
+	imageStreamsResource = schema.GroupVersionResource{
+		Group: "image.openshift.io", Version: "v1", Resource: "imagestreams",
+	}
+	imageStreamTagsResource = schema.GroupVersionResource{
+		Group: "image.openshift.io", Version: "v1", Resource: "imagestreamtags",
+	}
+)
+
+// imageStreamUpdater creates or updates OpenShift ImageStreams and
+// ImageStreamTags for pushed images.
+type imageStreamUpdater struct {
+	client dynamic.Interface
+}
+
+// newInClusterImageStreamUpdater returns an imageStreamUpdater which
+// authenticates with the service account of the pod.
+func newInClusterImageStreamUpdater() (*imageStreamUpdater, error) {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, fmt.Errorf("in-cluster config: %w", err)
+	}
+	client, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("create client: %w", err)
+	}
+	return &imageStreamUpdater{client: client}, nil
+}
+
+// imageStreamTagSpec describes the desired state of an ImageStreamTag.
+type imageStreamTagSpec struct {
+	namespace   string
+	imageStream string
+	tag         string
+	// from references the image, either as ImageStreamImage (stream@digest)
+	// or as DockerImage (registry/namespace/stream@digest).
+	fromKind    string
+	fromName    string
+	annotations map[string]string
+}
+
+// imageStreamTagSpecForTag returns the desired state of the ImageStreamTag of
+// the pushed image for given tag.
+func (p *packageImage) imageStreamTagSpecForTag(tag string) imageStreamTagSpec {
+	spec := imageStreamTagSpec{
+		namespace:   p.imageId.ImageNamespace,
+		imageStream: p.imageId.ImageStream,
+		tag:         tag,
+		annotations: p.imageStreamAnnotations(),
+	}
+	if p.opts.registry == defaultOptions.registry {
+		spec.fromKind = "ImageStreamImage"
+		spec.fromName = fmt.Sprintf("%s@%s", p.imageId.ImageStream, p.imageDigest)
+	} else {
+		spec.fromKind = "DockerImage"
+		spec.fromName = imageRef(p.artifactImage())
+	}
+	return spec
+}
+
+// imageStreamAnnotations returns the build metadata to set on ImageStreamTags.
+func (p *packageImage) imageStreamAnnotations() map[string]string {
+	sbom := "none"
+	if p.sbomFile != "" {
+		sbom = pipelinectxt.SBOMsFormat
+	}
+	signed := p.opts.cosignKey != ""
+	return map[string]string{
+		annotationPrefix + "git-url":        p.ctxt.GitURL,
+		annotationPrefix + "git-ref":        p.ctxt.GitRef,
+		annotationPrefix + "git-commit-sha": p.ctxt.GitCommitSHA,
+		annotationPrefix + "image-digest":   p.imageDigest,
+		annotationPrefix + "sbom":           sbom,
+		annotationPrefix + "sbom-attested":  fmt.Sprintf("%v", signed && p.sbomFile != ""),
+		annotationPrefix + "signed":         fmt.Sprintf("%v", signed),
+	}
+}
+
+// applyImageStreamTag creates or updates the ImageStreamTag of the pushed
+// image for given tag.
+func (p *packageImage) applyImageStreamTag(tag string) error {
+	if p.imageStreams == nil {
+		u, err := newInClusterImageStreamUpdater()
+		if err != nil {
+			return fmt.Errorf("image stream client: %w", err)
+		}
+		p.imageStreams = u
+	}
+	return p.imageStreams.applyImageStreamTag(context.Background(), p.imageStreamTagSpecForTag(tag))
+}
+
+// ensureImageStream creates the ImageStream if it does not exist yet.
+func (u *imageStreamUpdater) ensureImageStream(ctx context.Context, namespace, name string) error {
+	c := u.client.Resource(imageStreamsResource).Namespace(namespace)
+	_, err := c.Get(ctx, name, metav1.GetOptions{})
+	if err == nil {
+		return nil
+	}
+	if !k8serrors.IsNotFound(err) {
+		return fmt.Errorf("get image stream %s: %w", name, err)
+	}
+	is := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "image.openshift.io/v1",
+		"kind":       "ImageStream",
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": namespace,
+		},
+	}}
+	_, err = c.Create(ctx, is, metav1.CreateOptions{})
+	if err != nil && !k8serrors.IsAlreadyExists(err) {
+		return fmt.Errorf("create image stream %s: %w", name, err)
+	}
+	return nil
+}
+
+// applyImageStreamTag creates or updates the ImageStreamTag described by spec.
+// Existing annotations which are not managed by this task are retained.
+func (u *imageStreamUpdater) applyImageStreamTag(ctx context.Context, spec imageStreamTagSpec) error {
+	if err := u.ensureImageStream(ctx, spec.namespace, spec.imageStream); err != nil {
+		return err
+	}
+	c := u.client.Resource(imageStreamTagsResource).Namespace(spec.namespace)
+	name := fmt.Sprintf("%s:%s", spec.imageStream, spec.tag)
+	ist, err := c.Get(ctx, name, metav1.GetOptions{})
+	exists := true
+	if err != nil {
+		if !k8serrors.IsNotFound(err) {
+			return fmt.Errorf("get image stream tag %s: %w", name, err)
+		}
+		exists = false
+		ist = &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "image.openshift.io/v1",
+			"kind":       "ImageStreamTag",
+			"metadata": map[string]interface{}{
+				"name":      name,
+				"namespace": spec.namespace,
+			},
+		}}
+	}
+	annotations := ist.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	tagAnnotations := map[string]interface{}{}
+	for k, v := range spec.annotations {
+		annotations[k] = v
+		tagAnnotations[k] = v
+	}
+	ist.SetAnnotations(annotations)
+	tag := map[string]interface{}{
+		"name":        spec.tag,
+		"annotations": tagAnnotations,
+		"from": map[string]interface{}{
+			"kind": spec.fromKind,
+			"name": spec.fromName,
+		},
+		"referencePolicy": map[string]interface{}{
+			"type": "Source",
+		},
+	}
+	if spec.fromKind == "ImageStreamImage" {
+		tag["from"].(map[string]interface{})["namespace"] = spec.namespace
+	}
+	if err := unstructured.SetNestedMap(ist.Object, tag, "tag"); err != nil {
+		return fmt.Errorf("set tag of image stream tag %s: %w", name, err)
+	}
+	if exists {
+		_, err = c.Update(ctx, ist, metav1.UpdateOptions{})
+	} else {
+		_, err = c.Create(ctx, ist, metav1.CreateOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("apply image stream tag %s: %w", name, err)
+	}
+	return nil
+}
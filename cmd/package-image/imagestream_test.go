@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic/fake"
+)
+
+func TestApplyImageStreamTag(t *testing.T) {
+	existingTag := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "image.openshift.io/v1",
+		"kind":       "ImageStreamTag",
+		"metadata": map[string]interface{}{
+			"name":        "bar:latest",
+			"namespace":   "foo-dev",
+			"annotations": map[string]interface{}{"unrelated": "value"},
+		},
+	}}
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme(), existingTag)
+	u := &imageStreamUpdater{client: client}
+	ctx := context.Background()
+
+	for _, tag := range []string{"abc", "latest"} {
+		err := u.applyImageStreamTag(ctx, imageStreamTagSpec{
+			namespace:   "foo-dev",
+			imageStream: "bar",
+			tag:         tag,
+			fromKind:    "ImageStreamImage",
+			fromName:    "bar@sha256:123",
+			annotations: map[string]string{annotationPrefix + "git-commit-sha": "abc"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := client.Resource(imageStreamsResource).Namespace("foo-dev").Get(ctx, "bar", metav1.GetOptions{}); err != nil {
+		t.Fatalf("want image stream to be created: %s", err)
+	}
+	for name, wantAnnotations := range map[string]map[string]string{
+		"bar:abc":    {annotationPrefix + "git-commit-sha": "abc"},
+		"bar:latest": {annotationPrefix + "git-commit-sha": "abc", "unrelated": "value"},
+	} {
+		ist, err := client.Resource(imageStreamTagsResource).Namespace("foo-dev").Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(wantAnnotations, ist.GetAnnotations()); diff != "" {
+			t.Fatalf("annotations of %s mismatch (-want +got):\n%s", name, diff)
+		}
+		from, _, err := unstructured.NestedStringMap(ist.Object, "tag", "from")
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantFrom := map[string]string{"kind": "ImageStreamImage", "name": "bar@sha256:123", "namespace": "foo-dev"}
+		if diff := cmp.Diff(wantFrom, from); diff != "" {
+			t.Fatalf("tag.from of %s mismatch (-want +got):\n%s", name, diff)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// junitTestSuite is a JUnit XML test suite as understood by ODS pipeline.
+type junitTestSuite struct {
+	XMLName   xml.Name        `xml:"testsuite"`
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// addTestCase adds a test case to the suite. A non-empty failure message
+// marks the test case as failed.
+func (s *junitTestSuite) addTestCase(name, failure string) {
+	tc := junitTestCase{Name: name, ClassName: s.Name}
+	if failure != "" {
+		tc.Failure = &junitFailure{Message: failure, Text: failure}
+		s.Failures++
+	}
+	s.Tests++
+	s.TestCases = append(s.TestCases, tc)
+}
+
+// write writes the test suite as XML into dir/filename.
+func (s *junitTestSuite) write(dir, filename string) error {
+	out, err := xml.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal JUnit report: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("create %s: %w", dir, err)
+	}
+	return os.WriteFile(filepath.Join(dir, filename), append([]byte(xml.Header), out...), 0644)
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/opendevstack/ods-pipeline-image/internal/spdx"
+	"github.com/opendevstack/ods-pipeline/pkg/pipelinectxt"
+	"sigs.k8s.io/yaml"
+)
+
+// licenseReportsPath is the artifacts path of license policy reports.
+const licenseReportsPath = pipelinectxt.ArtifactsPath + "/license-reports"
+
+const (
+	licenseActionFail = "fail"
+	licenseActionWarn = "warn"
+)
+
+// Status of a package in the license report.
+const (
+	licenseStatusAllowed   = "allowed"
+	licenseStatusExcepted  = "excepted"
+	licenseStatusViolation = "violation"
+	licenseStatusUnknown   = "unknown"
+)
+
+// licensePolicy describes which licenses the packages of the image may have.
+// Licenses are SPDX identifiers, a trailing "*" matches any suffix (e.g.
+// "AGPL-*").
+type licensePolicy struct {
+	// Allow lists the allowed licenses. If set, all other licenses violate
+	// the policy.
+	Allow []string `json:"allow"`
+	// Deny lists licenses which violate the policy.
+	Deny []string `json:"deny"`
+	// DenyUnknown makes packages without license information violate the
+	// policy.
+	DenyUnknown bool `json:"denyUnknown"`
+	// Exceptions exempt packages from the policy.
+	Exceptions []licenseException `json:"exceptions"`
+	// Action is what happens on violations, fail (default) or warn.
+	Action string `json:"action"`
+}
+
+// licenseException exempts a package from the policy.
+type licenseException struct {
+	// Package is the name or a package URL prefix (e.g.
+	// "pkg:maven/org.mongodb/") of the packages to exempt.
+	Package string `json:"package"`
+	// Licenses to exempt the package from. If empty, all licenses are
+	// exempt.
+	Licenses []string `json:"licenses"`
+	// Reason is recorded in the report.
+	Reason string `json:"reason"`
+}
+
+// licenseResult is the outcome of checking one package.
+type licenseResult struct {
+	Name             string   `json:"name"`
+	Version          string   `json:"version,omitempty"`
+	PURL             string   `json:"purl,omitempty"`
+	LicenseConcluded string   `json:"licenseConcluded,omitempty"`
+	LicenseDeclared  string   `json:"licenseDeclared,omitempty"`
+	Licenses         []string `json:"licenses,omitempty"`
+	Status           string   `json:"status"`
+	Violations       []string `json:"violations,omitempty"`
+	Exception        string   `json:"exception,omitempty"`
+}
+
+// licenseReport is written as JSON artifact.
+type licenseReport struct {
+	Image      string          `json:"image"`
+	Digest     string          `json:"digest"`
+	Violations int             `json:"violations"`
+	Packages   []licenseResult `json:"packages"`
+}
+
+func readLicensePolicy(filename string) (*licensePolicy, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("read license policy: %w", err)
+	}
+	var lp licensePolicy
+	if err := yaml.UnmarshalStrict(b, &lp); err != nil {
+		return nil, fmt.Errorf("parse license policy %s: %w", filename, err)
+	}
+	if lp.Action == "" {
+		lp.Action = licenseActionFail
+	}
+	if lp.Action != licenseActionFail && lp.Action != licenseActionWarn {
+		return nil, fmt.Errorf("invalid action %q of license policy %s, must be %s or %s", lp.Action, filename, licenseActionFail, licenseActionWarn)
+	}
+	for _, e := range lp.Exceptions {
+		if e.Package == "" {
+			return nil, fmt.Errorf("exception of license policy %s does not name a package", filename)
+		}
+	}
+	return &lp, nil
+}
+
+// evaluate checks the licenses of the packages of doc against the policy.
+func (lp *licensePolicy) evaluate(doc *spdx.Document) []licenseResult {
+	var results []licenseResult
+	for _, pkg := range sbomPackages(doc) {
+		r := licenseResult{
+			Name:             pkg.Name,
+			Version:          pkg.Version,
+			PURL:             pkg.PURL,
+			LicenseConcluded: pkg.LicenseConcluded,
+			LicenseDeclared:  pkg.LicenseDeclared,
+			Status:           licenseStatusAllowed,
+		}
+		expr := pkg.License()
+		if expr == "" {
+			r.Status = licenseStatusUnknown
+			if lp.DenyUnknown {
+				if e := lp.exception(pkg, ""); e != nil {
+					r.Status, r.Exception = licenseStatusExcepted, e.Reason
+				} else {
+					r.Status, r.Violations = licenseStatusViolation, []string{"unknown license"}
+				}
+			}
+			results = append(results, r)
+			continue
+		}
+		e, err := spdx.ParseLicenseExpression(expr, doc.OtherLicenses)
+		if err != nil {
+			// Check malformed expressions as a single license.
+			e = &spdx.LicenseExpression{License: spdx.NormalizeLicense(expr)}
+		}
+		r.Licenses = e.Licenses()
+		violations := e.Violations(lp.violates)
+		if len(violations) > 0 {
+			remaining := e.Violations(func(license string) bool {
+				return lp.violates(license) && lp.exception(pkg, license) == nil
+			})
+			if len(remaining) > 0 {
+				r.Status, r.Violations = licenseStatusViolation, remaining
+			} else {
+				r.Status = licenseStatusExcepted
+				for _, v := range violations {
+					if ex := lp.exception(pkg, v); ex != nil {
+						r.Exception = ex.Reason
+						break
+					}
+				}
+			}
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+// violates returns whether license is denied or not allowed.
+func (lp *licensePolicy) violates(license string) bool {
+	if matchesLicense(license, lp.Deny) {
+		return true
+	}
+	return len(lp.Allow) > 0 && !matchesLicense(license, lp.Allow)
+}
+
+// exception returns the exception exempting pkg from license, or nil. An
+// empty license stands for an unknown license.
+func (lp *licensePolicy) exception(pkg spdx.Package, license string) *licenseException {
+	for i, e := range lp.Exceptions {
+		if e.Package != pkg.Name && !(strings.HasPrefix(e.Package, "pkg:") && strings.HasPrefix(pkg.PURL, e.Package)) {
+			continue
+		}
+		if len(e.Licenses) == 0 || (license != "" && matchesLicense(license, e.Licenses)) {
+			return &lp.Exceptions[i]
+		}
+	}
+	return nil
+}
+
+// matchesLicense returns whether license matches one of patterns, ignoring
+// case. Patterns ending with "*" match by prefix.
+func matchesLicense(license string, patterns []string) bool {
+	license = strings.ToLower(license)
+	for _, p := range patterns {
+		p = strings.ToLower(spdx.NormalizeLicense(p))
+		if prefix, ok := strings.CutSuffix(p, "*"); ok {
+			if strings.HasPrefix(license, prefix) {
+				return true
+			}
+		} else if license == p {
+			return true
+		}
+	}
+	return false
+}
+
+// checkLicenses checks the licenses of the packages in the SBOM against the
+// license policy and writes the results as JSON artifact. Violations fail the
+// check, unless the policy only warns.
+func (p *packageImage) checkLicenses() error {
+	lp, err := readLicensePolicy(filepath.Join(p.opts.checkoutDir, p.opts.licensePolicyFile))
+	if err != nil {
+		return err
+	}
+	if p.sbom == nil {
+		return errors.New("no SBOM to check")
+	}
+	results := lp.evaluate(p.sbom)
+	report := licenseReport{Image: p.imageRef(), Digest: p.imageDigest, Packages: results}
+	var violations []string
+	counts := map[string]int{}
+	for _, r := range results {
+		counts[r.Status]++
+		if r.Status == licenseStatusViolation {
+			violations = append(violations, fmt.Sprintf("- %s %s: %s", r.Name, r.Version, strings.Join(r.Violations, ", ")))
+		}
+	}
+	report.Violations = len(violations)
+	reportsDir := filepath.Join(p.opts.checkoutDir, licenseReportsPath)
+	if err := pipelinectxt.WriteJsonArtifact(report, reportsDir, fmt.Sprintf("%s.json", p.imageNameNoSha())); err != nil {
+		return err
+	}
+	p.logger.Infof(
+		"Checked licenses of %d packages: %d allowed, %d excepted, %d unknown, %d violations",
+		len(results), counts[licenseStatusAllowed], counts[licenseStatusExcepted], counts[licenseStatusUnknown], counts[licenseStatusViolation],
+	)
+	if len(violations) == 0 {
+		return nil
+	}
+	msg := fmt.Sprintf("packages violate license policy:\n%s", strings.Join(violations, "\n"))
+	if lp.Action == licenseActionWarn {
+		p.logger.Warnf("%s", msg)
+		return nil
+	}
+	return errors.New(msg)
+}
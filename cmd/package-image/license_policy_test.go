@@ -0,0 +1,81 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/opendevstack/ods-pipeline-image/internal/spdx"
+)
+
+func TestLicensePolicyEvaluate(t *testing.T) {
+	policyFile := filepath.Join(t.TempDir(), "license-policy.yaml")
+	err := os.WriteFile(policyFile, []byte(`
+allow: [Apache-2.0, MIT, BSD-*, GPL-2.0-or-later]
+deny: [AGPL-*, SSPL-1.0]
+denyUnknown: true
+exceptions:
+- package: pkg:maven/org.mongodb/
+  licenses: [SSPL-1.0]
+  reason: commercial license
+- package: internal-lib
+  reason: owned by us
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lp, err := readLicensePolicy(policyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lp.Action != licenseActionFail {
+		t.Fatalf("want default action %s, got %s", licenseActionFail, lp.Action)
+	}
+	doc := &spdx.Document{
+		Packages: []spdx.Package{
+			{Name: "app", Purpose: spdx.PurposeContainer},
+			{Name: "openssl-libs", Version: "3.0.7", LicenseConcluded: "Apache-2.0"},
+			{Name: "bash", Version: "5.1.8", LicenseDeclared: "GPLv2+"},
+			{Name: "ghostscript", Version: "9.54", LicenseDeclared: "AGPLv3+"},
+			{Name: "dual", LicenseDeclared: "GPL-3.0-only OR MIT"},
+			{Name: "mongodb-driver", Version: "4.11", LicenseDeclared: "SSPL-1.0", PURL: "pkg:maven/org.mongodb/mongodb-driver@4.11"},
+			{Name: "mongodb-other", LicenseDeclared: "SSPL-1.0", PURL: "pkg:maven/com.example/mongodb-other@1.0"},
+			{Name: "internal-lib", LicenseDeclared: "LicenseRef-1"},
+			{Name: "nolicense", LicenseConcluded: spdx.NoAssertion, LicenseDeclared: spdx.NoAssertion},
+		},
+		OtherLicenses: map[string]string{"LicenseRef-1": "Proprietary"},
+	}
+	want := []licenseResult{
+		{Name: "openssl-libs", Version: "3.0.7", LicenseConcluded: "Apache-2.0", Licenses: []string{"Apache-2.0"}, Status: licenseStatusAllowed},
+		{Name: "bash", Version: "5.1.8", LicenseDeclared: "GPLv2+", Licenses: []string{"GPL-2.0-or-later"}, Status: licenseStatusAllowed},
+		{Name: "ghostscript", Version: "9.54", LicenseDeclared: "AGPLv3+", Licenses: []string{"AGPL-3.0-or-later"}, Status: licenseStatusViolation, Violations: []string{"AGPL-3.0-or-later"}},
+		{Name: "dual", LicenseDeclared: "GPL-3.0-only OR MIT", Licenses: []string{"GPL-3.0-only", "MIT"}, Status: licenseStatusAllowed},
+		{Name: "mongodb-driver", Version: "4.11", PURL: "pkg:maven/org.mongodb/mongodb-driver@4.11", LicenseDeclared: "SSPL-1.0", Licenses: []string{"SSPL-1.0"}, Status: licenseStatusExcepted, Exception: "commercial license"},
+		{Name: "mongodb-other", PURL: "pkg:maven/com.example/mongodb-other@1.0", LicenseDeclared: "SSPL-1.0", Licenses: []string{"SSPL-1.0"}, Status: licenseStatusViolation, Violations: []string{"SSPL-1.0"}},
+		{Name: "internal-lib", LicenseDeclared: "LicenseRef-1", Licenses: []string{"Proprietary"}, Status: licenseStatusExcepted, Exception: "owned by us"},
+		{Name: "nolicense", LicenseConcluded: spdx.NoAssertion, LicenseDeclared: spdx.NoAssertion, Status: licenseStatusViolation, Violations: []string{"unknown license"}},
+	}
+	if diff := cmp.Diff(want, lp.evaluate(doc)); diff != "" {
+		t.Fatalf("results mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestReadLicensePolicyInvalid(t *testing.T) {
+	tests := map[string]string{
+		"unknown field":          "allowed: [MIT]\n",
+		"invalid action":         "action: ignore\n",
+		"exception without name": "exceptions:\n- licenses: [MIT]\n",
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			policyFile := filepath.Join(t.TempDir(), "license-policy.yaml")
+			if err := os.WriteFile(policyFile, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := readLicensePolicy(policyFile); err == nil {
+				t.Fatal("want error, got none")
+			}
+		})
+	}
+}
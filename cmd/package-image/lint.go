@@ -0,0 +1,345 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/google/shlex"
+	"github.com/opendevstack/ods-pipeline-image/internal/dockerfile"
+	"github.com/opendevstack/ods-pipeline-image/internal/image"
+)
+
+// lintRule checks a Dockerfile and reports findings.
+type lintRule struct {
+	id          string
+	description string
+	severity    string
+	check       func(c *lintContext) []lintFinding
+}
+
+// lintContext is the input of lint rules.
+type lintContext struct {
+	df        *dockerfile.Dockerfile
+	buildArgs map[string]string
+	// dockerignore is whether a .dockerignore file applies to the build.
+	dockerignore bool
+	// targets are the stages built as images. Empty means the last stage.
+	targets []string
+}
+
+// lintFinding is a problem found by a lint rule.
+type lintFinding struct {
+	rule      string
+	severity  string
+	message   string
+	startLine int
+	endLine   int
+}
+
+var (
+	remoteURLRegexp    = regexp.MustCompile(`^(https?|ftp)://`)
+	aptGetInstall      = regexp.MustCompile(`\bapt-get\s+(-\S+\s+)*install\b`)
+	aptListsCleanup    = regexp.MustCompile(`rm\s+-(rf|fr|r)\s+/var/lib/apt/lists`)
+	variableReferences = regexp.MustCompile(`\$(\{[^}]*\}|[A-Za-z_][A-Za-z0-9_]*)`)
+)
+
+// lintRules are the rules checked by default, in report order.
+var lintRules = []lintRule{
+	{
+		id:          "latest-tag",
+		description: "Base images should be referenced by a specific tag or digest, not by latest.",
+		severity:    sarifLevelWarning,
+		check:       lintLatestTag,
+	},
+	{
+		id:          "missing-user",
+		description: "The stages built as images should switch to a non-root USER.",
+		severity:    sarifLevelWarning,
+		check:       lintMissingUser,
+	},
+	{
+		id:          "add-remote-url",
+		description: "ADD should not download remote URLs, use RUN with a checksum verification instead.",
+		severity:    sarifLevelWarning,
+		check:       lintAddRemoteURL,
+	},
+	{
+		id:          "apt-get-cleanup",
+		description: "apt-get install should be followed by removing /var/lib/apt/lists in the same RUN.",
+		severity:    sarifLevelWarning,
+		check:       lintAptGetCleanup,
+	},
+	{
+		id:          "secret-env",
+		description: "ENV should not set secrets, as they are stored in the image.",
+		severity:    sarifLevelWarning,
+		check:       lintSecretEnv,
+	},
+	{
+		id:          "copy-all-without-dockerignore",
+		description: "Copying the whole build context should be restricted by a .dockerignore file.",
+		severity:    sarifLevelWarning,
+		check:       lintCopyAllWithoutDockerignore,
+	},
+}
+
+// parseLintSeverities parses space separated rule=severity pairs overriding
+// the default severities of lint rules.
+func parseLintSeverities(s string) (map[string]string, error) {
+	fields, err := shlex.Split(s)
+	if err != nil {
+		return nil, fmt.Errorf("parse lint severities (%s): %w", s, err)
+	}
+	known := map[string]bool{}
+	for _, r := range lintRules {
+		known[r.id] = true
+	}
+	severities := map[string]string{}
+	for _, f := range fields {
+		rule, severity, ok := strings.Cut(f, "=")
+		if !ok || !known[rule] {
+			return nil, fmt.Errorf("invalid lint severity %q, must be <rule>=<severity> with a known rule", f)
+		}
+		switch severity {
+		case sarifLevelError, sarifLevelWarning, sarifLevelNote, sarifLevelNone:
+		default:
+			return nil, fmt.Errorf("invalid severity %q of lint rule %s, must be one of error, warning, note, none", severity, rule)
+		}
+		severities[rule] = severity
+	}
+	return severities, nil
+}
+
+// lint checks c against all rules. Rules with severity "none" are skipped.
+func lint(c *lintContext, severities map[string]string) []lintFinding {
+	var findings []lintFinding
+	for _, r := range lintRules {
+		severity := r.severity
+		if s, ok := severities[r.id]; ok {
+			severity = s
+		}
+		if severity == sarifLevelNone {
+			continue
+		}
+		for _, f := range r.check(c) {
+			f.rule, f.severity = r.id, severity
+			findings = append(findings, f)
+		}
+	}
+	return findings
+}
+
+func newFinding(inst dockerfile.Instruction, format string, a ...interface{}) lintFinding {
+	return lintFinding{message: fmt.Sprintf(format, a...), startLine: inst.StartLine, endLine: inst.EndLine}
+}
+
+func lintLatestTag(c *lintContext) []lintFinding {
+	var findings []lintFinding
+	for i, s := range c.df.Stages {
+		ref, stage := c.df.Base(i, c.buildArgs)
+		if stage >= 0 || ref == dockerfile.Scratch {
+			continue
+		}
+		r, err := image.ParseReference(ref)
+		if err != nil {
+			findings = append(findings, newFinding(s.From, "%s", err))
+			continue
+		}
+		if r.Digest == "" && (r.Tag == "" || r.Tag == "latest") {
+			findings = append(findings, newFinding(s.From, "base image %s uses the latest tag", ref))
+		}
+	}
+	return findings
+}
+
+func lintMissingUser(c *lintContext) []lintFinding {
+	if len(c.df.Stages) == 0 {
+		return nil
+	}
+	var findings []lintFinding
+	for _, s := range targetStages(c) {
+		desc := fmt.Sprintf("stage %s", s.Name)
+		if len(c.targets) == 0 {
+			desc = "final stage"
+		}
+		var user *dockerfile.Instruction
+		for i, inst := range s.Instructions {
+			if inst.Command == "USER" {
+				user = &s.Instructions[i]
+			}
+		}
+		if user == nil {
+			findings = append(findings, newFinding(s.From, "%s does not set USER", desc))
+		} else if isRootUser(user.Args) {
+			findings = append(findings, newFinding(*user, "%s runs as root (USER %s)", desc, user.Args))
+		}
+	}
+	return findings
+}
+
+// targetStages returns the stages built as images.
+func targetStages(c *lintContext) []dockerfile.Stage {
+	if len(c.targets) == 0 {
+		return c.df.Stages[len(c.df.Stages)-1:]
+	}
+	var stages []dockerfile.Stage
+	for _, s := range c.df.Stages {
+		for _, t := range c.targets {
+			if s.Name == t {
+				stages = append(stages, s)
+			}
+		}
+	}
+	return stages
+}
+
+func lintAddRemoteURL(c *lintContext) []lintFinding {
+	var findings []lintFinding
+	for _, inst := range c.df.Instructions {
+		if inst.Command != "ADD" {
+			continue
+		}
+		for _, src := range inst.Values[:max(len(inst.Values)-1, 0)] {
+			if remoteURLRegexp.MatchString(src) {
+				findings = append(findings, newFinding(inst, "ADD downloads remote URL %s", src))
+			}
+		}
+	}
+	return findings
+}
+
+func lintAptGetCleanup(c *lintContext) []lintFinding {
+	var findings []lintFinding
+	for _, inst := range c.df.Instructions {
+		if inst.Command != "RUN" {
+			continue
+		}
+		script := strings.Join(append([]string{inst.Args}, inst.Heredocs...), "\n")
+		if aptGetInstall.MatchString(script) && !aptListsCleanup.MatchString(script) {
+			findings = append(findings, newFinding(inst, "apt-get install without removing /var/lib/apt/lists"))
+		}
+	}
+	return findings
+}
+
+func lintSecretEnv(c *lintContext) []lintFinding {
+	var findings []lintFinding
+	for _, inst := range c.df.Instructions {
+		if inst.Command != "ENV" {
+			continue
+		}
+		// The parser splits ENV into alternating keys and values, for both
+		// the key=value and the legacy "key value" form.
+		for i := 0; i+1 < len(inst.Values); i += 2 {
+			key, value := inst.Values[i], inst.Values[i+1]
+			literal := strings.TrimSpace(variableReferences.ReplaceAllString(value, ""))
+			if literal == "" {
+				continue
+			}
+			if isSecretName(key) {
+				findings = append(findings, newFinding(inst, "ENV %s sets a secret", key))
+				continue
+			}
+			for _, p := range credentialPatterns {
+				if p.pattern.MatchString(value) {
+					findings = append(findings, newFinding(inst, "ENV %s contains a %s", key, p.name))
+					break
+				}
+			}
+		}
+	}
+	return findings
+}
+
+func lintCopyAllWithoutDockerignore(c *lintContext) []lintFinding {
+	if c.dockerignore {
+		return nil
+	}
+	var findings []lintFinding
+	for _, inst := range c.df.Instructions {
+		if inst.Command != "COPY" && inst.Command != "ADD" {
+			continue
+		}
+		if _, ok := inst.Flag("from"); ok {
+			continue
+		}
+		for _, src := range inst.Values[:max(len(inst.Values)-1, 0)] {
+			if src == "." || src == "./" {
+				findings = append(findings, newFinding(inst, "%s copies the whole build context, but there is no .dockerignore", inst.Command))
+				break
+			}
+		}
+	}
+	return findings
+}
+
+// lintDockerfile lints the Dockerfile and writes the findings as SARIF
+// artifact. Findings with severity error fail the build.
+func (p *packageImage) lintDockerfile() error {
+	severities, err := parseLintSeverities(p.opts.dockerfileLintSeverities)
+	if err != nil {
+		return err
+	}
+	dockerfilePath := p.dockerfilePath()
+	df, err := dockerfile.ParseFile(dockerfilePath)
+	if err != nil {
+		return err
+	}
+	buildArgs, err := p.buildArgs()
+	if err != nil {
+		return err
+	}
+	targets, err := packageTargets(p.opts)
+	if err != nil {
+		return err
+	}
+	c := &lintContext{df: df, buildArgs: buildArgs, targets: packageStages(targets)}
+	for _, f := range []string{
+		filepath.Join(p.opts.checkoutDir, p.opts.contextDir, ".dockerignore"),
+		dockerfilePath + ".dockerignore",
+	} {
+		if _, err := os.Stat(f); err == nil {
+			c.dockerignore = true
+		}
+	}
+	findings := lint(c, severities)
+
+	var rules []sarifRule
+	for _, r := range lintRules {
+		rules = append(rules, sarifRule{
+			ID:                   r.id,
+			ShortDescription:     sarifMessage{Text: r.description},
+			DefaultConfiguration: sarifConfiguration{Level: r.severity},
+		})
+	}
+	report := newSarifLog("ods-package-image-lint", rules)
+	uri := filepath.ToSlash(filepath.Join(p.opts.contextDir, p.opts.dockerfile))
+	if filepath.IsAbs(p.opts.dockerfile) {
+		uri = filepath.ToSlash(p.opts.dockerfile)
+	}
+	var failures []string
+	for _, f := range findings {
+		report.addResult(f.rule, f.severity, f.message, uri, f.startLine, f.endLine)
+		msg := fmt.Sprintf("%s:%d: %s (%s)", p.opts.dockerfile, f.startLine, f.message, f.rule)
+		switch f.severity {
+		case sarifLevelError:
+			p.logger.Errorf(msg)
+			failures = append(failures, "- "+msg)
+		case sarifLevelWarning:
+			p.logger.Warnf(msg)
+		default:
+			p.logger.Infof(msg)
+		}
+	}
+	reportsDir := filepath.Join(p.opts.checkoutDir, sarifReportsPath)
+	if err := report.write(reportsDir, fmt.Sprintf("%s-dockerfile-lint.sarif", p.imageNameNoSha())); err != nil {
+		return err
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("lint errors in %s:\n%s", p.opts.dockerfile, strings.Join(failures, "\n"))
+	}
+	return nil
+}
@@ -3,11 +3,15 @@ package main
 import (
 	"flag"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/opendevstack/ods-pipeline-image/internal/image"
+	"github.com/opendevstack/ods-pipeline-image/internal/oci"
+	"github.com/opendevstack/ods-pipeline-image/internal/spdx"
 	"github.com/opendevstack/ods-pipeline/pkg/artifact"
 	"github.com/opendevstack/ods-pipeline/pkg/logging"
 	"github.com/opendevstack/ods-pipeline/pkg/pipelinectxt"
@@ -21,35 +25,103 @@ const (
 )
 
 type options struct {
-	checkoutDir           string
-	imageStream           string
-	extraTags             string
-	registry              string
-	certDir               string
-	imageNamespace        string
-	tlsVerify             bool
-	storageDriver         string
-	format                string
-	dockerfile            string
-	contextDir            string
-	nexusURL              string
-	nexusUsername         string
-	nexusPassword         string
-	buildahBuildExtraArgs string
-	buildahPushExtraArgs  string
-	trivySBOMExtraArgs    string
-	cosignKey             string
-	debug                 bool
+	checkoutDir               string
+	imageStream               string
+	extraTags                 string
+	registry                  string
+	certDir                   string
+	imageNamespace            string
+	tlsVerify                 bool
+	storageDriver             string
+	format                    string
+	dockerfile                string
+	contextDir                string
+	nexusURL                  string
+	nexusUsername             string
+	nexusPassword             string
+	buildahBuildExtraArgs     string
+	buildahPushExtraArgs      string
+	trivySBOMExtraArgs        string
+	trivyVulnExtraArgs        string
+	trivyCacheDir             string
+	trivyDBRepository         string
+	trivyJavaDBRepository     string
+	trivySkipDBUpdate         bool
+	trivyDBMaxAge             string
+	trivyTimeout              string
+	cosignKey                 string
+	secretScan                string
+	contentScanners           string
+	contentScanFailSeverities string
+	trivyContentExtraArgs     string
+	dockerfileLintSeverities  string
+	registryMirrors           string
+	baseImageAllowlist        string
+	pinBaseImages             bool
+	target                    string
+	stageImages               string
+	buildArgsFile             string
+	stageOutputs              string
+	baseImage                 string
+	copyFiles                 string
+	workdir                   string
+	user                      string
+	entrypoint                string
+	expose                    string
+	imagePolicyFile           string
+	structureTestsFile        string
+	onDigestMismatch          string
+	ociArchive                bool
+	ociArchiveNexusRepository string
+	attachReferrers           bool
+	sbomDiffTag               string
+	licensePolicyFile         string
+	vulnerabilityScan         bool
+	vexFiles                  string
+	updateImageStream         bool
+	immutableTags             string
+	debug                     bool
 }
 
 type packageImage struct {
 	logger          logging.LeveledLoggerInterface
 	opts            options
 	parsedExtraTags []string
+	immutableTags   []string
 	ctxt            *pipelinectxt.ODSContext
 	imageId         image.Identity
 	imageDigest     string
 	sbomFile        string
+	imageStreams    *imageStreamUpdater
+	baseImages      []baseImage
+	// sbom is the parsed SBOM, set once it has been validated.
+	sbom *spdx.Document
+	// vulnReportFile is the vulnerability report artifact, if the image has
+	// been scanned for vulnerabilities.
+	vulnReportFile string
+	// trivyDB describes trivy and its DBs once the vulnerability DB has been
+	// prepared.
+	trivyDB *trivyVersionInfo
+	// buildDockerfile overrides the Dockerfile passed to buildah, e.g. with
+	// base images pinned to their digests.
+	buildDockerfile string
+	// target is the Dockerfile stage to build, empty for the last stage.
+	target string
+	// imageStreamSuffix is appended to the image stream.
+	imageStreamSuffix string
+	// primary is whether the image is reported in the task results. Steps
+	// concerning the Dockerfile as a whole run for the primary image only.
+	primary bool
+	// cacheLayers is whether build layers are cached to share them between
+	// the builds of several images.
+	cacheLayers bool
+	// reuseLayers is whether layers cached by a previous build are used.
+	reuseLayers bool
+	// buildTime is passed as BUILD_DATE build arg.
+	buildTime time.Time
+	// assembleBase overrides the base image the image is assembled onto,
+	// e.g. with a registry mirror or pinned to its digest.
+	assembleBase string
 }
 
 func (p *packageImage) imageName() string {
@@ -64,6 +136,33 @@ func (p *packageImage) imageRef() string {
 	return p.imageId.ImageRefWithSha(p.opts.registry)
 }
 
+// digestFile returns the file to which the digest of the local build is
+// written.
+func (p *packageImage) digestFile() string {
+	return filepath.Join(buildahWorkdir, fmt.Sprintf("%s.digest", p.imageNameNoSha()))
+}
+
+// ociLayoutDir returns the directory of the OCI layout to which the image is
+// written locally. Within the layout, the image is referenced by the Git
+// commit SHA. The directory is absolute as buildah, skopeo and trivy do not
+// run in the checkout dir.
+func (p *packageImage) ociLayoutDir() (string, error) {
+	absDir, err := filepath.Abs(p.opts.checkoutDir)
+	if err != nil {
+		return "", fmt.Errorf("abs dir: %w", err)
+	}
+	return filepath.Join(absDir, p.imageNameNoSha()), nil
+}
+
+// openOCILayout opens the OCI layout to which the image is written locally.
+func (p *packageImage) openOCILayout() (*oci.Layout, error) {
+	dir, err := p.ociLayoutDir()
+	if err != nil {
+		return nil, err
+	}
+	return oci.Open(dir)
+}
+
 func (p *packageImage) artifactImage() artifact.Image {
 	return p.imageId.ArtifactImage(p.opts.registry, p.imageDigest)
 }
@@ -74,28 +173,84 @@ func (p *packageImage) artifactImageForTag(tag string) artifact.Image {
 }
 
 var defaultOptions = options{
-	checkoutDir:           ".",
-	imageStream:           "",
-	extraTags:             "",
-	registry:              "image-registry.openshift-image-registry.svc:5000",
-	certDir:               defaultCertDir(),
-	imageNamespace:        "",
-	tlsVerify:             true,
-	storageDriver:         "vfs",
-	format:                "oci",
-	dockerfile:            "./Dockerfile",
-	contextDir:            "docker",
-	nexusURL:              os.Getenv("NEXUS_URL"),
-	nexusUsername:         os.Getenv("NEXUS_USERNAME"),
-	nexusPassword:         os.Getenv("NEXUS_PASSWORD"),
-	buildahBuildExtraArgs: "",
-	buildahPushExtraArgs:  "",
-	trivySBOMExtraArgs:    "",
-	cosignKey:             "",
-	debug:                 (os.Getenv("DEBUG") == "true"),
+	checkoutDir:               ".",
+	imageStream:               "",
+	extraTags:                 "",
+	registry:                  "image-registry.openshift-image-registry.svc:5000",
+	certDir:                   defaultCertDir(),
+	imageNamespace:            "",
+	tlsVerify:                 true,
+	storageDriver:             "vfs",
+	format:                    "oci",
+	dockerfile:                "./Dockerfile",
+	contextDir:                "docker",
+	nexusURL:                  os.Getenv("NEXUS_URL"),
+	nexusUsername:             os.Getenv("NEXUS_USERNAME"),
+	nexusPassword:             os.Getenv("NEXUS_PASSWORD"),
+	buildahBuildExtraArgs:     "",
+	buildahPushExtraArgs:      "",
+	trivySBOMExtraArgs:        "",
+	trivyVulnExtraArgs:        "",
+	trivyCacheDir:             "",
+	trivyDBRepository:         "",
+	trivyJavaDBRepository:     "",
+	trivySkipDBUpdate:         false,
+	trivyDBMaxAge:             "",
+	trivyTimeout:              "10m",
+	cosignKey:                 "",
+	secretScan:                secretScanNone,
+	contentScanners:           "",
+	contentScanFailSeverities: "HIGH,CRITICAL",
+	trivyContentExtraArgs:     "",
+	dockerfileLintSeverities:  "",
+	registryMirrors:           "",
+	baseImageAllowlist:        "",
+	pinBaseImages:             false,
+	target:                    "",
+	stageImages:               "",
+	buildArgsFile:             "",
+	stageOutputs:              "",
+	baseImage:                 "",
+	copyFiles:                 "",
+	workdir:                   "",
+	user:                      "",
+	entrypoint:                "",
+	expose:                    "",
+	imagePolicyFile:           "",
+	structureTestsFile:        "",
+	onDigestMismatch:          digestMismatchFail,
+	ociArchive:                false,
+	ociArchiveNexusRepository: "",
+	attachReferrers:           false,
+	sbomDiffTag:               "",
+	licensePolicyFile:         "",
+	vulnerabilityScan:         false,
+	vexFiles:                  "",
+	updateImageStream:         false,
+	immutableTags:             "",
+	debug:                     (os.Getenv("DEBUG") == "true"),
+}
+
+// subcommands maps names of subcommands to their entrypoints. Without a
+// subcommand, an image is packaged.
+var subcommands = map[string]func(args []string) error{
+	"promote":       runPromote,
+	"cleanup":       runCleanup,
+	"rebase":        runRebase,
+	"export-bundle": runExportBundle,
+	"import-bundle": runImportBundle,
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		if run, ok := subcommands[os.Args[1]]; ok {
+			if err := run(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+	}
+
 	opts := options{}
 	flag.StringVar(&opts.checkoutDir, "checkout-dir", defaultOptions.checkoutDir, "Checkout dir")
 	flag.StringVar(&opts.imageStream, "image-stream", defaultOptions.imageStream, "Image stream")
@@ -114,39 +269,117 @@ func main() {
 	flag.StringVar(&opts.buildahBuildExtraArgs, "buildah-build-extra-args", defaultOptions.buildahBuildExtraArgs, "extra parameters passed for the build command when building images")
 	flag.StringVar(&opts.buildahPushExtraArgs, "buildah-push-extra-args", defaultOptions.buildahPushExtraArgs, "extra parameters passed for the push command when pushing images")
 	flag.StringVar(&opts.trivySBOMExtraArgs, "trivy-sbom-extra-args", defaultOptions.trivySBOMExtraArgs, "extra parameters passed for the trivy command to generate an SBOM")
+	flag.StringVar(&opts.trivyVulnExtraArgs, "trivy-vuln-extra-args", defaultOptions.trivyVulnExtraArgs, "extra parameters passed for the trivy command to scan for vulnerabilities")
+	flag.StringVar(&opts.trivyCacheDir, "trivy-cache-dir", defaultOptions.trivyCacheDir, "cache dir of trivy holding its DBs, relative to checkout dir unless absolute")
+	flag.StringVar(&opts.trivyDBRepository, "trivy-db-repository", defaultOptions.trivyDBRepository, "OCI repository to download the trivy vulnerability DB from")
+	flag.StringVar(&opts.trivyJavaDBRepository, "trivy-java-db-repository", defaultOptions.trivyJavaDBRepository, "OCI repository to download the trivy Java DB from")
+	flag.BoolVar(&opts.trivySkipDBUpdate, "trivy-skip-db-update", defaultOptions.trivySkipDBUpdate, "use the DBs pre-seeded in the trivy cache dir without updating them")
+	flag.StringVar(&opts.trivyDBMaxAge, "trivy-db-max-age", defaultOptions.trivyDBMaxAge, "maximum age of the trivy vulnerability DB, e.g. 72h or 3d")
+	flag.StringVar(&opts.trivyTimeout, "trivy-timeout", defaultOptions.trivyTimeout, "timeout of trivy commands, e.g. 10m")
 	flag.StringVar(&opts.cosignKey, "cosign-key", defaultOptions.cosignKey, "cosign key to sign the image with")
+	flag.StringVar(&opts.secretScan, "secret-scan", defaultOptions.secretScan, "where to look for leaked secrets before pushing: none, history or layers")
+	flag.StringVar(&opts.contentScanners, "content-scanners", defaultOptions.contentScanners, "trivy scanners besides the secret scanner enabled by secret-scan (misconfig) to scan the files of the image with before pushing")
+	flag.StringVar(&opts.contentScanFailSeverities, "content-scan-fail-severities", defaultOptions.contentScanFailSeverities, "severities (comma separated) of secrets found by the content scan which fail the task")
+	flag.StringVar(&opts.trivyContentExtraArgs, "trivy-content-extra-args", defaultOptions.trivyContentExtraArgs, "extra parameters passed for the trivy command to scan the files of the image")
+	flag.StringVar(&opts.dockerfileLintSeverities, "dockerfile-lint-severities", defaultOptions.dockerfileLintSeverities, "rule=severity pairs (space separated) overriding the severity of Dockerfile lint rules")
+	flag.StringVar(&opts.registryMirrors, "registry-mirrors", defaultOptions.registryMirrors, "source=target mappings (space separated) of registries to pull base images from instead")
+	flag.StringVar(&opts.baseImageAllowlist, "base-image-allowlist", defaultOptions.baseImageAllowlist, "registries or registry/repository prefixes (space separated) base images must be located within")
+	flag.BoolVar(&opts.pinBaseImages, "pin-base-images", defaultOptions.pinBaseImages, "build with base images pinned to their resolved digests")
+	flag.StringVar(&opts.target, "target", defaultOptions.target, "Dockerfile stage to build instead of the last one")
+	flag.StringVar(&opts.stageImages, "stage-images", defaultOptions.stageImages, "Dockerfile stages to publish as separate images, as <stage> -> <image stream or -suffix> entries separated by newlines or semicolons")
+	flag.StringVar(&opts.buildArgsFile, "build-args-file", defaultOptions.buildArgsFile, "file (relative to checkout dir) with KEY=VALUE build args, values may reference the ODS context such as {{.GitCommitSHA}}")
+	flag.StringVar(&opts.stageOutputs, "stage-outputs", defaultOptions.stageOutputs, "files to copy out of Dockerfile stages, as <stage>:<path> -> <destination> entries separated by newlines or semicolons")
+	flag.StringVar(&opts.baseImage, "base-image", defaultOptions.baseImage, "base image to assemble the image onto instead of building the Dockerfile")
+	flag.StringVar(&opts.copyFiles, "copy", defaultOptions.copyFiles, "files (relative to checkout dir) to copy onto the base image, as <path> -> <destination> entries separated by newlines or semicolons")
+	flag.StringVar(&opts.workdir, "workdir", defaultOptions.workdir, "working directory of the image assembled onto the base image")
+	flag.StringVar(&opts.user, "user", defaultOptions.user, "user of the image assembled onto the base image, also owning the copied files")
+	flag.StringVar(&opts.entrypoint, "entrypoint", defaultOptions.entrypoint, "entrypoint of the image assembled onto the base image")
+	flag.StringVar(&opts.expose, "expose", defaultOptions.expose, "ports (space separated) exposed by the image assembled onto the base image")
+	flag.StringVar(&opts.imagePolicyFile, "image-policy-file", defaultOptions.imagePolicyFile, "image policy file (relative to checkout dir) the built image is checked against")
+	flag.StringVar(&opts.structureTestsFile, "structure-tests-file", defaultOptions.structureTestsFile, "structure tests file (relative to checkout dir) run against the built image")
+	flag.StringVar(&opts.onDigestMismatch, "on-digest-mismatch", defaultOptions.onDigestMismatch, "what to do if the pushed digest differs from the local one, fail or record")
+	flag.BoolVar(&opts.ociArchive, "oci-archive", defaultOptions.ociArchive, "save the image with its signatures and attestations as OCI archive artifact")
+	flag.StringVar(&opts.ociArchiveNexusRepository, "oci-archive-nexus-repository", defaultOptions.ociArchiveNexusRepository, "Nexus repository to upload the OCI archive to")
+	flag.BoolVar(&opts.attachReferrers, "attach-referrers", defaultOptions.attachReferrers, "attach the SBOM and vulnerability report to the image as OCI referrer artifacts")
+	flag.StringVar(&opts.sbomDiffTag, "sbom-diff-tag", defaultOptions.sbomDiffTag, "tag of the previously published image to compare the SBOM with")
+	flag.StringVar(&opts.licensePolicyFile, "license-policy-file", defaultOptions.licensePolicyFile, "license policy file (relative to checkout dir) the licenses of the packages in the SBOM are checked against")
+	flag.BoolVar(&opts.vulnerabilityScan, "vulnerability-scan", defaultOptions.vulnerabilityScan, "scan the image for vulnerabilities and attach the result as attestation")
+	flag.StringVar(&opts.vexFiles, "vex-files", defaultOptions.vexFiles, "OpenVEX documents (glob patterns relative to checkout dir, space separated) declaring vulnerabilities which do not affect the image")
+	flag.BoolVar(&opts.updateImageStream, "update-image-stream", defaultOptions.updateImageStream, "create or update the OpenShift image stream tags of the image")
+	flag.StringVar(&opts.immutableTags, "immutable-tags", defaultOptions.immutableTags, "glob patterns of extra tags which must not be moved to another image once they exist")
 	flag.BoolVar(&opts.debug, "debug", defaultOptions.debug, "debug mode")
 	flag.Parse()
-	var logger logging.LeveledLoggerInterface
-	if opts.debug {
-		logger = &logging.LeveledLogger{Level: logging.LevelDebug}
-	} else {
-		logger = &logging.LeveledLogger{Level: logging.LevelInfo}
+	logger := newLogger(opts.debug)
+	if err := validateDigestMismatchPolicy(opts.onDigestMismatch); err != nil {
+		logger.Errorf(err.Error())
+		os.Exit(1)
 	}
-	p := packageImage{logger: logger, opts: opts}
-	err := (&p).runSteps(
+	targets, err := packageTargets(opts)
+	if err != nil {
+		logger.Errorf(err.Error())
+		os.Exit(1)
+	}
+	for _, p := range newPackageImages(opts, targets) {
+		p.logger = logger
+		if err := p.run(); err != nil {
+			logger.Errorf(err.Error())
+			os.Exit(1)
+		}
+	}
+}
+
+// run builds, checks and publishes the image.
+func (p *packageImage) run() error {
+	err := p.runSteps(
 		setExtraTags(),
 		setupContext(),
 		setImageId(),
 		skipIfImageArtifactExists(),
+		lintDockerfile(),
+		checkBaseImages(),
 		buildImageAndGenerateTar(),
+		extractStageOutputs(),
+		checkForSecrets(),
+		scanImageContent(),
+		checkImagePolicy(),
+		runStructureTests(),
 		generateSBOM(),
+		diffSBOM(),
+		checkLicenses(),
+		scanVulnerabilities(),
 		pushImage(),
-		signImage(opts.cosignKey),
+		verifyPushedDigest(),
+		signImage(p.opts.cosignKey),
+		attachReferrers(),
+		saveOCIArchive(),
+		updateImageStream(),
 		storeArtifact(),
 		storeResults(),
 	)
 	if err != nil {
-		logger.Errorf(err.Error())
-		os.Exit(1)
+		return err
 	}
 	// If skipIfImageArtifactExists skips the remaining runSteps, extra-tags
 	// still should be processed if their related artifact has not been set.
-	err = (&p).runSteps(processExtraTags())
-	if err != nil {
-		logger.Errorf(err.Error())
-		os.Exit(1)
+	return p.runSteps(processExtraTags())
+}
+
+func newLogger(debug bool) logging.LeveledLoggerInterface {
+	if debug {
+		return &logging.LeveledLogger{Level: logging.LevelDebug}
+	}
+	return &logging.LeveledLogger{Level: logging.LevelInfo}
+}
+
+// registryTLSVerify returns whether TLS verification should be used
+// to access registry.
+func registryTLSVerify(registry string, tlsVerify bool) bool {
+	// TLS verification of the KinD registry is not possible at the moment as
+	// requests error out with "server gave HTTP response to HTTPS client".
+	if strings.HasPrefix(registry, kindRegistry) {
+		return false
 	}
+	return tlsVerify
 }
 
 func defaultCertDir() string {
@@ -157,8 +390,8 @@ func defaultCertDir() string {
 }
 
 // getImageDigestFromFile reads the image digest from the file written to by buildah.
-func getImageDigestFromFile(workingDir string) (string, error) {
-	content, err := os.ReadFile(tektonResultsImageDigestFile)
+func getImageDigestFromFile(digestFile string) (string, error) {
+	content, err := os.ReadFile(digestFile)
 	if err != nil {
 		return "", err
 	}
@@ -168,7 +401,7 @@ func getImageDigestFromFile(workingDir string) (string, error) {
 // imageArtifactExists checks if image artifact JSON file exists in its artifacts path
 func imageArtifactExists(p *packageImage) error {
 	imageArtifactsDir := filepath.Join(p.opts.checkoutDir, pipelinectxt.ImageDigestsPath)
-	imageArtifactFilename := fmt.Sprintf("%s.json", p.ctxt.Component)
+	imageArtifactFilename := fmt.Sprintf("%s.json", p.imageNameNoSha())
 	_, err := os.Stat(filepath.Join(imageArtifactsDir, imageArtifactFilename))
 	return err
 }
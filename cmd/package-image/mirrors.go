@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/google/shlex"
+	"github.com/opendevstack/ods-pipeline-image/internal/image"
+)
+
+// registryMirror maps images located within source (a registry or
+// registry/repository prefix) to target.
+type registryMirror struct {
+	source string
+	target string
+}
+
+// parseRegistryMirrors parses space separated source=target mappings such as
+// "docker.io=nexus.example.com:8443/dockerhub". Targets starting with ":" or
+// "/" are relative to the host of nexusURL, e.g. "docker.io=:8443/dockerhub".
+func parseRegistryMirrors(s string, nexusURL string) ([]registryMirror, error) {
+	fields, err := shlex.Split(s)
+	if err != nil {
+		return nil, fmt.Errorf("parse registry mirrors (%s): %w", s, err)
+	}
+	var mirrors []registryMirror
+	for _, f := range fields {
+		source, target, ok := strings.Cut(f, "=")
+		source = image.NormalizePrefix(source)
+		target = strings.TrimSuffix(target, "/")
+		if !ok || source == "" || target == "" {
+			return nil, fmt.Errorf("invalid registry mirror %q, must be <source>=<target>", f)
+		}
+		if strings.HasPrefix(target, ":") || strings.HasPrefix(target, "/") {
+			u, err := url.Parse(nexusURL)
+			if err != nil || u.Host == "" {
+				return nil, fmt.Errorf("registry mirror %q is relative to the Nexus URL, but the Nexus URL (%s) has no host", f, nexusURL)
+			}
+			if strings.HasPrefix(target, ":") {
+				target = u.Hostname() + target
+			} else {
+				target = u.Host + target
+			}
+		}
+		if t, err := image.ParseReference(target + "/x"); err != nil || !strings.HasPrefix(target, t.Registry) {
+			return nil, fmt.Errorf("invalid registry mirror target %q, must start with a registry host", target)
+		}
+		mirrors = append(mirrors, registryMirror{source: source, target: target})
+	}
+	return mirrors, nil
+}
+
+// mirrorReference returns the reference of ref in the mirror with the
+// longest matching source, and whether a mirror matched.
+func mirrorReference(ref image.Reference, mirrors []registryMirror) (image.Reference, bool) {
+	var match *registryMirror
+	for i, m := range mirrors {
+		if ref.MatchesPrefix(m.source) && (match == nil || len(m.source) > len(match.source)) {
+			match = &mirrors[i]
+		}
+	}
+	if match == nil {
+		return ref, false
+	}
+	rest := strings.TrimPrefix(ref.Name(), match.source)
+	mirrored := ref
+	target, err := image.ParseReference(match.target + rest)
+	if err != nil {
+		return ref, false
+	}
+	mirrored.Registry, mirrored.Repository = target.Registry, target.Repository
+	return mirrored, true
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/opendevstack/ods-pipeline-image/internal/image"
+)
+
+func TestMirrorReference(t *testing.T) {
+	mirrors, err := parseRegistryMirrors(
+		"docker.io=:8443/dockerhub docker.io/library=:8443/dockerhub-official quay.io=/quay registry.example.com=mirror.example.com/example",
+		"https://nexus.example.com:8081",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]struct {
+		ref  string
+		want string
+	}{
+		"longest source wins": {
+			ref:  "alpine:3.19",
+			want: "nexus.example.com:8443/dockerhub-official/alpine:3.19",
+		},
+		"official image with docker hub registry": {
+			ref:  "docker.io/alpine:3.19",
+			want: "nexus.example.com:8443/dockerhub-official/alpine:3.19",
+		},
+		"official image with legacy docker hub registry": {
+			ref:  "index.docker.io/library/alpine:3.19",
+			want: "nexus.example.com:8443/dockerhub-official/alpine:3.19",
+		},
+		"docker hub organisation": {
+			ref:  "bitnami/nginx@sha256:abc",
+			want: "nexus.example.com:8443/dockerhub/bitnami/nginx@sha256:abc",
+		},
+		"relative to nexus host with port": {
+			ref:  "quay.io/keycloak/keycloak:24.0",
+			want: "nexus.example.com:8081/quay/keycloak/keycloak:24.0",
+		},
+		"absolute target": {
+			ref:  "registry.example.com/team/app:1.0",
+			want: "mirror.example.com/example/team/app:1.0",
+		},
+		"not mirrored": {
+			ref:  "registry.access.redhat.com/ubi9/ubi:latest",
+			want: "registry.access.redhat.com/ubi9/ubi:latest",
+		},
+		"registry prefix of other registry": {
+			ref:  "quay.io.example.com/foo:1",
+			want: "quay.io.example.com/foo:1",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			ref, err := image.ParseReference(tc.ref)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, _ := mirrorReference(ref, mirrors)
+			if got.String() != tc.want {
+				t.Fatalf("want %s, got %s", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestParseRegistryMirrorsInvalid(t *testing.T) {
+	tests := map[string]struct {
+		mirrors  string
+		nexusURL string
+	}{
+		"missing target":         {mirrors: "docker.io", nexusURL: ""},
+		"relative without nexus": {mirrors: "docker.io=:8443/dockerhub", nexusURL: ""},
+		"target without host":    {mirrors: "docker.io=dockerhub/mirror", nexusURL: ""},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := parseRegistryMirrors(tc.mirrors, tc.nexusURL); err == nil {
+				t.Fatal("want error, got none")
+			}
+		})
+	}
+}
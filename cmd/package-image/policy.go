@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/opendevstack/ods-pipeline-image/internal/image"
+	"github.com/opendevstack/ods-pipeline-image/internal/oci"
+	"github.com/opendevstack/ods-pipeline/pkg/pipelinectxt"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/yaml"
+)
+
+// imagePolicyReportsPath is the artifacts path of image policy reports.
+const imagePolicyReportsPath = pipelinectxt.ArtifactsPath + "/image-policy-reports"
+
+// imagePolicy describes rules the built image must comply with. Rules which
+// are not set are not checked.
+type imagePolicy struct {
+	// NonRootUser requires the image to run as a user other than root.
+	NonRootUser bool `json:"nonRootUser"`
+	// RequiredLabels lists labels which must be present.
+	RequiredLabels []string `json:"requiredLabels"`
+	// AllowedPorts lists the ports (e.g. "8080" or "8080/tcp") which may be
+	// exposed. An empty list allows no exposed ports.
+	AllowedPorts *[]string `json:"allowedPorts"`
+	// AllowedBaseRegistries lists registries or registry/repository prefixes
+	// from which the base image may come.
+	AllowedBaseRegistries []string `json:"allowedBaseRegistries"`
+	// MaxSize is the maximum size of the image (sum of compressed layers and
+	// config), e.g. "500Mi".
+	MaxSize *resource.Quantity `json:"maxSize"`
+}
+
+// policyResult is the outcome of checking one rule.
+type policyResult struct {
+	Rule    string `json:"rule"`
+	Passed  bool   `json:"passed"`
+	Message string `json:"message,omitempty"`
+}
+
+// policyReport is written as JSON artifact.
+type policyReport struct {
+	Image   string         `json:"image"`
+	Digest  string         `json:"digest"`
+	Results []policyResult `json:"results"`
+}
+
+func readImagePolicy(filename string) (*imagePolicy, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("read image policy: %w", err)
+	}
+	var ip imagePolicy
+	if err := yaml.UnmarshalStrict(b, &ip); err != nil {
+		return nil, fmt.Errorf("parse image policy %s: %w", filename, err)
+	}
+	return &ip, nil
+}
+
+// evaluate checks the image described by manifest and config against the policy.
+func (ip *imagePolicy) evaluate(manifest *oci.Manifest, config *oci.ImageConfig) []policyResult {
+	var results []policyResult
+	check := func(rule string, violations []string) {
+		results = append(results, policyResult{
+			Rule:    rule,
+			Passed:  len(violations) == 0,
+			Message: strings.Join(violations, "; "),
+		})
+	}
+	if ip.NonRootUser {
+		var violations []string
+		if isRootUser(config.Config.User) {
+			violations = append(violations, fmt.Sprintf("image runs as root (user %q)", config.Config.User))
+		}
+		check("nonRootUser", violations)
+	}
+	if len(ip.RequiredLabels) > 0 {
+		var violations []string
+		for _, l := range ip.RequiredLabels {
+			if _, ok := config.Config.Labels[l]; !ok {
+				violations = append(violations, fmt.Sprintf("label %s is missing", l))
+			}
+		}
+		check("requiredLabels", violations)
+	}
+	if ip.AllowedPorts != nil {
+		allowed := map[string]bool{}
+		for _, p := range *ip.AllowedPorts {
+			allowed[normalizePort(p)] = true
+		}
+		var violations []string
+		for p := range config.Config.ExposedPorts {
+			if !allowed[normalizePort(p)] {
+				violations = append(violations, fmt.Sprintf("port %s is exposed but not allowed", p))
+			}
+		}
+		sort.Strings(violations)
+		check("allowedPorts", violations)
+	}
+	if len(ip.AllowedBaseRegistries) > 0 {
+		check("allowedBaseRegistries", checkBaseRegistry(manifest.Annotations[oci.BaseNameAnnotation], ip.AllowedBaseRegistries))
+	}
+	if ip.MaxSize != nil {
+		size := manifest.Config.Size
+		for _, l := range manifest.Layers {
+			size += l.Size
+		}
+		var violations []string
+		if size > ip.MaxSize.Value() {
+			violations = append(violations, fmt.Sprintf("image size %s exceeds maximum of %s", resource.NewQuantity(size, resource.BinarySI), ip.MaxSize))
+		}
+		check("maxSize", violations)
+	}
+	return results
+}
+
+func checkBaseRegistry(baseName string, allowed []string) []string {
+	if baseName == "" {
+		return []string{"base image could not be determined from the image annotations"}
+	}
+	ref, err := image.ParseReference(baseName)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	for _, a := range allowed {
+		if ref.MatchesPrefix(a) {
+			return nil
+		}
+	}
+	return []string{fmt.Sprintf("base image %s is not from an allowed registry (%s)", baseName, strings.Join(allowed, ", "))}
+}
+
+// isRootUser returns whether the image config user (user[:group]) denotes root.
+// An empty user defaults to root.
+func isRootUser(user string) bool {
+	u, _, _ := strings.Cut(user, ":")
+	return u == "" || u == "root" || u == "0"
+}
+
+func normalizePort(p string) string {
+	if !strings.Contains(p, "/") {
+		return p + "/tcp"
+	}
+	return strings.ToLower(p)
+}
+
+// checkImagePolicy checks the locally built image against the image policy
+// and writes the results as JUnit XML and JSON artifacts.
+func (p *packageImage) checkImagePolicy() error {
+	ip, err := readImagePolicy(filepath.Join(p.opts.checkoutDir, p.opts.imagePolicyFile))
+	if err != nil {
+		return err
+	}
+	l, err := p.openOCILayout()
+	if err != nil {
+		return err
+	}
+	manifest, _, err := l.Manifest(p.imageId.GitCommitSHA)
+	if err != nil {
+		return err
+	}
+	config, err := l.Config(manifest)
+	if err != nil {
+		return err
+	}
+	results := ip.evaluate(manifest, config)
+
+	suite := &junitTestSuite{Name: "image-policy"}
+	var violations []string
+	for _, r := range results {
+		suite.addTestCase(r.Rule, r.Message)
+		if !r.Passed {
+			violations = append(violations, fmt.Sprintf("- %s: %s", r.Rule, r.Message))
+		}
+	}
+	xunitDir := filepath.Join(p.opts.checkoutDir, pipelinectxt.XUnitReportsPath)
+	if err := suite.write(xunitDir, fmt.Sprintf("%s-image-policy.xml", p.imageNameNoSha())); err != nil {
+		return err
+	}
+	report := policyReport{Image: p.imageRef(), Digest: p.imageDigest, Results: results}
+	reportsDir := filepath.Join(p.opts.checkoutDir, imagePolicyReportsPath)
+	if err := pipelinectxt.WriteJsonArtifact(report, reportsDir, fmt.Sprintf("%s.json", p.imageNameNoSha())); err != nil {
+		return err
+	}
+	if len(violations) > 0 {
+		return fmt.Errorf("image violates policy:\n%s", strings.Join(violations, "\n"))
+	}
+	return nil
+}
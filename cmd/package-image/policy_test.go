@@ -0,0 +1,91 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/opendevstack/ods-pipeline-image/internal/oci"
+)
+
+func TestImagePolicyEvaluate(t *testing.T) {
+	policyFile := filepath.Join(t.TempDir(), "image-policy.yaml")
+	err := os.WriteFile(policyFile, []byte(`
+nonRootUser: true
+requiredLabels: [maintainer, org.opencontainers.image.source]
+allowedPorts: ["8080"]
+allowedBaseRegistries: [registry.access.redhat.com]
+maxSize: 1Ki
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ip, err := readImagePolicy(policyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		manifest oci.Manifest
+		config   oci.ImageConfig
+		want     []policyResult
+	}{
+		"compliant image": {
+			manifest: oci.Manifest{
+				Annotations: map[string]string{oci.BaseNameAnnotation: "registry.access.redhat.com/ubi8/ubi-minimal:8.9"},
+				Config:      oci.Descriptor{Size: 100},
+				Layers:      []oci.Descriptor{{Size: 500}},
+			},
+			config: oci.ImageConfig{Config: oci.ContainerConfig{
+				User:         "1001",
+				Labels:       map[string]string{"maintainer": "me", "org.opencontainers.image.source": "https://example.com"},
+				ExposedPorts: map[string]struct{}{"8080/tcp": {}},
+			}},
+			want: []policyResult{
+				{Rule: "nonRootUser", Passed: true},
+				{Rule: "requiredLabels", Passed: true},
+				{Rule: "allowedPorts", Passed: true},
+				{Rule: "allowedBaseRegistries", Passed: true},
+				{Rule: "maxSize", Passed: true},
+			},
+		},
+		"violating image": {
+			manifest: oci.Manifest{
+				Annotations: map[string]string{oci.BaseNameAnnotation: "ubuntu:latest"},
+				Config:      oci.Descriptor{Size: 100},
+				Layers:      []oci.Descriptor{{Size: 1000}},
+			},
+			config: oci.ImageConfig{Config: oci.ContainerConfig{
+				User:         "root:root",
+				Labels:       map[string]string{"maintainer": "me"},
+				ExposedPorts: map[string]struct{}{"8080/tcp": {}, "22/tcp": {}},
+			}},
+			want: []policyResult{
+				{Rule: "nonRootUser", Message: `image runs as root (user "root:root")`},
+				{Rule: "requiredLabels", Message: "label org.opencontainers.image.source is missing"},
+				{Rule: "allowedPorts", Message: "port 22/tcp is exposed but not allowed"},
+				{Rule: "allowedBaseRegistries", Message: "base image ubuntu:latest is not from an allowed registry (registry.access.redhat.com)"},
+				{Rule: "maxSize", Message: "image size 1100 exceeds maximum of 1Ki"},
+			},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := ip.evaluate(&tc.manifest, &tc.config)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Fatalf("results mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestReadImagePolicyUnknownField(t *testing.T) {
+	policyFile := filepath.Join(t.TempDir(), "image-policy.yaml")
+	if err := os.WriteFile(policyFile, []byte("nonRoot: true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readImagePolicy(policyFile); err == nil {
+		t.Fatal("want error for unknown field, got none")
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/opendevstack/ods-pipeline-image/internal/registry"
+	"github.com/opendevstack/ods-pipeline/pkg/artifact"
+	"github.com/opendevstack/ods-pipeline/pkg/logging"
+	"github.com/opendevstack/ods-pipeline/pkg/pipelinectxt"
+)
+
+type promoteOptions struct {
+	checkoutDir      string
+	sourceArtifact   string
+	registry         string
+	imageNamespace   string
+	imageStream      string
+	tag              string
+	artifactFilename string
+	certDir          string
+	tlsVerify        bool
+	debug            bool
+}
+
+type promoteImage struct {
+	logger logging.LeveledLoggerInterface
+	opts   promoteOptions
+	source *artifact.Image
+	target artifact.Image
+}
+
+// runPromote copies the image described by an image artifact, including its
+// signatures, attestations and SBOMs, into another registry or namespace
+// and writes an image artifact for the copy.
+func runPromote(args []string) error {
+	opts := promoteOptions{}
+	fs := flag.NewFlagSet("promote", flag.ExitOnError)
+	fs.StringVar(&opts.checkoutDir, "checkout-dir", defaultOptions.checkoutDir, "Checkout dir")
+	fs.StringVar(&opts.sourceArtifact, "source-artifact", "", "Image artifact JSON file describing the image to promote")
+	fs.StringVar(&opts.registry, "registry", "", "Registry to promote the image to. Defaults to the registry of the source image")
+	fs.StringVar(&opts.imageNamespace, "image-namespace", "", "Image namespace to promote the image to")
+	fs.StringVar(&opts.imageStream, "image-stream", "", "Image stream to promote the image to. Defaults to the image stream of the source image")
+	fs.StringVar(&opts.tag, "tag", "", "Tag of the promoted image. Defaults to the tag of the source image")
+	fs.StringVar(&opts.artifactFilename, "artifact-filename", "", "Filename of the image artifact written for the promoted image. Defaults to <image-stream>-<image-namespace>.json")
+	fs.StringVar(&opts.certDir, "cert-dir", defaultOptions.certDir, "Use certificates at the specified path to access the registry")
+	fs.BoolVar(&opts.tlsVerify, "tls-verify", defaultOptions.tlsVerify, "TLS verify")
+	fs.BoolVar(&opts.debug, "debug", defaultOptions.debug, "debug mode")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	p := &promoteImage{logger: newLogger(opts.debug), opts: opts}
+	if err := p.setTarget(); err != nil {
+		return err
+	}
+	if err := p.copyImage(); err != nil {
+		return err
+	}
+	return p.storeArtifact()
+}
+
+// setTarget reads the source image artifact and determines the target image
+// based on the options, falling back to the values of the source image.
+func (p *promoteImage) setTarget() error {
+	if p.opts.sourceArtifact == "" {
+		return errors.New("source-artifact must be set")
+	}
+	if p.opts.imageNamespace == "" {
+		return errors.New("image-namespace must be set")
+	}
+	source, err := artifact.ReadFromFile(p.opts.sourceArtifact)
+	if err != nil {
+		return fmt.Errorf("read source artifact: %w", err)
+	}
+	if source.Digest == "" {
+		return fmt.Errorf("source artifact %s does not specify a digest", p.opts.sourceArtifact)
+	}
+	p.source = source
+	p.target = promotedArtifactImage(*source, p.opts.registry, p.opts.imageNamespace, p.opts.imageStream, p.opts.tag)
+	return nil
+}
+
+// copyImage copies the source image by digest to the target image and
+// verifies that the digest is retained. Afterwards, the OCI referrers of the
+// image such as SBOMs are copied, which cosign does not copy.
+func (p *promoteImage) copyImage() error {
+	src := imageRef(*p.source)
+	p.logger.Infof("Promoting image %s to %s ...", src, p.target.Ref)
+	ra := newRegistryAccess(p.target.Registry, p.opts.tlsVerify, p.opts.certDir, p.opts.debug)
+	if err := NewCosignClient("").WithRegistryAccess(ra).Copy(src, p.target.Ref); err != nil {
+		return fmt.Errorf("copy image: %w", err)
+	}
+	d, err := skopeoInspectDigest(p.target.Ref, ra, os.Stderr)
+	if err != nil {
+		return fmt.Errorf("resolve digest of promoted image: %w", err)
+	}
+	if d != p.source.Digest {
+		return fmt.Errorf("digest of promoted image (%s) does not match digest of source image (%s)", d, p.source.Digest)
+	}
+	return p.copyReferrers()
+}
+
+// copyReferrers copies the OCI referrers of the source image to the target
+// image.
+func (p *promoteImage) copyReferrers() error {
+	srcHost, srcRepository := registryRepository(p.source.Registry, p.source.Repository, p.source.Name)
+	src, err := registry.NewClient(srcHost, registryTLSVerify(p.source.Registry, p.opts.tlsVerify), p.opts.certDir)
+	if err != nil {
+		return err
+	}
+	host, repository := registryRepository(p.target.Registry, p.target.Repository, p.target.Name)
+	dst, err := registry.NewClient(host, registryTLSVerify(p.target.Registry, p.opts.tlsVerify), p.opts.certDir)
+	if err != nil {
+		return err
+	}
+	copied, err := dst.CopyReferrers(src, srcRepository, repository, p.source.Digest)
+	if err != nil {
+		return fmt.Errorf("copy referrers: %w", err)
+	}
+	for _, d := range copied {
+		p.logger.Infof("Copied referrer %s (%s)", d.Digest, d.ArtifactType)
+	}
+	return nil
+}
+
+func (p *promoteImage) storeArtifact() error {
+	filename := p.opts.artifactFilename
+	if filename == "" {
+		filename = fmt.Sprintf("%s-%s.json", p.target.Name, p.target.Repository)
+	}
+	p.logger.Infof("Writing image artifact %s ...", filename)
+	return pipelinectxt.WriteJsonArtifact(p.target, filepath.Join(p.opts.checkoutDir, pipelinectxt.ImageDigestsPath), filename)
+}
+
+// promotedArtifactImage returns the artifact of source promoted to the given
+// location. Empty registry, imageStream and tag default to the values
+// of source.
+func promotedArtifactImage(source artifact.Image, registry, imageNamespace, imageStream, tag string) artifact.Image {
+	if registry == "" {
+		registry = source.Registry
+	}
+	if imageStream == "" {
+		imageStream = source.Name
+	}
+	if tag == "" {
+		tag = source.Tag
+	}
+	return artifact.Image{
+		Ref:        fmt.Sprintf("%s/%s/%s:%s", registry, imageNamespace, imageStream, tag),
+		Registry:   registry,
+		Repository: imageNamespace,
+		Name:       imageStream,
+		Tag:        tag,
+		Digest:     source.Digest,
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/opendevstack/ods-pipeline/pkg/artifact"
+)
+
+func TestPromotedArtifactImage(t *testing.T) {
+	source := artifact.Image{
+		Ref:        "registry.example.com/foo-dev/bar:abc",
+		Registry:   "registry.example.com",
+		Repository: "foo-dev",
+		Name:       "bar",
+		Tag:        "abc",
+		Digest:     "sha256:123",
+	}
+	tests := map[string]struct {
+		registry    string
+		imageStream string
+		tag         string
+		want        artifact.Image
+	}{
+		"defaults to source values": {
+			want: artifact.Image{
+				Ref:        "registry.example.com/foo-test/bar:abc",
+				Registry:   "registry.example.com",
+				Repository: "foo-test",
+				Name:       "bar",
+				Tag:        "abc",
+				Digest:     "sha256:123",
+			},
+		},
+		"with other registry, image stream and tag": {
+			registry:    "other.example.com",
+			imageStream: "baz",
+			tag:         "1.0.0",
+			want: artifact.Image{
+				Ref:        "other.example.com/foo-test/baz:1.0.0",
+				Registry:   "other.example.com",
+				Repository: "foo-test",
+				Name:       "baz",
+				Tag:        "1.0.0",
+				Digest:     "sha256:123",
+			},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := promotedArtifactImage(source, tc.registry, "foo-test", tc.imageStream, tc.tag)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Fatalf("artifact mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/opendevstack/ods-pipeline-image/internal/image"
+	"github.com/opendevstack/ods-pipeline-image/internal/oci"
+	"github.com/opendevstack/ods-pipeline/pkg/artifact"
+)
+
+// rebaseWorkdir is the OCI layout into which the source image and both base
+// images are copied to assemble the rebased image.
+const rebaseWorkdir = buildahWorkdir + "/rebase"
+
+// References of the images within the rebase workdir.
+const (
+	rebaseSourceRef  = "source"
+	rebaseOldBaseRef = "old-base"
+	rebaseNewBaseRef = "new-base"
+	rebaseResultRef  = "rebased"
+)
+
+type rebaseOptions struct {
+	sourceArtifact string
+	oldBase        string
+	newBase        string
+	tag            string
+}
+
+// rebaseImage holds the state of a rebase across package steps.
+type rebaseImage struct {
+	opts    rebaseOptions
+	source  *artifact.Image
+	oldBase string
+	newBase image.Reference
+}
+
+// runRebase creates a copy of the image described by an image artifact in
+// which the layers of its base image are replaced by the layers of an
+// updated base image, without rebuilding the image. The rebased image is
+// pushed under its own tag, gets an SBOM and a signature, and an image
+// artifact is written for it.
+func runRebase(args []string) error {
+	opts := defaultOptions
+	opts.registry = ""
+	r := &rebaseImage{}
+	fs := flag.NewFlagSet("rebase", flag.ExitOnError)
+	fs.StringVar(&opts.checkoutDir, "checkout-dir", defaultOptions.checkoutDir, "Checkout dir")
+	fs.StringVar(&r.opts.sourceArtifact, "source-artifact", "", "Image artifact JSON file describing the image to rebase")
+	fs.StringVar(&r.opts.oldBase, "old-base", "", "Base image the image is built on. Defaults to the base image recorded in the manifest annotations of the image")
+	fs.StringVar(&r.opts.newBase, "new-base", "", "Base image to rebase onto, either as digest within the repository of the old base image or as image reference")
+	fs.StringVar(&opts.registry, "registry", "", "Registry to push the rebased image to. Defaults to the registry of the source image")
+	fs.StringVar(&opts.imageNamespace, "image-namespace", "", "Image namespace to push the rebased image to. Defaults to the namespace of the source image")
+	fs.StringVar(&opts.imageStream, "image-stream", "", "Image stream to push the rebased image to. Defaults to the image stream of the source image")
+	fs.StringVar(&r.opts.tag, "tag", "", "Tag of the rebased image. Defaults to <source tag>-rebased-<first 12 characters of the new base digest>")
+	fs.StringVar(&opts.extraTags, "extra-tags", defaultOptions.extraTags, "Extra tags")
+	fs.StringVar(&opts.immutableTags, "immutable-tags", defaultOptions.immutableTags, "glob patterns of extra tags which must not be moved to another image once they exist")
+	fs.StringVar(&opts.trivySBOMExtraArgs, "trivy-sbom-extra-args", defaultOptions.trivySBOMExtraArgs, "extra parameters passed for the trivy command to generate an SBOM")
+	fs.StringVar(&opts.cosignKey, "cosign-key", defaultOptions.cosignKey, "cosign key to sign the image with")
+	fs.BoolVar(&opts.attachReferrers, "attach-referrers", defaultOptions.attachReferrers, "attach the SBOM to the rebased image as OCI referrer artifact")
+	fs.StringVar(&opts.certDir, "cert-dir", defaultOptions.certDir, "Use certificates at the specified path to access the registry")
+	fs.BoolVar(&opts.tlsVerify, "tls-verify", defaultOptions.tlsVerify, "TLS verify")
+	fs.BoolVar(&opts.debug, "debug", defaultOptions.debug, "debug mode")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	p := &packageImage{logger: newLogger(opts.debug), opts: opts, primary: true}
+	err := p.runSteps(
+		setExtraTags(),
+		r.setTarget(),
+		r.rebase(),
+		generateSBOM(),
+		pushOCILayout(),
+		verifyPushedDigest(),
+		signImage(p.opts.cosignKey),
+		attachReferrers(),
+		storeArtifact(),
+	)
+	if err != nil {
+		return err
+	}
+	return p.runSteps(processExtraTags())
+}
+
+// setTarget reads the source image artifact, copies the source image into
+// the rebase workdir, determines both base images and the identity of the
+// rebased image.
+func (r *rebaseImage) setTarget() PackageStep {
+	return func(p *packageImage) (*packageImage, error) {
+		if r.opts.sourceArtifact == "" {
+			return p, errors.New("source-artifact must be set")
+		}
+		if r.opts.newBase == "" {
+			return p, errors.New("new-base must be set")
+		}
+		source, err := artifact.ReadFromFile(r.opts.sourceArtifact)
+		if err != nil {
+			return p, fmt.Errorf("read source artifact: %w", err)
+		}
+		if source.Digest == "" {
+			return p, fmt.Errorf("source artifact %s does not specify a digest", r.opts.sourceArtifact)
+		}
+		r.source = source
+		if p.opts.registry == "" {
+			p.opts.registry = source.Registry
+		}
+		if p.opts.imageNamespace == "" {
+			p.opts.imageNamespace = source.Repository
+		}
+		if p.opts.imageStream == "" {
+			p.opts.imageStream = source.Name
+		}
+
+		if err := os.RemoveAll(rebaseWorkdir); err != nil {
+			return p, err
+		}
+		sourceAccess := newRegistryAccess(source.Registry, p.opts.tlsVerify, p.opts.certDir, p.opts.debug)
+		p.logger.Infof("Copying image %s ...", imageRef(*source))
+		if err := skopeoCopyToOCI(imageRef(*source), rebaseSourceRef, sourceAccess); err != nil {
+			return p, err
+		}
+		l, err := oci.Open(rebaseWorkdir)
+		if err != nil {
+			return p, err
+		}
+		m, _, err := l.Manifest(rebaseSourceRef)
+		if err != nil {
+			return p, err
+		}
+		oldBase, err := oldBaseImage(r.opts.oldBase, m.Annotations)
+		if err != nil {
+			return p, err
+		}
+		r.oldBase = oldBase
+		newBase, err := newBaseImage(r.opts.newBase, oldBase)
+		if err != nil {
+			return p, err
+		}
+		if newBase.Digest == "" {
+			ra := newRegistryAccess(newBase.Registry, p.opts.tlsVerify, p.opts.certDir, p.opts.debug)
+			d, err := skopeoInspectDigest(newBase.String(), ra, os.Stderr)
+			if err != nil {
+				return p, fmt.Errorf("resolve digest of new base image %s: %w", newBase, err)
+			}
+			newBase.Tag, newBase.Digest = "", d
+		}
+		r.newBase = newBase
+		p.logger.Infof("Rebasing from %s onto %s", r.oldBase, r.newBase)
+
+		tag := r.opts.tag
+		if tag == "" {
+			tag = rebasedTag(source.Tag, newBase.Digest)
+		}
+		// The identity is the one of a packaged image, with the tag of the
+		// rebased image in place of the Git commit SHA.
+		p.imageId = image.Identity{ImageNamespace: p.opts.imageNamespace, ImageStream: p.opts.imageStream, GitCommitSHA: tag}
+		return p, nil
+	}
+}
+
+// rebase copies both base images into the rebase workdir, swaps the base
+// layers of the source image and writes the result into the local OCI
+// layout of the image.
+func (r *rebaseImage) rebase() PackageStep {
+	return func(p *packageImage) (*packageImage, error) {
+		for _, b := range []struct{ ref, image string }{
+			{rebaseOldBaseRef, r.oldBase},
+			{rebaseNewBaseRef, r.newBase.String()},
+		} {
+			parsed, err := image.ParseReference(b.image)
+			if err != nil {
+				return p, err
+			}
+			ra := newRegistryAccess(parsed.Registry, p.opts.tlsVerify, p.opts.certDir, p.opts.debug)
+			p.logger.Infof("Copying base image %s ...", b.image)
+			if err := skopeoCopyToOCI(b.image, b.ref, ra); err != nil {
+				return p, err
+			}
+		}
+		l, err := oci.Open(rebaseWorkdir)
+		if err != nil {
+			return p, err
+		}
+		annotations := map[string]string{
+			oci.BaseNameAnnotation:   r.newBase.Name(),
+			oci.BaseDigestAnnotation: r.newBase.Digest,
+		}
+		desc, err := l.Rebase(rebaseSourceRef, rebaseOldBaseRef, rebaseNewBaseRef, rebaseResultRef, annotations)
+		if err != nil {
+			return p, fmt.Errorf("rebase %s: %w", imageRef(*r.source), err)
+		}
+		dir, err := p.ociLayoutDir()
+		if err != nil {
+			return p, err
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			return p, err
+		}
+		err = skopeoCopy(
+			fmt.Sprintf("oci:%s:%s", rebaseWorkdir, rebaseResultRef),
+			fmt.Sprintf("oci:%s:%s", dir, p.imageId.GitCommitSHA),
+			registryAccess{debug: p.opts.debug}, []string{"--preserve-digests"}, os.Stdout, os.Stderr,
+		)
+		if err != nil {
+			return p, err
+		}
+		p.imageDigest = desc.Digest
+		p.logger.Infof("Rebased image %s has digest %s", p.imageName(), p.imageDigest)
+		return p, nil
+	}
+}
+
+// pushOCILayout pushes the image from its local OCI layout to the registry,
+// retaining its digest.
+func pushOCILayout() PackageStep {
+	return func(p *packageImage) (*packageImage, error) {
+		fmt.Printf("Pushing image %s ...\n", p.imageName())
+		dir, err := p.ociLayoutDir()
+		if err != nil {
+			return p, err
+		}
+		err = skopeoCopy(
+			fmt.Sprintf("oci:%s:%s", dir, p.imageId.GitCommitSHA),
+			fmt.Sprintf("docker://%s", p.imageRef()),
+			p.registryAccess(), []string{"--preserve-digests"}, os.Stdout, os.Stderr,
+		)
+		if err != nil {
+			return p, fmt.Errorf("push: %w", err)
+		}
+		return p, nil
+	}
+}
+
+// skopeoCopyToOCI copies the image imageRef into the rebase workdir,
+// referenced by ref.
+func skopeoCopyToOCI(imageRef, ref string, ra registryAccess) error {
+	return skopeoCopy(
+		fmt.Sprintf("docker://%s", imageRef),
+		fmt.Sprintf("oci:%s:%s", rebaseWorkdir, ref),
+		ra, nil, os.Stdout, os.Stderr,
+	)
+}
+
+// oldBaseImage returns the reference of the base image an image is built on,
+// which is given explicitly or taken from the base image annotations of the
+// image manifest set by buildah.
+func oldBaseImage(given string, annotations map[string]string) (string, error) {
+	ref := given
+	if ref == "" {
+		ref = annotations[oci.BaseNameAnnotation]
+		if ref == "" {
+			return "", errors.New("old-base must be set as the image does not record its base image")
+		}
+	}
+	r, err := image.ParseReference(ref)
+	if err != nil {
+		return "", fmt.Errorf("old base image: %w", err)
+	}
+	if given == "" && r.Digest == "" {
+		r.Digest = annotations[oci.BaseDigestAnnotation]
+	}
+	if r.Digest != "" {
+		// Docker references must not have both tag and digest.
+		r.Tag = ""
+	}
+	return r.String(), nil
+}
+
+// newBaseImage returns the reference of the base image to rebase onto. A
+// given digest refers to the repository of the old base image.
+func newBaseImage(given, oldBase string) (image.Reference, error) {
+	if strings.HasPrefix(given, "sha256:") {
+		old, err := image.ParseReference(oldBase)
+		if err != nil {
+			return image.Reference{}, err
+		}
+		return image.Reference{Registry: old.Registry, Repository: old.Repository, Digest: given}, nil
+	}
+	r, err := image.ParseReference(given)
+	if err != nil {
+		return image.Reference{}, fmt.Errorf("new base image: %w", err)
+	}
+	if r.Digest != "" {
+		r.Tag = ""
+	}
+	return r, nil
+}
+
+// rebasedTag returns the default tag of the image with tag sourceTag rebased
+// onto the base image with given digest.
+func rebasedTag(sourceTag, baseDigest string) string {
+	_, hex, _ := strings.Cut(baseDigest, ":")
+	if len(hex) > 12 {
+		hex = hex[:12]
+	}
+	return fmt.Sprintf("%s-rebased-%s", sourceTag, hex)
+}
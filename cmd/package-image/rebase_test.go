@@ -0,0 +1,101 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/opendevstack/ods-pipeline-image/internal/image"
+	"github.com/opendevstack/ods-pipeline-image/internal/oci"
+)
+
+func TestOldBaseImage(t *testing.T) {
+	tests := map[string]struct {
+		given       string
+		annotations map[string]string
+		want        string
+		wantErr     bool
+	}{
+		"given": {
+			given: "registry.example.com/ubi9/ubi-minimal:9.3",
+			annotations: map[string]string{
+				oci.BaseNameAnnotation:   "registry.example.com/ubi9/ubi-minimal:9.2",
+				oci.BaseDigestAnnotation: "sha256:aaa",
+			},
+			want: "registry.example.com/ubi9/ubi-minimal:9.3",
+		},
+		"given with digest": {
+			given: "registry.example.com/ubi9/ubi-minimal:9.3@sha256:bbb",
+			want:  "registry.example.com/ubi9/ubi-minimal@sha256:bbb",
+		},
+		"from annotations": {
+			annotations: map[string]string{
+				oci.BaseNameAnnotation:   "registry.example.com/ubi9/ubi-minimal:9.3",
+				oci.BaseDigestAnnotation: "sha256:aaa",
+			},
+			want: "registry.example.com/ubi9/ubi-minimal@sha256:aaa",
+		},
+		"from annotations without digest": {
+			annotations: map[string]string{oci.BaseNameAnnotation: "alpine:3.19"},
+			want:        "docker.io/library/alpine:3.19",
+		},
+		"not recorded": {
+			wantErr: true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := oldBaseImage(tc.given, tc.annotations)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("want error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Fatalf("want %s, got %s", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestNewBaseImage(t *testing.T) {
+	tests := map[string]struct {
+		given string
+		want  image.Reference
+	}{
+		"digest": {
+			given: "sha256:ccc",
+			want:  image.Reference{Registry: "registry.example.com", Repository: "ubi9/ubi-minimal", Digest: "sha256:ccc"},
+		},
+		"reference with tag": {
+			given: "registry.example.com/ubi9/ubi-minimal:9.4",
+			want:  image.Reference{Registry: "registry.example.com", Repository: "ubi9/ubi-minimal", Tag: "9.4"},
+		},
+		"reference with tag and digest": {
+			given: "registry.example.com/ubi9/ubi-minimal:9.4@sha256:ccc",
+			want:  image.Reference{Registry: "registry.example.com", Repository: "ubi9/ubi-minimal", Digest: "sha256:ccc"},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := newBaseImage(tc.given, "registry.example.com/ubi9/ubi-minimal@sha256:aaa")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Fatalf("reference mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRebasedTag(t *testing.T) {
+	got := rebasedTag("0123456789012345678901234567890123456789", "sha256:3d4c2a1b0f9e8d7c6b5a49382716")
+	want := "0123456789012345678901234567890123456789-rebased-3d4c2a1b0f9e"
+	if got != want {
+		t.Fatalf("want %s, got %s", want, got)
+	}
+}
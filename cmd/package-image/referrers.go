@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/opendevstack/ods-pipeline-image/internal/oci"
+	"github.com/opendevstack/ods-pipeline-image/internal/registry"
+)
+
+// sbomArtifactType is the artifact type of SBOMs in SPDX tag-value format
+// attached to images.
+const sbomArtifactType = "text/spdx"
+
+// referrerArtifact is a file attached to the image as OCI artifact.
+type referrerArtifact struct {
+	// name describes the artifact in log messages.
+	name         string
+	artifactType string
+	mediaType    string
+	file         string
+}
+
+// referrerArtifacts returns the artifacts to attach to the image.
+func (p *packageImage) referrerArtifacts() []referrerArtifact {
+	var artifacts []referrerArtifact
+	if p.sbomFile != "" {
+		artifacts = append(artifacts, referrerArtifact{
+			name:         "SBOM",
+			artifactType: sbomArtifactType,
+			mediaType:    sbomArtifactType,
+			file:         p.sbomFile,
+		})
+	}
+	if p.vulnReportFile != "" {
+		artifacts = append(artifacts, referrerArtifact{
+			name:         "vulnerability report",
+			artifactType: vulnArtifactType,
+			mediaType:    "application/json",
+			file:         p.vulnReportFile,
+		})
+	}
+	return artifacts
+}
+
+// attachReferrers pushes the referrer artifacts of the image into its
+// repository, each with the image manifest as subject. Registries without
+// support for the referrers API get the artifacts listed in the index tagged
+// sha256-<hex of image digest> instead.
+func (p *packageImage) attachReferrers() error {
+	host, repository := registryRepository(p.opts.registry, p.imageId.ImageNamespace, p.imageId.ImageStream)
+	c, err := registry.NewClient(host, registryTLSVerify(p.opts.registry, p.opts.tlsVerify), p.opts.certDir)
+	if err != nil {
+		return err
+	}
+	_, subject, err := c.Manifest(repository, p.imageDigest)
+	if err != nil {
+		return fmt.Errorf("get manifest of %s: %w", p.imageName(), err)
+	}
+	annotations := map[string]string{oci.CreatedAnnotation: time.Now().UTC().Format(time.RFC3339)}
+	for _, a := range p.referrerArtifacts() {
+		content, err := os.ReadFile(a.file)
+		if err != nil {
+			return fmt.Errorf("read %s: %w", a.name, err)
+		}
+		desc, err := c.Attach(repository, subject, a.artifactType, a.mediaType, filepath.Base(a.file), content, annotations)
+		if err != nil {
+			return fmt.Errorf("attach %s: %w", a.name, err)
+		}
+		p.logger.Infof("Attached %s to %s as %s@%s", a.name, p.imageName(), repository, desc.Digest)
+	}
+	return nil
+}
+
+// registryRepository returns the host of registry and the repository of the
+// image stream in namespace within it. registry may contain a path, which
+// prefixes the repository.
+func registryRepository(registry, namespace, stream string) (string, string) {
+	host, prefix, _ := strings.Cut(registry, "/")
+	repository := fmt.Sprintf("%s/%s", namespace, stream)
+	if prefix != "" {
+		repository = fmt.Sprintf("%s/%s", strings.Trim(prefix, "/"), repository)
+	}
+	return host, repository
+}
@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestRegistryRepository(t *testing.T) {
+	tests := map[string]struct {
+		registry       string
+		wantHost       string
+		wantRepository string
+	}{
+		"host only": {
+			registry:       "image-registry.openshift-image-registry.svc:5000",
+			wantHost:       "image-registry.openshift-image-registry.svc:5000",
+			wantRepository: "foo-cd/app",
+		},
+		"host with path": {
+			registry:       "harbor.example.com/ods/",
+			wantHost:       "harbor.example.com",
+			wantRepository: "ods/foo-cd/app",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			host, repository := registryRepository(tc.registry, "foo-cd", "app")
+			if host != tc.wantHost || repository != tc.wantRepository {
+				t.Fatalf("want %s and %s, got %s and %s", tc.wantHost, tc.wantRepository, host, repository)
+			}
+		})
+	}
+}
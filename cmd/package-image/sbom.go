@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/opendevstack/ods-pipeline-image/internal/spdx"
+)
+
+// checkSBOM parses the generated SBOM, validates it against the image in the
+// local OCI layout and logs a summary of the packages it lists.
+func (p *packageImage) checkSBOM() error {
+	doc, err := spdx.ReadFile(p.sbomFile)
+	if err != nil {
+		return fmt.Errorf("parse SBOM: %w", err)
+	}
+	l, err := p.openOCILayout()
+	if err != nil {
+		return err
+	}
+	m, _, err := l.Manifest(p.imageId.GitCommitSHA)
+	if err != nil {
+		return err
+	}
+	if err := validateSBOM(doc, m.Config.Digest, p.imageDigest); err != nil {
+		return fmt.Errorf("invalid SBOM %s: %w", p.sbomFile, err)
+	}
+	p.sbom = doc
+	p.logger.Infof("SBOM of %s lists %s", p.imageName(), sbomSummary(doc))
+	return nil
+}
+
+// validateSBOM checks that doc has a namespace and creator info, lists at
+// least one package besides the image itself, and refers to the image by its
+// config digest (image ID) or manifest digest.
+func validateSBOM(doc *spdx.Document, configDigest, manifestDigest string) error {
+	var problems []string
+	if doc.SPDXVersion == "" {
+		problems = append(problems, "no SPDX version")
+	}
+	if doc.DocumentNamespace == "" {
+		problems = append(problems, "no document namespace")
+	}
+	if len(doc.Creators) == 0 {
+		problems = append(problems, "no creator")
+	}
+	if len(sbomPackages(doc)) == 0 {
+		problems = append(problems, "no packages")
+	}
+	if !sbomRefersTo(doc, configDigest, manifestDigest) {
+		problems = append(problems, fmt.Sprintf("no reference to image %s", manifestDigest))
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// sbomPackages returns the packages of doc, without the package describing
+// the image itself.
+func sbomPackages(doc *spdx.Document) []spdx.Package {
+	var pkgs []spdx.Package
+	for _, pkg := range doc.Packages {
+		if pkg.Purpose != spdx.PurposeContainer {
+			pkgs = append(pkgs, pkg)
+		}
+	}
+	return pkgs
+}
+
+// sbomRefersTo returns whether the image package of doc names the config
+// digest as image ID, or the manifest digest as repo digest or within its
+// package URL.
+func sbomRefersTo(doc *spdx.Document, configDigest, manifestDigest string) bool {
+	for _, pkg := range doc.Packages {
+		if pkg.Purpose != spdx.PurposeContainer {
+			continue
+		}
+		for _, text := range pkg.AttributionTexts {
+			key, value, _ := strings.Cut(text, ":")
+			value = strings.TrimSpace(value)
+			switch key {
+			case "ImageID":
+				if value == configDigest {
+					return true
+				}
+			case "RepoDigest":
+				if strings.HasSuffix(value, "@"+manifestDigest) {
+					return true
+				}
+			}
+		}
+		if strings.Contains(pkg.PURL, strings.Replace(manifestDigest, ":", "%3A", 1)) {
+			return true
+		}
+	}
+	return false
+}
+
+// sbomSummary describes the number of packages of doc by purpose, e.g.
+// "42 packages (40 LIBRARY, 1 OPERATING-SYSTEM, 1 APPLICATION)".
+func sbomSummary(doc *spdx.Document) string {
+	pkgs := sbomPackages(doc)
+	counts := map[string]int{}
+	for _, pkg := range pkgs {
+		purpose := pkg.Purpose
+		if purpose == "" {
+			purpose = "OTHER"
+		}
+		counts[purpose]++
+	}
+	var purposes []string
+	for purpose := range counts {
+		purposes = append(purposes, purpose)
+	}
+	sort.Slice(purposes, func(i, j int) bool {
+		if counts[purposes[i]] != counts[purposes[j]] {
+			return counts[purposes[i]] > counts[purposes[j]]
+		}
+		return purposes[i] < purposes[j]
+	})
+	var parts []string
+	for _, purpose := range purposes {
+		parts = append(parts, fmt.Sprintf("%d %s", counts[purpose], purpose))
+	}
+	return fmt.Sprintf("%d packages (%s)", len(pkgs), strings.Join(parts, ", "))
+}
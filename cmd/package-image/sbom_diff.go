@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/opendevstack/ods-pipeline-image/internal/oci"
+	"github.com/opendevstack/ods-pipeline-image/internal/registry"
+	"github.com/opendevstack/ods-pipeline-image/internal/spdx"
+	"github.com/opendevstack/ods-pipeline/pkg/pipelinectxt"
+)
+
+const (
+	// sbomDiffsPath is the artifacts path of SBOM diff reports.
+	sbomDiffsPath = pipelinectxt.ArtifactsPath + "/sbom-diffs"
+	// spdxPredicateType is the in-toto predicate type of SBOM attestations
+	// created by cosign attest --type spdx.
+	spdxPredicateType = "https://spdx.dev/Document"
+)
+
+// sbomDiffReport is the artifact comparing the SBOM of the image with the
+// SBOM of the previously published image.
+type sbomDiffReport struct {
+	Image         string `json:"image"`
+	PreviousImage string `json:"previousImage"`
+	// PreviousSBOMSource is "referrer" or "attestation".
+	PreviousSBOMSource string `json:"previousSBOMSource"`
+	spdx.Diff
+}
+
+// diffSBOM compares the SBOM of the image with the SBOM of the image tagged
+// with the SBOM diff tag in the same repository, and writes the differences
+// as artifact. Without previous image or SBOM, nothing is compared.
+func (p *packageImage) diffSBOM() error {
+	host, repository := registryRepository(p.opts.registry, p.imageId.ImageNamespace, p.imageId.ImageStream)
+	c, err := registry.NewClient(host, registryTLSVerify(p.opts.registry, p.opts.tlsVerify), p.opts.certDir)
+	if err != nil {
+		return err
+	}
+	_, desc, err := c.Manifest(repository, p.opts.sbomDiffTag)
+	if errors.Is(err, registry.ErrNotFound) {
+		p.logger.Infof("No image %s/%s:%s, skipping SBOM diff", host, repository, p.opts.sbomDiffTag)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("get previous image: %w", err)
+	}
+	previousRef := fmt.Sprintf("%s/%s@%s", host, repository, desc.Digest)
+	previous, source, err := p.previousSBOM(c, repository, previousRef)
+	if err != nil {
+		return err
+	}
+	if previous == nil {
+		p.logger.Warnf("No SBOM found for %s, skipping SBOM diff", previousRef)
+		return nil
+	}
+	report := sbomDiffReport{
+		Image:              imageRef(p.artifactImage()),
+		PreviousImage:      previousRef,
+		PreviousSBOMSource: source,
+		Diff:               spdx.Compare(previous, p.sbom),
+	}
+	p.logger.Infof("Compared SBOM with SBOM %s of %s (tag %s):\n%s", source, previousRef, p.opts.sbomDiffTag, formatSBOMDiff(report.Diff))
+	return pipelinectxt.WriteJsonArtifact(report, filepath.Join(p.opts.checkoutDir, sbomDiffsPath), fmt.Sprintf("%s.json", p.imageNameNoSha()))
+}
+
+// previousSBOM returns the SBOM of the image previousRef and its source. The
+// SBOM is taken from a referrer artifact, or from the SBOM attestation if
+// there is none. If neither exists, a nil document is returned.
+func (p *packageImage) previousSBOM(c *registry.Client, repository, previousRef string) (*spdx.Document, string, error) {
+	_, digest, _ := strings.Cut(previousRef, "@")
+	referrers, err := c.Referrers(repository, digest, sbomArtifactType)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(referrers) > 0 {
+		// Use the most recently attached SBOM.
+		sort.SliceStable(referrers, func(i, j int) bool {
+			return referrers[i].Annotations[oci.CreatedAnnotation] > referrers[j].Annotations[oci.CreatedAnnotation]
+		})
+		content, err := c.ArtifactContent(repository, referrers[0])
+		if err != nil {
+			return nil, "", fmt.Errorf("get SBOM referrer of %s: %w", previousRef, err)
+		}
+		doc, err := spdx.Parse(bytes.NewReader(content))
+		if err != nil {
+			return nil, "", fmt.Errorf("parse SBOM referrer of %s: %w", previousRef, err)
+		}
+		return doc, "referrer", nil
+	}
+	attestations, err := NewCosignClient("").WithRegistryAccess(p.registryAccess()).DownloadAttestations(previousRef, spdxPredicateType)
+	if err != nil {
+		p.logger.Debugf("Could not download SBOM attestation of %s: %s", previousRef, err)
+		return nil, "", nil
+	}
+	doc, err := sbomFromAttestations(attestations)
+	if err != nil {
+		return nil, "", fmt.Errorf("read SBOM attestation of %s: %w", previousRef, err)
+	}
+	if doc == nil {
+		return nil, "", nil
+	}
+	return doc, "attestation", nil
+}
+
+// sbomFromAttestations returns the SPDX tag-value SBOM of the last of the
+// attestations (DSSE envelopes, one per line), or nil if none holds one.
+func sbomFromAttestations(attestations []byte) (*spdx.Document, error) {
+	var doc *spdx.Document
+	scanner := bufio.NewScanner(bytes.NewReader(attestations))
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var envelope struct {
+			Payload string `json:"payload"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &envelope); err != nil {
+			return nil, fmt.Errorf("parse envelope: %w", err)
+		}
+		payload, err := base64.StdEncoding.DecodeString(envelope.Payload)
+		if err != nil {
+			return nil, fmt.Errorf("decode payload: %w", err)
+		}
+		var statement struct {
+			PredicateType string          `json:"predicateType"`
+			Predicate     json.RawMessage `json:"predicate"`
+		}
+		if err := json.Unmarshal(payload, &statement); err != nil {
+			return nil, fmt.Errorf("parse statement: %w", err)
+		}
+		// cosign attest --type spdx stores the tag-value document as string.
+		var content string
+		if statement.PredicateType != spdxPredicateType || json.Unmarshal(statement.Predicate, &content) != nil {
+			continue
+		}
+		d, err := spdx.Parse(strings.NewReader(content))
+		if err != nil {
+			return nil, err
+		}
+		doc = d
+	}
+	return doc, scanner.Err()
+}
+
+// formatSBOMDiff describes the changed packages of d line by line.
+func formatSBOMDiff(d spdx.Diff) string {
+	if d.Empty() {
+		return "No packages added, removed or changed"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d added, %d removed, %d changed", len(d.Added), len(d.Removed), len(d.Changed))
+	for _, c := range d.Added {
+		fmt.Fprintf(&b, "\n+ %s %s (%s)", c.Name, c.NewVersion, c.NewLicense)
+	}
+	for _, c := range d.Removed {
+		fmt.Fprintf(&b, "\n- %s %s (%s)", c.Name, c.OldVersion, c.OldLicense)
+	}
+	for _, c := range d.Changed {
+		change := fmt.Sprintf("%s -> %s", c.OldVersion, c.NewVersion)
+		if c.OldVersion == c.NewVersion {
+			change = c.NewVersion
+		}
+		license := fmt.Sprintf("%s -> %s", c.OldLicense, c.NewLicense)
+		if c.OldLicense == c.NewLicense {
+			license = c.NewLicense
+		}
+		fmt.Fprintf(&b, "\n~ %s %s (%s)", c.Name, change, license)
+	}
+	return b.String()
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/opendevstack/ods-pipeline-image/internal/spdx"
+)
+
+func TestSBOMFromAttestations(t *testing.T) {
+	envelope := func(predicateType string, predicate interface{}) string {
+		statement, err := json.Marshal(map[string]interface{}{
+			"_type":         "https://in-toto.io/Statement/v0.1",
+			"predicateType": predicateType,
+			"predicate":     predicate,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fmt.Sprintf(`{"payloadType":"application/vnd.in-toto+json","payload":%q,"signatures":[]}`, base64.StdEncoding.EncodeToString(statement))
+	}
+	tests := map[string]struct {
+		attestations string
+		wantPackages []string
+	}{
+		"no attestations": {
+			attestations: "",
+		},
+		"other predicate type": {
+			attestations: envelope("https://cosign.sigstore.dev/attestation/vuln/v1", map[string]string{"scanner": "trivy"}),
+		},
+		"SPDX JSON predicate": {
+			attestations: envelope(spdxPredicateType, map[string]string{"spdxVersion": "SPDX-2.3"}),
+		},
+		"last SPDX attestation wins": {
+			attestations: envelope(spdxPredicateType, "SPDXVersion: SPDX-2.3\nPackageName: old\n") + "\n" +
+				envelope(spdxPredicateType, "SPDXVersion: SPDX-2.3\nPackageName: zlib\nPackageName: openssl-libs\n") + "\n",
+			wantPackages: []string{"zlib", "openssl-libs"},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			doc, err := sbomFromAttestations([]byte(tc.attestations))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.wantPackages == nil {
+				if doc != nil {
+					t.Fatalf("want no SBOM, got %v", doc)
+				}
+				return
+			}
+			if doc == nil {
+				t.Fatal("want SBOM, got none")
+			}
+			var got []string
+			for _, pkg := range doc.Packages {
+				got = append(got, pkg.Name)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tc.wantPackages) {
+				t.Fatalf("want packages %v, got %v", tc.wantPackages, got)
+			}
+		})
+	}
+}
+
+func TestFormatSBOMDiff(t *testing.T) {
+	d := spdx.Diff{
+		Added:   []spdx.PackageChange{{Name: "slf4j-api", NewVersion: "2.0.9", NewLicense: "MIT"}},
+		Removed: []spdx.PackageChange{{Name: "commons-io", OldVersion: "2.11.0", OldLicense: "Apache-2.0"}},
+		Changed: []spdx.PackageChange{
+			{Name: "jackson-databind", OldVersion: "2.15.0", NewVersion: "2.15.0", OldLicense: "Apache-2.0", NewLicense: "MIT"},
+			{Name: "openssl-libs", OldVersion: "3.0.7-24.el9", NewVersion: "3.0.7-25.el9", OldLicense: "Apache-2.0", NewLicense: "Apache-2.0"},
+		},
+	}
+	want := `1 added, 1 removed, 2 changed
++ slf4j-api 2.0.9 (MIT)
+- commons-io 2.11.0 (Apache-2.0)
+~ jackson-databind 2.15.0 (Apache-2.0 -> MIT)
+~ openssl-libs 3.0.7-24.el9 -> 3.0.7-25.el9 (Apache-2.0)`
+	if got := formatSBOMDiff(d); got != want {
+		t.Fatalf("want:\n%s\ngot:\n%s", want, got)
+	}
+	if got := formatSBOMDiff(spdx.Diff{}); got != "No packages added, removed or changed" {
+		t.Fatalf("unexpected description of empty diff: %s", got)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/opendevstack/ods-pipeline-image/internal/spdx"
+)
+
+func TestValidateSBOM(t *testing.T) {
+	imagePackage := spdx.Package{
+		Name:             "app",
+		Purpose:          spdx.PurposeContainer,
+		AttributionTexts: []string{"SchemaVersion: 2", "ImageID: sha256:config"},
+	}
+	library := spdx.Package{Name: "openssl-libs", Version: "3.0.7", Purpose: "LIBRARY"}
+	valid := func() *spdx.Document {
+		return &spdx.Document{
+			SPDXVersion:       "SPDX-2.3",
+			DocumentNamespace: "http://aquasecurity.github.io/trivy/container_image/app-1234",
+			Creators:          []string{"Tool: trivy-0.47.0"},
+			Packages:          []spdx.Package{imagePackage, library},
+		}
+	}
+	tests := map[string]struct {
+		modify  func(doc *spdx.Document)
+		wantErr string
+	}{
+		"valid": {
+			modify: func(doc *spdx.Document) {},
+		},
+		"empty": {
+			modify: func(doc *spdx.Document) {
+				*doc = spdx.Document{}
+			},
+			wantErr: "no SPDX version, no document namespace, no creator, no packages, no reference to image sha256:manifest",
+		},
+		"only image package": {
+			modify: func(doc *spdx.Document) {
+				doc.Packages = []spdx.Package{imagePackage}
+			},
+			wantErr: "no packages",
+		},
+		"other image": {
+			modify: func(doc *spdx.Document) {
+				doc.Packages[0].AttributionTexts = []string{"ImageID: sha256:other"}
+			},
+			wantErr: "no reference to image sha256:manifest",
+		},
+		"repo digest": {
+			modify: func(doc *spdx.Document) {
+				doc.Packages[0].AttributionTexts = []string{"RepoDigest: registry.example.com/foo/app@sha256:manifest"}
+			},
+		},
+		"package URL": {
+			modify: func(doc *spdx.Document) {
+				doc.Packages[0].AttributionTexts = nil
+				doc.Packages[0].PURL = "pkg:oci/app@sha256%3Amanifest?repository_url=registry.example.com%2Ffoo%2Fapp"
+			},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			doc := valid()
+			tc.modify(doc)
+			err := validateSBOM(doc, "sha256:config", "sha256:manifest")
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tc.wantErr {
+				t.Fatalf("want error %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestSBOMSummary(t *testing.T) {
+	doc := &spdx.Document{Packages: []spdx.Package{
+		{Name: "app", Purpose: spdx.PurposeContainer},
+		{Name: "rhel", Purpose: "OPERATING-SYSTEM"},
+		{Name: "openssl-libs", Purpose: "LIBRARY"},
+		{Name: "zlib", Purpose: "LIBRARY"},
+		{Name: "unknown"},
+	}}
+	want := "4 packages (2 LIBRARY, 1 OPERATING-SYSTEM, 1 OTHER)"
+	if got := sbomSummary(doc); got != want {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/opendevstack/ods-pipeline-image/internal/oci"
+)
+
+const (
+	// secretScanNone disables the secret scan.
+	secretScanNone = "none"
+	// secretScanHistory scans the image config and history.
+	secretScanHistory = "history"
+	// secretScanLayers scans the image config and history, and the files in
+	// the layers with the trivy secret scanner as part of the content scan.
+	secretScanLayers = "layers"
+)
+
+// minSecretValueLength is the minimum length of build arg values which are
+// searched for. Shorter values would result in too many false positives.
+const minSecretValueLength = 4
+
+var (
+	// credentialPatterns match well-known credential formats.
+	credentialPatterns = []namedPattern{
+		{"private key", regexp.MustCompile(`-----BEGIN ((RSA|DSA|EC|OPENSSH|ENCRYPTED|PGP) )?PRIVATE KEY( BLOCK)?-----`)},
+		{"AWS access key ID", regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`)},
+		{"GitHub token", regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`)},
+		{"GitLab token", regexp.MustCompile(`\bglpat-[A-Za-z0-9_-]{20,}\b`)},
+		{"Slack token", regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}\b`)},
+		{"URL with credentials", regexp.MustCompile(`\b[a-zA-Z][a-zA-Z0-9+.-]*://[^/\s:@'"]+:[^/\s@'"]+@[^/\s'"]+`)},
+	}
+)
+
+// secretNameWords are the words of names of build args and environment
+// variables which carry secrets.
+var secretNameWords = map[string]bool{
+	"pass": true, "passwd": true, "password": true, "passwords": true, "pwd": true,
+	"secret": true, "secrets": true, "token": true, "tokens": true, "auth": true,
+	"credential": true, "credentials": true, "apikey": true, "accesskey": true, "privatekey": true,
+}
+
+// secretKeyQualifiers are the words preceding "key" in names of build args
+// and environment variables which carry secrets, e.g. API_KEY.
+var secretKeyQualifiers = map[string]bool{"api": true, "access": true, "private": true}
+
+// isSecretName returns whether the name of a build arg or environment
+// variable indicates that it carries a secret. Names are split into words at
+// separators and camel case boundaries, so that e.g. NPM_TOKEN and
+// nexusPassword match, but AUTHOR or BYPASS_PROXY do not.
+func isSecretName(name string) bool {
+	words := nameWords(name)
+	for i, w := range words {
+		if secretNameWords[w] {
+			return true
+		}
+		if (w == "key" || w == "keys") && i > 0 && secretKeyQualifiers[words[i-1]] {
+			return true
+		}
+	}
+	return false
+}
+
+// nameWords splits name into lower case words at non-alphanumeric characters
+// and camel case boundaries (e.g. "nexusUrlWithAuth" and "NEXUS_URL_WITH_AUTH"
+// into "nexus", "url", "with", "auth").
+func nameWords(name string) []string {
+	var words []string
+	var word []rune
+	runes := []rune(name)
+	flush := func() {
+		if len(word) > 0 {
+			words = append(words, strings.ToLower(string(word)))
+			word = nil
+		}
+	}
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			flush()
+			continue
+		}
+		if unicode.IsUpper(r) && i > 0 {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				flush()
+			}
+		}
+		word = append(word, r)
+	}
+	flush()
+	return words
+}
+
+type namedPattern struct {
+	name    string
+	pattern *regexp.Regexp
+}
+
+// secretMatcher finds secret values and well-known credentials in text.
+type secretMatcher struct {
+	// values maps secret values to a description of their origin.
+	values   map[string]string
+	patterns []namedPattern
+}
+
+// secretFinding describes a location in the image containing a secret.
+type secretFinding struct {
+	location string
+	secrets  []string
+}
+
+func (f secretFinding) String() string {
+	return fmt.Sprintf("%s contains %s", f.location, strings.Join(f.secrets, ", "))
+}
+
+func newSecretMatcher(values map[string]string) secretMatcher {
+	v := map[string]string{}
+	for value, origin := range values {
+		if len(value) >= minSecretValueLength {
+			v[value] = origin
+		}
+	}
+	return secretMatcher{values: v, patterns: credentialPatterns}
+}
+
+// find returns a description of each secret found in s.
+func (m secretMatcher) find(s string) []string {
+	var found []string
+	for value, origin := range m.values {
+		if strings.Contains(s, value) {
+			found = append(found, origin)
+		}
+	}
+	for _, p := range m.patterns {
+		if p.pattern.MatchString(s) {
+			found = append(found, p.name)
+		}
+	}
+	sort.Strings(found)
+	return found
+}
+
+// mask replaces all secrets in s so that s can be logged.
+func (m secretMatcher) mask(s string) string {
+	for value := range m.values {
+		s = strings.ReplaceAll(s, value, "***")
+	}
+	for _, p := range m.patterns {
+		s = p.pattern.ReplaceAllString(s, "***")
+	}
+	return s
+}
+
+// secretBuildArgs returns the values of all secret-bearing build args passed
+// to buildah, mapped to a description of their origin.
+func (p *packageImage) secretBuildArgs() (map[string]string, error) {
+	args, err := p.buildahBuildArgs(p.imageRef())
+	if err != nil {
+		return nil, err
+	}
+	return p.secretBuildArgValues(args), nil
+}
+
+// secretBuildArgValues returns the values of the secret-bearing build args in
+// the buildah arguments args, mapped to a description of their origin.
+func (p *packageImage) secretBuildArgValues(args []string) map[string]string {
+	values := map[string]string{}
+	for name, value := range buildArgsFromArgs(args) {
+		if isSecretName(name) {
+			values[value] = fmt.Sprintf("value of build arg %s", name)
+		}
+	}
+	if p.opts.nexusPassword != "" {
+		values[p.opts.nexusPassword] = "Nexus password"
+	}
+	return values
+}
+
+// buildArgsFromArgs extracts the build args from the given buildah arguments.
+// Both "--build-arg=KEY=VALUE" and "--build-arg KEY=VALUE" are supported. A
+// build arg given as KEY only takes its value from the environment, like
+// buildah does.
+func buildArgsFromArgs(args []string) map[string]string {
+	buildArgs := map[string]string{}
+	for i := 0; i < len(args); i++ {
+		var kv string
+		if strings.HasPrefix(args[i], "--build-arg=") {
+			kv = strings.TrimPrefix(args[i], "--build-arg=")
+		} else if args[i] == "--build-arg" && i+1 < len(args) {
+			i++
+			kv = args[i]
+		} else {
+			continue
+		}
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			buildArgs[k] = v
+		} else {
+			buildArgs[kv] = os.Getenv(kv)
+		}
+	}
+	return buildArgs
+}
+
+// scanImageForSecrets searches the config and history of the image with
+// given reference in layout l for secrets. The files contained in the layers
+// are scanned by trivy, see scanImageContent.
+func scanImageForSecrets(l *oci.Layout, ref string, m secretMatcher) ([]secretFinding, error) {
+	manifest, _, err := l.Manifest(ref)
+	if err != nil {
+		return nil, err
+	}
+	config, err := l.Config(manifest)
+	if err != nil {
+		return nil, err
+	}
+	var findings []secretFinding
+	add := func(location, s string) {
+		if found := m.find(s); len(found) > 0 {
+			findings = append(findings, secretFinding{location: location, secrets: found})
+		}
+	}
+	for i, h := range config.History {
+		add(fmt.Sprintf("history entry %d (%s)", i+1, m.mask(h.CreatedBy)), h.CreatedBy+"\n"+h.Comment)
+	}
+	for _, e := range config.Config.Env {
+		name, _, _ := strings.Cut(e, "=")
+		add(fmt.Sprintf("environment variable %s", name), e)
+	}
+	labels := make([]string, 0, len(config.Config.Labels))
+	for k := range config.Config.Labels {
+		labels = append(labels, k)
+	}
+	sort.Strings(labels)
+	for _, k := range labels {
+		add(fmt.Sprintf("label %s", k), config.Config.Labels[k])
+	}
+	add("entrypoint", strings.Join(config.Config.Entrypoint, " "))
+	add("cmd", strings.Join(config.Config.Cmd, " "))
+	return findings, nil
+}
+
+// checkForSecrets inspects the config and history of the locally built image
+// for leaked secrets, unless the secret scan is disabled.
+func (p *packageImage) checkForSecrets() error {
+	switch p.opts.secretScan {
+	case secretScanNone:
+		return nil
+	case secretScanHistory, secretScanLayers:
+	default:
+		return fmt.Errorf("unknown secret scan mode %q, must be one of %q, %q or %q", p.opts.secretScan, secretScanNone, secretScanHistory, secretScanLayers)
+	}
+	values, err := p.secretBuildArgs()
+	if err != nil {
+		return fmt.Errorf("determine secret build args: %w", err)
+	}
+	l, err := p.openOCILayout()
+	if err != nil {
+		return err
+	}
+	m := newSecretMatcher(values)
+	findings, err := scanImageForSecrets(l, p.imageId.GitCommitSHA, m)
+	if err != nil {
+		return err
+	}
+	if len(findings) > 0 {
+		lines := make([]string, len(findings))
+		for i, f := range findings {
+			lines[i] = "- " + f.String()
+		}
+		return fmt.Errorf("image contains secrets:\n%s", strings.Join(lines, "\n"))
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// skopeoCopy copies the image source to destination, given as references
+// with transport such as docker:// or oci:. Registry access settings apply to
+// references with docker transport.
+func skopeoCopy(source, destination string, ra registryAccess, extraArgs []string, outWriter, errWriter io.Writer) error {
+	args := []string{"copy"}
+	for _, s := range []struct{ side, ref string }{{"src", source}, {"dest", destination}} {
+		if !strings.HasPrefix(s.ref, "docker://") {
+			continue
+		}
+		args = append(args, fmt.Sprintf("--%s-tls-verify=%v", s.side, ra.tlsVerify))
+		if ra.tlsVerify {
+			args = append(args, fmt.Sprintf("--%s-cert-dir=%v", s.side, ra.certDir))
+		}
+	}
+	if ra.debug {
+		args = append(args, "--debug")
+	}
+	args = append(args, extraArgs...)
+	args = append(args, source, destination)
+	err := runCmdInDir("skopeo", args, []string{}, "", outWriter, errWriter)
+	if err != nil {
+		return fmt.Errorf("skopeo copy %s to %s: %w", source, destination, err)
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// skopeoDelete deletes the manifest referenced by imageRef from the registry.
+func skopeoDelete(imageRef string, ra registryAccess, outWriter, errWriter io.Writer) error {
+	args := append([]string{"delete"}, ra.args()...)
+	source := fmt.Sprintf("docker://%s", imageRef)
+	args = append(args, source)
+	err := runCmdInDir("skopeo", args, []string{}, "", outWriter, errWriter)
+	if err != nil {
+		return fmt.Errorf("skopeo delete %s: %w", source, err)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// registryAccess holds the settings used by skopeo to access a registry.
+type registryAccess struct {
+	tlsVerify bool
+	certDir   string
+	debug     bool
+}
+
+// newRegistryAccess returns the settings to access registry.
+func newRegistryAccess(registry string, tlsVerify bool, certDir string, debug bool) registryAccess {
+	return registryAccess{
+		tlsVerify: registryTLSVerify(registry, tlsVerify),
+		certDir:   certDir,
+		debug:     debug,
+	}
+}
+
+func (ra registryAccess) args() []string {
+	args := []string{fmt.Sprintf("--tls-verify=%v", ra.tlsVerify)}
+	if ra.tlsVerify {
+		args = append(args, fmt.Sprintf("--cert-dir=%v", ra.certDir))
+	}
+	if ra.debug {
+		args = append(args, "--debug")
+	}
+	return args
+}
+
+// inspectedImage is the subset of the output of "skopeo inspect" used by
+// this task.
+type inspectedImage struct {
+	Digest  string            `json:"Digest"`
+	Created *time.Time        `json:"Created"`
+	Labels  map[string]string `json:"Labels"`
+}
+
+// registryAccess returns the settings to access the registry of the task.
+func (p *packageImage) registryAccess() registryAccess {
+	return newRegistryAccess(p.opts.registry, p.opts.tlsVerify, p.opts.certDir, p.opts.debug)
+}
+
+// skopeoInspectDigest resolves the manifest digest of imageRef as stored in
+// the registry.
+func (p *packageImage) skopeoInspectDigest(imageRef string, errWriter io.Writer) (string, error) {
+	return skopeoInspectDigest(imageRef, p.registryAccess(), errWriter)
+}
+
+// skopeoInspectDigest resolves the manifest digest of imageRef as stored in
+// the registry, using given registry access settings.
+func skopeoInspectDigest(imageRef string, ra registryAccess, errWriter io.Writer) (string, error) {
+	out, err := runSkopeoInspect(imageRef, []string{"--format={{.Digest}}"}, ra, errWriter)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// skopeoInspectDigestIfExists is like skopeoInspectDigest, but returns an
+// empty digest instead of an error if imageRef does not exist in the registry.
+func skopeoInspectDigestIfExists(imageRef string, ra registryAccess, errWriter io.Writer) (string, error) {
+	var stderr bytes.Buffer
+	d, err := skopeoInspectDigest(imageRef, ra, io.MultiWriter(&stderr, errWriter))
+	if err != nil {
+		if isManifestUnknown(stderr.String()) {
+			return "", nil
+		}
+		return "", err
+	}
+	return d, nil
+}
+
+// manifestUnknownPattern matches the registry error codes MANIFEST_UNKNOWN
+// and NAME_UNKNOWN as reported by skopeo.
+var manifestUnknownPattern = regexp.MustCompile(`(?i)\b(manifest|name)[ _]unknown\b`)
+
+// isManifestUnknown returns whether the skopeo error output indicates that
+// the requested manifest or repository does not exist. Other errors, such as
+// failed authentication or name resolution, must not be mistaken for a
+// missing image.
+func isManifestUnknown(errOutput string) bool {
+	return manifestUnknownPattern.MatchString(errOutput)
+}
+
+// skopeoInspect retrieves information about imageRef from the registry.
+func skopeoInspect(imageRef string, ra registryAccess, errWriter io.Writer) (*inspectedImage, error) {
+	out, err := runSkopeoInspect(imageRef, []string{}, ra, errWriter)
+	if err != nil {
+		return nil, err
+	}
+	var i inspectedImage
+	if err := json.Unmarshal([]byte(out), &i); err != nil {
+		return nil, fmt.Errorf("unmarshal skopeo inspect output: %w", err)
+	}
+	return &i, nil
+}
+
+// skopeoListTags lists all tags of the given repository (without tag or digest).
+func skopeoListTags(repository string, ra registryAccess, errWriter io.Writer) ([]string, error) {
+	args := append([]string{"list-tags"}, ra.args()...)
+	source := fmt.Sprintf("docker://%s", repository)
+	args = append(args, source)
+	var stdout bytes.Buffer
+	err := runCmdInDir("skopeo", args, []string{}, "", &stdout, errWriter)
+	if err != nil {
+		return nil, fmt.Errorf("skopeo list-tags %s: %w", source, err)
+	}
+	var tags struct {
+		Tags []string `json:"Tags"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &tags); err != nil {
+		return nil, fmt.Errorf("unmarshal skopeo list-tags output: %w", err)
+	}
+	return tags.Tags, nil
+}
+
+// skopeoInspectArgs returns the arguments of skopeo to inspect imageRef,
+// which must not include the transport.
+func skopeoInspectArgs(imageRef string, extraArgs []string, ra registryAccess) []string {
+	args := append([]string{"inspect", "--no-tags"}, extraArgs...)
+	args = append(args, ra.args()...)
+	return append(args, fmt.Sprintf("docker://%s", imageRef))
+}
+
+func runSkopeoInspect(imageRef string, extraArgs []string, ra registryAccess, errWriter io.Writer) (string, error) {
+	args := skopeoInspectArgs(imageRef, extraArgs, ra)
+	source := args[len(args)-1]
+
+	var stdout bytes.Buffer
+	err := runCmdInDir("skopeo", args, []string{}, "", &stdout, errWriter)
+	if err != nil {
+		return "", fmt.Errorf("skopeo inspect %s: %w", source, err)
+	}
+	return stdout.String(), nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestIsManifestUnknown(t *testing.T) {
+	tests := map[string]bool{
+		`time="2024-01-15T10:00:00Z" level=fatal msg="Error parsing image name \"docker://registry.example.com/foo/app:1.0\": reading manifest 1.0 in registry.example.com/foo/app: manifest unknown: manifest unknown"`: true,
+		`level=fatal msg="Error parsing image name \"docker://registry.example.com/foo/app:1.0\": reading manifest 1.0 in registry.example.com/foo/app: name unknown: repository name not known to registry"`:            true,
+		`Error: {"errors":[{"code":"MANIFEST_UNKNOWN","message":"manifest unknown"}]}`: true,
+		`level=fatal msg="Error parsing image name \"docker://registry.example.com/foo/app:1.0\": pinging container registry registry.example.com: Get \"https://registry.example.com/v2/\": dial tcp: lookup registry.example.com: no such host"`: false,
+		`level=fatal msg="Error parsing image name \"docker://registry.example.com/foo/app:1.0\": reading manifest 1.0 in registry.example.com/foo/app: unauthorized: authentication required, credentials not found"`:                             false,
+		`level=fatal msg="Error parsing image name: open /etc/containers/certs.d/registry.example.com/ca.crt: file not found"`:                                                                                                                     false,
+	}
+	for errOutput, want := range tests {
+		if got := isManifestUnknown(errOutput); got != want {
+			t.Errorf("isManifestUnknown(%q): want %v, got %v", errOutput, want, got)
+		}
+	}
+}
+
+func TestSkopeoInspectArgs(t *testing.T) {
+	ra := registryAccess{tlsVerify: true, certDir: "/etc/containers/certs.d"}
+	got := skopeoInspectArgs("registry.access.redhat.com/ubi9/ubi-minimal:9.3", []string{"--format={{.Digest}}"}, ra)
+	want := []string{
+		"inspect",
+		"--no-tags",
+		"--format={{.Digest}}",
+		"--tls-verify=true",
+		"--cert-dir=/etc/containers/certs.d",
+		"docker://registry.access.redhat.com/ubi9/ubi-minimal:9.3",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("args mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// stageImage is an image built from a Dockerfile stage and published to its
+// own image stream.
+type stageImage struct {
+	// stage is the Dockerfile stage to build. Empty builds the last stage.
+	stage string
+	// imageStream is the image stream to publish to. Empty uses the image
+	// stream of the options. If it starts with "-", it is appended as suffix
+	// to the image stream of the options.
+	imageStream string
+}
+
+// packageTargets returns the images to build and publish as determined by
+// the target and stage images options. Without these options, the last stage
+// of the Dockerfile is published to the image stream of the options.
+func packageTargets(opts options) ([]stageImage, error) {
+	if opts.baseImage != "" && (opts.target != "" || strings.TrimSpace(opts.stageImages) != "" || strings.TrimSpace(opts.stageOutputs) != "") {
+		return nil, errors.New("target, stage images and stage outputs require a Dockerfile and must not be set together with a base image")
+	}
+	if strings.TrimSpace(opts.stageImages) == "" {
+		return []stageImage{{stage: strings.ToLower(opts.target)}}, nil
+	}
+	if opts.target != "" {
+		return nil, errors.New("target and stage images must not be set both")
+	}
+	var images []stageImage
+	seen := map[string]bool{}
+	for _, entry := range strings.FieldsFunc(opts.stageImages, func(r rune) bool { return r == '\n' || r == ';' }) {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		stage, stream, ok := strings.Cut(entry, "->")
+		si := stageImage{stage: strings.ToLower(strings.TrimSpace(stage)), imageStream: strings.TrimSpace(stream)}
+		if !ok || si.stage == "" || si.imageStream == "" || strings.ContainsAny(si.imageStream, " /:") {
+			return nil, fmt.Errorf("invalid stage image %q, must be <stage> -> <image stream or -suffix>", entry)
+		}
+		if seen[si.imageStream] {
+			return nil, fmt.Errorf("image stream %s is used by more than one stage", si.imageStream)
+		}
+		seen[si.imageStream] = true
+		images = append(images, si)
+	}
+	return images, nil
+}
+
+// packageStages returns the stages of targets which are built explicitly.
+func packageStages(targets []stageImage) []string {
+	var stages []string
+	for _, t := range targets {
+		if t.stage != "" {
+			stages = append(stages, t.stage)
+		}
+	}
+	return stages
+}
+
+// newPackageImages creates one packageImage per target. The first one is the
+// primary image, which is reported in the task results. Images after the
+// first reuse the layers cached by the build of the first, as do the builds
+// of stages with stage outputs.
+func newPackageImages(opts options, targets []stageImage) []*packageImage {
+	var images []*packageImage
+	buildTime := time.Now().UTC()
+	for i, t := range targets {
+		p := &packageImage{
+			opts:        opts,
+			target:      t.stage,
+			primary:     i == 0,
+			cacheLayers: len(targets) > 1 || strings.TrimSpace(opts.stageOutputs) != "",
+			reuseLayers: i > 0,
+			buildTime:   buildTime,
+		}
+		if strings.HasPrefix(t.imageStream, "-") {
+			p.imageStreamSuffix = t.imageStream
+		} else if t.imageStream != "" {
+			p.opts.imageStream = t.imageStream
+		}
+		images = append(images, p)
+	}
+	return images
+}
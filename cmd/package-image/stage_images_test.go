@@ -0,0 +1,106 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPackageTargets(t *testing.T) {
+	tests := map[string]struct {
+		target      string
+		stageImages string
+		baseImage   string
+		want        []stageImage
+		wantErr     bool
+	}{
+		"default": {
+			want: []stageImage{{}},
+		},
+		"target": {
+			target: "Runtime",
+			want:   []stageImage{{stage: "runtime"}},
+		},
+		"stage images": {
+			stageImages: "runtime -> app\ndebug -> app-debug; tools->-tools",
+			want: []stageImage{
+				{stage: "runtime", imageStream: "app"},
+				{stage: "debug", imageStream: "app-debug"},
+				{stage: "tools", imageStream: "-tools"},
+			},
+		},
+		"target and stage images": {
+			target:      "runtime",
+			stageImages: "runtime -> app",
+			wantErr:     true,
+		},
+		"missing image stream": {
+			stageImages: "runtime ->",
+			wantErr:     true,
+		},
+		"duplicate image stream": {
+			stageImages: "runtime -> app; debug -> app",
+			wantErr:     true,
+		},
+		"base image": {
+			baseImage: "registry.access.redhat.com/ubi9/openjdk-17-runtime:1.18",
+			want:      []stageImage{{}},
+		},
+		"target and base image": {
+			target:    "runtime",
+			baseImage: "registry.access.redhat.com/ubi9/openjdk-17-runtime:1.18",
+			wantErr:   true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			opts := defaultOptions
+			opts.target, opts.stageImages, opts.baseImage = tc.target, tc.stageImages, tc.baseImage
+			got, err := packageTargets(opts)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("want error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, got, cmp.AllowUnexported(stageImage{})); diff != "" {
+				t.Fatalf("targets mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNewPackageImages(t *testing.T) {
+	opts := defaultOptions
+	opts.imageStream = "app"
+	images := newPackageImages(opts, []stageImage{
+		{stage: "runtime"},
+		{stage: "debug", imageStream: "-debug"},
+		{stage: "tools", imageStream: "tools"},
+	})
+	type result struct {
+		Target, ImageStream, Suffix string
+		Primary, Cache, Reuse       bool
+	}
+	var got []result
+	for _, p := range images {
+		got = append(got, result{p.target, p.opts.imageStream, p.imageStreamSuffix, p.primary, p.cacheLayers, p.reuseLayers})
+	}
+	want := []result{
+		{"runtime", "app", "", true, true, false},
+		{"debug", "app", "-debug", false, true, true},
+		{"tools", "tools", "", false, true, true},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("images mismatch (-want +got):\n%s", diff)
+	}
+
+	opts.stageOutputs = "test:/reports/*.xml -> .ods/artifacts/xunit-reports"
+	images = newPackageImages(opts, []stageImage{{stage: ""}})
+	if !images[0].cacheLayers || images[0].reuseLayers {
+		t.Fatalf("want layers of single image with stage outputs cached but not reused, got cache=%v reuse=%v", images[0].cacheLayers, images[0].reuseLayers)
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/opendevstack/ods-pipeline-image/internal/dockerfile"
+	"github.com/opendevstack/ods-pipeline-image/internal/oci"
+)
+
+// stageOutput describes files to copy out of a Dockerfile stage into the
+// checkout directory.
+type stageOutput struct {
+	stage string
+	// pattern is an absolute path in the stage, which may contain glob
+	// patterns in its last element.
+	pattern string
+	// dest is the destination directory, relative to the checkout directory.
+	dest string
+}
+
+// parseStageOutputs parses stage outputs separated by newlines or
+// semicolons, each in the form "<stage>:<pattern> -> <dest>", e.g.
+// "test:/reports/*.xml -> .ods/artifacts/xunit-reports".
+func parseStageOutputs(s string) ([]stageOutput, error) {
+	var outputs []stageOutput
+	for _, entry := range strings.FieldsFunc(s, func(r rune) bool { return r == '\n' || r == ';' }) {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		src, dest, ok := strings.Cut(entry, "->")
+		stage, pattern, ok2 := strings.Cut(strings.TrimSpace(src), ":")
+		so := stageOutput{stage: strings.ToLower(stage), pattern: strings.TrimSpace(pattern), dest: strings.TrimSpace(dest)}
+		if !ok || !ok2 || so.stage == "" || so.dest == "" || !path.IsAbs(so.pattern) {
+			return nil, fmt.Errorf("invalid stage output %q, must be <stage>:<absolute path> -> <destination>", entry)
+		}
+		if _, err := path.Match(so.pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern of stage output %q: %w", entry, err)
+		}
+		if filepath.IsAbs(so.dest) || !filepath.IsLocal(so.dest) {
+			return nil, fmt.Errorf("destination of stage output %q must be within the checkout directory", entry)
+		}
+		outputs = append(outputs, so)
+	}
+	return outputs, nil
+}
+
+// outputStages returns the distinct stages of outputs in order of appearance.
+func outputStages(outputs []stageOutput) []string {
+	var stages []string
+	seen := map[string]bool{}
+	for _, o := range outputs {
+		if !seen[o.stage] {
+			seen[o.stage] = true
+			stages = append(stages, o.stage)
+		}
+	}
+	return stages
+}
+
+// matchStageOutputs returns the paths of the files matching the patterns of
+// outputs, keyed by destination directory.
+func matchStageOutputs(files map[string]oci.File, outputs []stageOutput) map[string][]string {
+	matches := map[string][]string{}
+	for f, info := range files {
+		if !info.Header.FileInfo().Mode().IsRegular() {
+			continue
+		}
+		for _, o := range outputs {
+			if ok, _ := path.Match(o.pattern, f); ok {
+				matches[o.dest] = append(matches[o.dest], f)
+			}
+		}
+	}
+	for _, ps := range matches {
+		sort.Strings(ps)
+	}
+	return matches
+}
+
+// extractStageOutputs builds each stage named by the stage outputs and copies
+// the matching files into the checkout directory.
+func (p *packageImage) extractStageOutputs() error {
+	outputs, err := parseStageOutputs(p.opts.stageOutputs)
+	if err != nil {
+		return err
+	}
+	df, err := dockerfile.ParseFile(p.dockerfilePath())
+	if err != nil {
+		return err
+	}
+	written := map[string]string{}
+	for _, stage := range outputStages(outputs) {
+		if !hasStage(df, stage) {
+			return fmt.Errorf("stage %s of stage outputs does not exist in %s", stage, p.opts.dockerfile)
+		}
+		var stageOutputs []stageOutput
+		for _, o := range outputs {
+			if o.stage == stage {
+				stageOutputs = append(stageOutputs, o)
+			}
+		}
+		if err := p.extractOutputsOfStage(stage, stageOutputs, written); err != nil {
+			return fmt.Errorf("stage %s: %w", stage, err)
+		}
+	}
+	return nil
+}
+
+func hasStage(df *dockerfile.Dockerfile, name string) bool {
+	for _, s := range df.Stages {
+		if s.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// claimStageOutput records that target is written from the file src of
+// stage, and fails if another file has been written to target already.
+func claimStageOutput(written map[string]string, target, stage, src string) error {
+	source := fmt.Sprintf("%s of stage %s", src, stage)
+	if other, ok := written[target]; ok {
+		return fmt.Errorf("%s and %s are both copied to %s", other, source, target)
+	}
+	written[target] = source
+	return nil
+}
+
+// extractOutputsOfStage builds stage and copies the files matching outputs
+// into the checkout directory. written maps the files written so far to
+// their source.
+func (p *packageImage) extractOutputsOfStage(stage string, outputs []stageOutput, written map[string]string) error {
+	tag := fmt.Sprintf("localhost/%s-%s:%s", p.imageNameNoSha(), stage, p.imageId.GitCommitSHA)
+	fmt.Printf("Building stage %s ...\n", stage)
+	if err := p.buildahBuildStage(stage, tag, os.Stdout, os.Stderr); err != nil {
+		return fmt.Errorf("buildah bud: %w", err)
+	}
+	defer func() {
+		if err := p.buildahRemoveImage(tag, os.Stdout, os.Stderr); err != nil {
+			p.logger.Warnf("Could not remove image %s: %s", tag, err)
+		}
+	}()
+	layoutDir := filepath.Join(buildahWorkdir, fmt.Sprintf("%s-%s", p.imageNameNoSha(), stage))
+	if err := p.buildahPushOCI(tag, layoutDir, stage, os.Stdout, os.Stderr); err != nil {
+		return fmt.Errorf("buildah push: %w", err)
+	}
+	defer os.RemoveAll(layoutDir)
+
+	l, err := oci.Open(layoutDir)
+	if err != nil {
+		return err
+	}
+	manifest, _, err := l.Manifest(stage)
+	if err != nil {
+		return err
+	}
+	files, err := l.Files(manifest)
+	if err != nil {
+		return err
+	}
+	for dest, paths := range matchStageOutputs(files, outputs) {
+		contents, err := l.ReadFiles(manifest, files, paths)
+		if err != nil {
+			return err
+		}
+		destDir := filepath.Join(p.opts.checkoutDir, dest)
+		if err := os.MkdirAll(destDir, 0755); err != nil {
+			return fmt.Errorf("create %s: %w", destDir, err)
+		}
+		for _, f := range paths {
+			target := filepath.Join(destDir, path.Base(f))
+			if err := claimStageOutput(written, filepath.Join(dest, path.Base(f)), stage, f); err != nil {
+				return err
+			}
+			if err := os.WriteFile(target, contents[f], 0644); err != nil {
+				return fmt.Errorf("write %s: %w", target, err)
+			}
+			p.logger.Infof("Copied %s from stage %s to %s", f, stage, filepath.Join(dest, path.Base(f)))
+		}
+	}
+	for _, o := range outputs {
+		if len(matchStageOutputs(files, []stageOutput{o})) == 0 {
+			p.logger.Warnf("No files in stage %s match %s", stage, o.pattern)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/opendevstack/ods-pipeline-image/internal/oci"
+	"github.com/opendevstack/ods-pipeline-image/internal/oci/ocitest"
+)
+
+func TestParseStageOutputs(t *testing.T) {
+	got, err := parseStageOutputs(`
+test:/reports/*.xml -> .ods/artifacts/xunit-reports
+Test:/reports/coverage.out->.ods/artifacts/code-coverage; lint:/out/*.sarif -> .ods/artifacts/sarif-reports
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []stageOutput{
+		{stage: "test", pattern: "/reports/*.xml", dest: ".ods/artifacts/xunit-reports"},
+		{stage: "test", pattern: "/reports/coverage.out", dest: ".ods/artifacts/code-coverage"},
+		{stage: "lint", pattern: "/out/*.sarif", dest: ".ods/artifacts/sarif-reports"},
+	}
+	if diff := cmp.Diff(want, got, cmp.AllowUnexported(stageOutput{})); diff != "" {
+		t.Fatalf("outputs mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"test", "lint"}, outputStages(got)); diff != "" {
+		t.Fatalf("stages mismatch (-want +got):\n%s", diff)
+	}
+
+	for _, s := range []string{
+		"test:/reports/*.xml",
+		"/reports/*.xml -> out",
+		"test:reports/*.xml -> out",
+		"test:/reports/[.xml -> out",
+		"test:/reports/*.xml -> ../out",
+		"test:/reports/*.xml -> /tmp/out",
+	} {
+		if _, err := parseStageOutputs(s); err == nil {
+			t.Errorf("want error for %q, got none", s)
+		}
+	}
+}
+
+func TestMatchStageOutputs(t *testing.T) {
+	l := ocitest.WriteImage(t, t.TempDir(), "test", oci.ContainerConfig{},
+		ocitest.Layer{Files: map[string]string{
+			"reports/a.xml":        "a",
+			"reports/b.xml":        "b",
+			"reports/nested/c.xml": "c",
+			"reports/coverage.out": "cov",
+		}},
+	)
+	m, _, err := l.Manifest("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := l.Files(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := matchStageOutputs(files, []stageOutput{
+		{stage: "test", pattern: "/reports/*.xml", dest: "xunit"},
+		{stage: "test", pattern: "/reports/coverage.out", dest: "coverage"},
+		{stage: "test", pattern: "/missing/*", dest: "missing"},
+	})
+	want := map[string][]string{
+		"xunit":    {"/reports/a.xml", "/reports/b.xml"},
+		"coverage": {"/reports/coverage.out"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("matches mismatch (-want +got):\n%s", diff)
+	}
+	contents, err := l.ReadFiles(m, files, got["xunit"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(map[string][]byte{"/reports/a.xml": []byte("a"), "/reports/b.xml": []byte("b")}, contents); diff != "" {
+		t.Fatalf("contents mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestClaimStageOutput(t *testing.T) {
+	written := map[string]string{}
+	if err := claimStageOutput(written, "reports/junit.xml", "test", "/app/a/junit.xml"); err != nil {
+		t.Fatal(err)
+	}
+	if err := claimStageOutput(written, "reports/other.xml", "test", "/app/b/other.xml"); err != nil {
+		t.Fatal(err)
+	}
+	err := claimStageOutput(written, "reports/junit.xml", "lint", "/app/b/junit.xml")
+	if err == nil {
+		t.Fatal("want error for colliding output, got none")
+	}
+	want := "/app/a/junit.xml of stage test and /app/b/junit.xml of stage lint are both copied to reports/junit.xml"
+	if err.Error() != want {
+		t.Fatalf("want error %q, got %q", want, err)
+	}
+}
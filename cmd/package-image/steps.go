@@ -58,13 +58,25 @@ func setExtraTags() PackageStep {
 			return p, fmt.Errorf("parse extra tags (%s): %w", p.opts.extraTags, err)
 		}
 		p.parsedExtraTags = extraTagsSpecified
+		immutableTags, err := parseTagPatterns(p.opts.immutableTags)
+		if err != nil {
+			return p, fmt.Errorf("immutable tags: %w", err)
+		}
+		p.immutableTags = immutableTags
 		return p, nil
 	}
 }
 
 func setImageId() PackageStep {
 	return func(p *packageImage) (*packageImage, error) {
-		p.imageId = image.CreateImageIdentity(p.ctxt, p.opts.imageNamespace, p.opts.imageStream)
+		imageStream := p.opts.imageStream
+		if p.imageStreamSuffix != "" {
+			if imageStream == "" {
+				imageStream = p.ctxt.Component
+			}
+			imageStream += p.imageStreamSuffix
+		}
+		p.imageId = image.CreateImageIdentity(p.ctxt, p.opts.imageNamespace, imageStream)
 		return p, nil
 	}
 }
@@ -82,19 +94,59 @@ func skipIfImageArtifactExists() PackageStep {
 	}
 }
 
-func buildImageAndGenerateTar() PackageStep {
+// lintDockerfile fails if the Dockerfile has lint findings with severity error.
+func lintDockerfile() PackageStep {
+	return func(p *packageImage) (*packageImage, error) {
+		if !p.primary || p.assembled() {
+			return p, nil
+		}
+		fmt.Printf("Linting %s ...\n", p.opts.dockerfile)
+		err := p.lintDockerfile()
+		if err != nil {
+			return p, fmt.Errorf("lint Dockerfile: %w", err)
+		}
+		return p, nil
+	}
+}
+
+// checkBaseImages fails if a base image of the Dockerfile is not allowed, and
+// resolves the digests of all base images.
+func checkBaseImages() PackageStep {
 	return func(p *packageImage) (*packageImage, error) {
-		fmt.Printf("Building image %s ...\n", p.imageName())
-		err := p.buildahBuild(os.Stdout, os.Stderr)
+		if p.assembled() {
+			fmt.Printf("Checking base image %s ...\n", p.opts.baseImage)
+		} else {
+			fmt.Printf("Checking base images of %s ...\n", p.opts.dockerfile)
+		}
+		err := p.checkBaseImages()
 		if err != nil {
-			return p, fmt.Errorf("buildah bud: %w", err)
+			return p, fmt.Errorf("check base images: %w", err)
+		}
+		return p, nil
+	}
+}
+
+func buildImageAndGenerateTar() PackageStep {
+	return func(p *packageImage) (*packageImage, error) {
+		if p.assembled() {
+			fmt.Printf("Assembling image %s onto %s ...\n", p.imageName(), p.opts.baseImage)
+			err := p.buildahAssemble(os.Stdout, os.Stderr)
+			if err != nil {
+				return p, fmt.Errorf("assemble image: %w", err)
+			}
+		} else {
+			fmt.Printf("Building image %s ...\n", p.imageName())
+			err := p.buildahBuild(os.Stdout, os.Stderr)
+			if err != nil {
+				return p, fmt.Errorf("buildah bud: %w", err)
+			}
 		}
 		fmt.Printf("Creating local tar folder for image %s ...\n", p.imageName())
-		err = p.buildahPushTar(os.Stdout, os.Stderr)
+		err := p.buildahPushTar(os.Stdout, os.Stderr)
 		if err != nil {
 			return p, fmt.Errorf("buildah push tar: %w", err)
 		}
-		d, err := getImageDigestFromFile(p.opts.checkoutDir)
+		d, err := getImageDigestFromFile(p.digestFile())
 		if err != nil {
 			return p, err
 		}
@@ -103,6 +155,86 @@ func buildImageAndGenerateTar() PackageStep {
 	}
 }
 
+// extractStageOutputs copies files out of Dockerfile stages, e.g. test
+// reports of a test stage, into the checkout directory.
+func extractStageOutputs() PackageStep {
+	return func(p *packageImage) (*packageImage, error) {
+		if !p.primary || strings.TrimSpace(p.opts.stageOutputs) == "" {
+			return p, nil
+		}
+		err := p.extractStageOutputs()
+		if err != nil {
+			return p, fmt.Errorf("extract stage outputs: %w", err)
+		}
+		return p, nil
+	}
+}
+
+// checkForSecrets fails if the locally built image contains secrets passed
+// as build args or well-known credentials, before the image is pushed.
+func checkForSecrets() PackageStep {
+	return func(p *packageImage) (*packageImage, error) {
+		fmt.Printf("Checking image %s for leaked secrets ...\n", p.imageName())
+		err := p.checkForSecrets()
+		if err != nil {
+			return p, fmt.Errorf("check for secrets: %w", err)
+		}
+		return p, nil
+	}
+}
+
+// scanImageContent scans the files of the locally built image for secrets
+// and misconfigurations, before the image is pushed.
+func scanImageContent() PackageStep {
+	return func(p *packageImage) (*packageImage, error) {
+		scanners, err := p.contentScanners()
+		if err != nil {
+			return p, fmt.Errorf("scan image content: %w", err)
+		}
+		if len(scanners) == 0 {
+			return p, nil
+		}
+		fmt.Printf("Scanning files of image %s with trivy scanners %s ...\n", p.imageName(), strings.Join(scanners, ","))
+		err = p.scanImageContent(scanners)
+		if err != nil {
+			return p, fmt.Errorf("scan image content: %w", err)
+		}
+		return p, nil
+	}
+}
+
+// checkImagePolicy fails if the locally built image violates the image
+// policy, before the image is pushed.
+func checkImagePolicy() PackageStep {
+	return func(p *packageImage) (*packageImage, error) {
+		if p.opts.imagePolicyFile == "" {
+			return p, nil
+		}
+		fmt.Printf("Checking image %s against policy %s ...\n", p.imageName(), p.opts.imagePolicyFile)
+		err := p.checkImagePolicy()
+		if err != nil {
+			return p, fmt.Errorf("check image policy: %w", err)
+		}
+		return p, nil
+	}
+}
+
+// runStructureTests fails if the locally built image does not pass the
+// structure tests, before the image is pushed.
+func runStructureTests() PackageStep {
+	return func(p *packageImage) (*packageImage, error) {
+		if p.opts.structureTestsFile == "" {
+			return p, nil
+		}
+		fmt.Printf("Running structure tests %s against image %s ...\n", p.opts.structureTestsFile, p.imageName())
+		err := p.runStructureTests()
+		if err != nil {
+			return p, fmt.Errorf("run structure tests: %w", err)
+		}
+		return p, nil
+	}
+}
+
 func generateSBOM() PackageStep {
 	return func(p *packageImage) (*packageImage, error) {
 		fmt.Println("Generating image SBOM with trivy scanner ...")
@@ -110,6 +242,58 @@ func generateSBOM() PackageStep {
 		if err != nil {
 			return p, fmt.Errorf("generate SBOM: %w", err)
 		}
+		err = p.checkSBOM()
+		if err != nil {
+			return p, err
+		}
+		return p, nil
+	}
+}
+
+// diffSBOM compares the SBOM with the SBOM of the previously published
+// image.
+func diffSBOM() PackageStep {
+	return func(p *packageImage) (*packageImage, error) {
+		if p.opts.sbomDiffTag == "" {
+			return p, nil
+		}
+		fmt.Printf("Comparing SBOM with image tagged %s ...\n", p.opts.sbomDiffTag)
+		err := p.diffSBOM()
+		if err != nil {
+			return p, fmt.Errorf("diff SBOM: %w", err)
+		}
+		return p, nil
+	}
+}
+
+// checkLicenses fails if packages in the SBOM violate the license policy,
+// before the image is pushed.
+func checkLicenses() PackageStep {
+	return func(p *packageImage) (*packageImage, error) {
+		if p.opts.licensePolicyFile == "" {
+			return p, nil
+		}
+		fmt.Printf("Checking licenses against policy %s ...\n", p.opts.licensePolicyFile)
+		err := p.checkLicenses()
+		if err != nil {
+			return p, fmt.Errorf("check licenses: %w", err)
+		}
+		return p, nil
+	}
+}
+
+// scanVulnerabilities scans the image for vulnerabilities before it is
+// pushed.
+func scanVulnerabilities() PackageStep {
+	return func(p *packageImage) (*packageImage, error) {
+		if !p.opts.vulnerabilityScan {
+			return p, nil
+		}
+		fmt.Println("Scanning image for vulnerabilities with trivy scanner ...")
+		err := p.scanVulnerabilities()
+		if err != nil {
+			return p, fmt.Errorf("scan vulnerabilities: %w", err)
+		}
 		return p, nil
 	}
 }
@@ -125,6 +309,27 @@ func pushImage() PackageStep {
 	}
 }
 
+// verifyPushedDigest ensures that the digest of the image in the registry
+// matches the digest of the local build, which is recorded in artifacts.
+func verifyPushedDigest() PackageStep {
+	return func(p *packageImage) (*packageImage, error) {
+		fmt.Printf("Verifying digest of pushed image %s ...\n", p.imageName())
+		pushedDigest, err := p.skopeoInspectDigest(p.imageRef(), os.Stderr)
+		if err != nil {
+			return p, fmt.Errorf("resolve pushed digest: %w", err)
+		}
+		d, err := reconcilePushedDigest(p.imageDigest, pushedDigest, p.opts.onDigestMismatch)
+		if err != nil {
+			return p, err
+		}
+		if d != p.imageDigest {
+			p.logger.Warnf("Digest of pushed image (%s) differs from digest of local build (%s), recording pushed digest", d, p.imageDigest)
+			p.imageDigest = d
+		}
+		return p, nil
+	}
+}
+
 func signImage(cosignKey string) PackageStep {
 	return func(p *packageImage) (*packageImage, error) {
 		if cosignKey != "" {
@@ -138,16 +343,67 @@ func signImage(cosignKey string) PackageStep {
 			if err := c.Attest(i, pipelinectxt.SBOMsFormat, p.sbomFile); err != nil {
 				return p, fmt.Errorf("attesting SBOM: %s", err)
 			}
+			if p.vulnReportFile != "" {
+				log.Println("Generating vulnerability attestation ...")
+				if err := c.Attest(i, vulnAttestationType, p.vulnReportFile); err != nil {
+					return p, fmt.Errorf("attesting vulnerabilities: %s", err)
+				}
+			}
+		}
+		return p, nil
+	}
+}
+
+// attachReferrers attaches the SBOM and vulnerability report to the pushed
+// image as OCI referrers.
+func attachReferrers() PackageStep {
+	return func(p *packageImage) (*packageImage, error) {
+		if !p.opts.attachReferrers {
+			return p, nil
+		}
+		fmt.Printf("Attaching referrers to image %s ...\n", p.imageName())
+		err := p.attachReferrers()
+		if err != nil {
+			return p, fmt.Errorf("attach referrers: %w", err)
+		}
+		return p, nil
+	}
+}
+
+// saveOCIArchive saves the signed image as OCI archive artifact.
+func saveOCIArchive() PackageStep {
+	return func(p *packageImage) (*packageImage, error) {
+		if !p.opts.ociArchive {
+			return p, nil
+		}
+		fmt.Printf("Saving image %s as OCI archive ...\n", p.imageName())
+		err := p.saveOCIArchive()
+		if err != nil {
+			return p, fmt.Errorf("save OCI archive: %w", err)
 		}
 		return p, nil
 	}
 }
 
+// updateImageStream creates or updates the ImageStream and ImageStreamTag of
+// the pushed image, annotated with build metadata.
+func updateImageStream() PackageStep {
+	return func(p *packageImage) (*packageImage, error) {
+		if !p.opts.updateImageStream {
+			return p, nil
+		}
+		fmt.Printf("Updating image stream tag %s ...\n", p.imageName())
+		err := p.applyImageStreamTag(p.imageId.GitCommitSHA)
+		return p, err
+	}
+}
+
 func storeArtifact() PackageStep {
 	return func(p *packageImage) (*packageImage, error) {
 		fmt.Println("Writing image artifact ...")
 		imageArtifactFilename := fmt.Sprintf("%s.json", p.imageNameNoSha())
-		err := pipelinectxt.WriteJsonArtifact(p.artifactImage(), pipelinectxt.ImageDigestsPath, imageArtifactFilename)
+		ia := imageArtifact{Image: p.artifactImage(), BaseImages: p.baseImages}
+		err := pipelinectxt.WriteJsonArtifact(ia, pipelinectxt.ImageDigestsPath, imageArtifactFilename)
 		if err != nil {
 			return p, err
 		}
@@ -162,10 +418,20 @@ func storeArtifact() PackageStep {
 	}
 }
 
+// storeResults writes the digest and reference of the primary image as
+// task results.
 func storeResults() PackageStep {
 	return func(p *packageImage) (*packageImage, error) {
+		if !p.primary {
+			return p, nil
+		}
+		fmt.Println("Writing image-digest result ...")
+		err := os.WriteFile(tektonResultsImageDigestFile, []byte(p.imageDigest), 0644)
+		if err != nil {
+			return p, err
+		}
 		fmt.Println("Writing image-ref result ...")
-		err := os.WriteFile(tektonResultsImageRefFile, []byte(imageRef(p.artifactImage())), 0644)
+		err = os.WriteFile(tektonResultsImageRefFile, []byte(imageRef(p.artifactImage())), 0644)
 		return p, err
 	}
 }
@@ -180,11 +446,25 @@ func processExtraTags() PackageStep {
 					p.logger.Infof("Artifact exists for tag: %s", extraTag)
 					continue
 				}
-				p.logger.Infof("pushing extra tag: %s", extraTag)
-				imageExtraTag := p.imageId.Tag(extraTag)
-				err = p.skopeoTag(&imageExtraTag, os.Stdout, os.Stderr)
+				push, err := p.checkImmutableExtraTag(extraTag)
 				if err != nil {
-					return p, fmt.Errorf("skopeo push failed: %w", err)
+					return p, err
+				}
+				if push {
+					p.logger.Infof("pushing extra tag: %s", extraTag)
+					imageExtraTag := p.imageId.Tag(extraTag)
+					err = p.skopeoTag(&imageExtraTag, os.Stdout, os.Stderr)
+					if err != nil {
+						return p, fmt.Errorf("skopeo push failed: %w", err)
+					}
+				} else {
+					p.logger.Infof("Immutable tag %s references the image already", extraTag)
+				}
+				if p.opts.updateImageStream && p.imageDigest != "" {
+					p.logger.Infof("Updating image stream tag for tag: %s", extraTag)
+					if err := p.applyImageStreamTag(extraTag); err != nil {
+						return p, err
+					}
 				}
 
 				p.logger.Infof("Writing image artifact for tag: %s", extraTag)
@@ -200,6 +480,31 @@ func processExtraTags() PackageStep {
 	}
 }
 
+// checkImmutableExtraTag returns whether extraTag needs to be pushed. Tags
+// which are not immutable are always pushed. Immutable tags are only pushed
+// if they do not exist in the registry yet. If an immutable tag references
+// another image already, an error is returned.
+func (p *packageImage) checkImmutableExtraTag(extraTag string) (bool, error) {
+	if !matchesAnyPattern(extraTag, p.immutableTags) {
+		return true, nil
+	}
+	digest := p.imageDigest
+	if digest == "" {
+		// The build has been skipped, resolve the digest of the existing image.
+		d, err := p.skopeoInspectDigest(p.imageRef(), os.Stderr)
+		if err != nil {
+			return false, fmt.Errorf("resolve image digest: %w", err)
+		}
+		digest = d
+	}
+	imageExtraTag := p.imageId.Tag(extraTag)
+	existingDigest, err := skopeoInspectDigestIfExists(imageExtraTag.ImageRef(p.opts.registry), p.registryAccess(), os.Stderr)
+	if err != nil {
+		return false, fmt.Errorf("resolve digest of tag %s: %w", extraTag, err)
+	}
+	return checkImmutableTag(extraTag, existingDigest, digest)
+}
+
 func imageTagArtifactExists(p *packageImage, tag string) error {
 	imageArtifactsDir := filepath.Join(p.opts.checkoutDir, pipelinectxt.ImageDigestsPath)
 	filename := fmt.Sprintf("%s-%s.json", p.imageId.ImageStream, tag)
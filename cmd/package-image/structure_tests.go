@@ -0,0 +1,338 @@
+package main
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/opendevstack/ods-pipeline-image/internal/oci"
+	"github.com/opendevstack/ods-pipeline/pkg/pipelinectxt"
+	"sigs.k8s.io/yaml"
+)
+
+// structureTests describes tests run against the built image.
+type structureTests struct {
+	FileExistenceTests []fileExistenceTest `json:"fileExistenceTests"`
+	FileContentTests   []fileContentTest   `json:"fileContentTests"`
+	CommandTests       []commandTest       `json:"commandTests"`
+	MetadataTest       *metadataTest       `json:"metadataTest"`
+}
+
+type fileExistenceTest struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+	// ShouldExist defaults to true.
+	ShouldExist *bool `json:"shouldExist"`
+	// Executable requires the file to be executable by its owner.
+	Executable bool `json:"executable"`
+}
+
+type fileContentTest struct {
+	Name             string   `json:"name"`
+	Path             string   `json:"path"`
+	ExpectedContents []string `json:"expectedContents"`
+	ExcludedContents []string `json:"excludedContents"`
+}
+
+type commandTest struct {
+	Name    string   `json:"name"`
+	Command string   `json:"command"`
+	Args    []string `json:"args"`
+	// ExitCode is the expected exit code, defaults to 0.
+	ExitCode int `json:"exitCode"`
+	// ExpectedOutput are regular expressions which must match the combined
+	// output of the command.
+	ExpectedOutput []string `json:"expectedOutput"`
+	// ExcludedOutput are regular expressions which must not match the
+	// combined output of the command.
+	ExcludedOutput []string `json:"excludedOutput"`
+}
+
+type metadataTest struct {
+	Entrypoint   *[]string `json:"entrypoint"`
+	Cmd          *[]string `json:"cmd"`
+	Workdir      *string   `json:"workdir"`
+	User         *string   `json:"user"`
+	ExposedPorts []string  `json:"exposedPorts"`
+	Env          []envVar  `json:"env"`
+	Labels       []label   `json:"labels"`
+}
+
+type envVar struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type label struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// commandRunner runs cmd in the built image and returns its combined output
+// and exit code.
+type commandRunner func(cmd []string) (output string, exitCode int, err error)
+
+// structureTestResult is the outcome of one structure test. An empty
+// failure indicates success.
+type structureTestResult struct {
+	name    string
+	failure string
+}
+
+func readStructureTests(filename string) (*structureTests, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("read structure tests: %w", err)
+	}
+	var st structureTests
+	if err := yaml.UnmarshalStrict(b, &st); err != nil {
+		return nil, fmt.Errorf("parse structure tests %s: %w", filename, err)
+	}
+	return &st, nil
+}
+
+// run executes all structure tests against the image described by manifest
+// and config in layout l. Command tests are executed with run.
+func (st *structureTests) run(l *oci.Layout, manifest *oci.Manifest, config *oci.ImageConfig, run commandRunner) ([]structureTestResult, error) {
+	var results []structureTestResult
+	var files map[string]oci.File
+	if len(st.FileExistenceTests) > 0 || len(st.FileContentTests) > 0 {
+		f, err := l.Files(manifest)
+		if err != nil {
+			return nil, fmt.Errorf("read image filesystem: %w", err)
+		}
+		files = f
+	}
+	for _, t := range st.FileExistenceTests {
+		results = append(results, structureTestResult{
+			name:    testName("file existence", t.Name, t.Path),
+			failure: t.check(files),
+		})
+	}
+	// Read the contents of all regular files under test in one pass over
+	// the layers.
+	var paths []string
+	for _, t := range st.FileContentTests {
+		if f, ok := files[filepath.Clean("/"+t.Path)]; ok && f.Header.Typeflag == tar.TypeReg {
+			paths = append(paths, t.Path)
+		}
+	}
+	contents, err := l.ReadFiles(manifest, files, paths)
+	if err != nil {
+		return nil, fmt.Errorf("read image files: %w", err)
+	}
+	for _, t := range st.FileContentTests {
+		var failure string
+		f, ok := files[filepath.Clean("/"+t.Path)]
+		switch {
+		case !ok:
+			failure = fmt.Sprintf("%s does not exist", t.Path)
+		case f.Header.Typeflag != tar.TypeReg:
+			failure = fmt.Sprintf("%s is not a regular file", t.Path)
+		default:
+			failure = checkOutput("content", string(contents[filepath.Clean("/"+t.Path)]), t.ExpectedContents, t.ExcludedContents)
+		}
+		results = append(results, structureTestResult{name: testName("file content", t.Name, t.Path), failure: failure})
+	}
+	for _, t := range st.CommandTests {
+		name := testName("command", t.Name, strings.Join(append([]string{t.Command}, t.Args...), " "))
+		output, exitCode, err := run(append([]string{t.Command}, t.Args...))
+		if err != nil {
+			return nil, fmt.Errorf("run command test %s: %w", name, err)
+		}
+		var failure string
+		if exitCode != t.ExitCode {
+			failure = fmt.Sprintf("expected exit code %d, got %d. Output:\n%s", t.ExitCode, exitCode, output)
+		} else {
+			failure = checkOutput("output", output, t.ExpectedOutput, t.ExcludedOutput)
+		}
+		results = append(results, structureTestResult{name: name, failure: failure})
+	}
+	if st.MetadataTest != nil {
+		results = append(results, structureTestResult{name: "metadata", failure: st.MetadataTest.check(config)})
+	}
+	return results, nil
+}
+
+func (t fileExistenceTest) check(files map[string]oci.File) string {
+	shouldExist := t.ShouldExist == nil || *t.ShouldExist
+	f, exists := files[filepath.Clean("/"+t.Path)]
+	switch {
+	case shouldExist && !exists:
+		return fmt.Sprintf("%s does not exist", t.Path)
+	case !shouldExist && exists:
+		return fmt.Sprintf("%s exists", t.Path)
+	case exists && t.Executable && (f.Header.Typeflag != tar.TypeReg || f.Header.Mode&0100 == 0):
+		return fmt.Sprintf("%s is not an executable file", t.Path)
+	}
+	return ""
+}
+
+func (t *metadataTest) check(config *oci.ImageConfig) string {
+	c := config.Config
+	var failures []string
+	if t.Entrypoint != nil && !reflect.DeepEqual(*t.Entrypoint, c.Entrypoint) && !(len(*t.Entrypoint) == 0 && len(c.Entrypoint) == 0) {
+		failures = append(failures, fmt.Sprintf("expected entrypoint %q, got %q", *t.Entrypoint, c.Entrypoint))
+	}
+	if t.Cmd != nil && !reflect.DeepEqual(*t.Cmd, c.Cmd) && !(len(*t.Cmd) == 0 && len(c.Cmd) == 0) {
+		failures = append(failures, fmt.Sprintf("expected cmd %q, got %q", *t.Cmd, c.Cmd))
+	}
+	if t.Workdir != nil && *t.Workdir != c.WorkingDir {
+		failures = append(failures, fmt.Sprintf("expected workdir %q, got %q", *t.Workdir, c.WorkingDir))
+	}
+	if t.User != nil && *t.User != c.User {
+		failures = append(failures, fmt.Sprintf("expected user %q, got %q", *t.User, c.User))
+	}
+	for _, p := range t.ExposedPorts {
+		if _, ok := c.ExposedPorts[normalizePort(p)]; !ok {
+			failures = append(failures, fmt.Sprintf("expected port %s to be exposed", p))
+		}
+	}
+	env := map[string]string{}
+	for _, e := range c.Env {
+		k, v, _ := strings.Cut(e, "=")
+		env[k] = v
+	}
+	for _, e := range t.Env {
+		if v, ok := env[e.Key]; !ok || v != e.Value {
+			failures = append(failures, fmt.Sprintf("expected env %s=%q, got %q", e.Key, e.Value, v))
+		}
+	}
+	for _, l := range t.Labels {
+		if v, ok := c.Labels[l.Key]; !ok || v != l.Value {
+			failures = append(failures, fmt.Sprintf("expected label %s=%q, got %q", l.Key, l.Value, v))
+		}
+	}
+	return strings.Join(failures, "; ")
+}
+
+// checkOutput verifies that s matches all expected and none of the excluded
+// regular expressions.
+func checkOutput(what, s string, expected, excluded []string) string {
+	var failures []string
+	for _, e := range expected {
+		re, err := regexp.Compile(e)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("invalid expression %q: %s", e, err))
+		} else if !re.MatchString(s) {
+			failures = append(failures, fmt.Sprintf("expected %s to match %q", what, e))
+		}
+	}
+	for _, e := range excluded {
+		re, err := regexp.Compile(e)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("invalid expression %q: %s", e, err))
+		} else if re.MatchString(s) {
+			failures = append(failures, fmt.Sprintf("expected %s not to match %q", what, e))
+		}
+	}
+	return strings.Join(failures, "; ")
+}
+
+func testName(kind, name, fallback string) string {
+	if name == "" {
+		name = fallback
+	}
+	return fmt.Sprintf("%s: %s", kind, name)
+}
+
+// runStructureTests runs the structure tests against the locally built image
+// and writes the results as JUnit XML artifact.
+func (p *packageImage) runStructureTests() error {
+	st, err := readStructureTests(filepath.Join(p.opts.checkoutDir, p.opts.structureTestsFile))
+	if err != nil {
+		return err
+	}
+	l, err := p.openOCILayout()
+	if err != nil {
+		return err
+	}
+	manifest, _, err := l.Manifest(p.imageId.GitCommitSHA)
+	if err != nil {
+		return err
+	}
+	config, err := l.Config(manifest)
+	if err != nil {
+		return err
+	}
+	var container string
+	defer func() {
+		if container != "" {
+			if err := p.buildahRm(container); err != nil {
+				p.logger.Warnf("Could not remove container %s: %s", container, err)
+			}
+		}
+	}()
+	run := func(cmd []string) (string, int, error) {
+		if container == "" {
+			c, err := p.buildahFrom(p.imageRef(), false)
+			if err != nil {
+				return "", 0, err
+			}
+			container = c
+		}
+		return p.buildahRun(container, cmd)
+	}
+	results, err := st.run(l, manifest, config, run)
+	if err != nil {
+		return err
+	}
+
+	suite := &junitTestSuite{Name: "structure-tests"}
+	var failures []string
+	for _, r := range results {
+		suite.addTestCase(r.name, r.failure)
+		if r.failure != "" {
+			failures = append(failures, fmt.Sprintf("- %s: %s", r.name, r.failure))
+		}
+	}
+	xunitDir := filepath.Join(p.opts.checkoutDir, pipelinectxt.XUnitReportsPath)
+	if err := suite.write(xunitDir, fmt.Sprintf("%s-structure-tests.xml", p.imageNameNoSha())); err != nil {
+		return err
+	}
+	p.logger.Infof("Ran %d structure tests, %d failed", suite.Tests, suite.Failures)
+	if len(failures) > 0 {
+		return fmt.Errorf("structure tests failed:\n%s", strings.Join(failures, "\n"))
+	}
+	return nil
+}
+
+// buildahRun runs cmd in container and returns the combined output and
+// exit code.
+func (p *packageImage) buildahRun(container string, cmd []string) (string, int, error) {
+	args := append([]string{
+		fmt.Sprintf("--storage-driver=%s", p.opts.storageDriver),
+		"run",
+		container,
+		"--",
+	}, cmd...)
+	// Stdout and stderr share one pipe so that their output is interleaved
+	// as written by the command.
+	c := exec.Command(buildahBin, args...)
+	c.Dir = buildahWorkdir
+	output, err := c.CombinedOutput()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return string(output), exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return "", 0, fmt.Errorf("buildah run: %w", err)
+	}
+	return string(output), 0, nil
+}
+
+// buildahRm removes container.
+func (p *packageImage) buildahRm(container string) error {
+	args := []string{
+		fmt.Sprintf("--storage-driver=%s", p.opts.storageDriver),
+		"rm",
+		container,
+	}
+	return runCmdInDir(buildahBin, args, []string{}, buildahWorkdir, os.Stdout, os.Stderr)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/opendevstack/ods-pipeline-image/internal/oci"
+	"github.com/opendevstack/ods-pipeline-image/internal/oci/ocitest"
+)
+
+func TestStructureTestsRun(t *testing.T) {
+	testsFile := filepath.Join(t.TempDir(), "structure-tests.yaml")
+	err := os.WriteFile(testsFile, []byte(`
+fileExistenceTests:
+- name: config
+  path: /etc/app.conf
+- path: /root/.ssh/id_rsa
+  shouldExist: false
+- path: /etc/missing.conf
+fileContentTests:
+- path: /etc/app.conf
+  expectedContents: ['^port=8080$']
+  excludedContents: [password]
+- path: /etc/other.conf
+  expectedContents: ['^debug$']
+- path: /root/.ssh/id_rsa
+  expectedContents: [key]
+commandTests:
+- name: version
+  command: /app/server
+  args: [--version]
+  expectedOutput: ['^v1\.']
+- name: failing
+  command: "false"
+metadataTest:
+  user: "1001"
+  workdir: /app
+  exposedPorts: ["8080"]
+  env:
+  - key: APP_ENV
+    value: production
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, err := readStructureTests(testsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	l := ocitest.WriteImage(t, dir, "abc", oci.ContainerConfig{
+		User:         "1001",
+		WorkingDir:   "/srv",
+		ExposedPorts: map[string]struct{}{"8080/tcp": {}},
+		Env:          []string{"APP_ENV=production"},
+	},
+		ocitest.Layer{Files: map[string]string{"etc/app.conf": "port=8080", "root/.ssh/id_rsa": "key"}},
+		ocitest.Layer{Files: map[string]string{"etc/other.conf": "debug=false"}},
+		ocitest.Layer{Files: map[string]string{"root/.ssh/.wh.id_rsa": ""}},
+	)
+	m, _, err := l.Manifest("abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := l.Config(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ran []string
+	run := func(cmd []string) (string, int, error) {
+		ran = append(ran, strings.Join(cmd, " "))
+		if cmd[0] == "false" {
+			return "", 1, nil
+		}
+		return "v1.2.3\n", 0, nil
+	}
+
+	got, err := st.run(l, m, c, run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []structureTestResult{
+		{name: "file existence: config"},
+		{name: "file existence: /root/.ssh/id_rsa"},
+		{name: "file existence: /etc/missing.conf", failure: "/etc/missing.conf does not exist"},
+		{name: "file content: /etc/app.conf"},
+		{name: "file content: /etc/other.conf", failure: "expected content to match \"^debug$\""},
+		{name: "file content: /root/.ssh/id_rsa", failure: "/root/.ssh/id_rsa does not exist"},
+		{name: "command: version"},
+		{name: "command: failing", failure: "expected exit code 0, got 1. Output:\n"},
+		{name: "metadata", failure: `expected workdir "/app", got "/srv"`},
+	}
+	if diff := cmp.Diff(want, got, cmp.AllowUnexported(structureTestResult{})); diff != "" {
+		t.Fatalf("results mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"/app/server --version", "false"}, ran); diff != "" {
+		t.Fatalf("commands mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestCheckOutput(t *testing.T) {
+	tests := map[string]struct {
+		s        string
+		expected []string
+		excluded []string
+		want     string
+	}{
+		"matches": {
+			s:        "hello world",
+			expected: []string{"^hello", "world$"},
+			excluded: []string{"error"},
+		},
+		"expected missing": {
+			s:        "hello",
+			expected: []string{"world"},
+			want:     `expected output to match "world"`,
+		},
+		"excluded present": {
+			s:        "error: boom",
+			excluded: []string{"^error"},
+			want:     `expected output not to match "^error"`,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := checkOutput("output", tc.s, tc.expected, tc.excluded)
+			if got != tc.want {
+				t.Fatalf("want %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/google/shlex"
+)
+
+// parseTagPatterns splits the space separated glob patterns in s and
+// verifies that each of them is valid.
+func parseTagPatterns(s string) ([]string, error) {
+	patterns, err := shlex.Split(s)
+	if err != nil {
+		return nil, fmt.Errorf("parse tag patterns (%s): %w", s, err)
+	}
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid tag pattern %q: %w", p, err)
+		}
+	}
+	return patterns, nil
+}
+
+// matchesAnyPattern returns whether tag matches any of the glob patterns.
+func matchesAnyPattern(tag string, patterns []string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, tag); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// checkImmutableTag determines whether an immutable tag needs to be pushed
+// for the image with given digest, based on the digest the tag currently
+// references in the registry (empty if the tag does not exist yet).
+func checkImmutableTag(tag, existingDigest, digest string) (bool, error) {
+	if existingDigest == "" {
+		return true, nil
+	}
+	if existingDigest == digest {
+		return false, nil
+	}
+	return false, fmt.Errorf(
+		"tag %s is immutable and references %s already, refusing to overwrite it with %s",
+		tag, existingDigest, digest,
+	)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestMatchesAnyPattern(t *testing.T) {
+	patterns, err := parseTagPatterns("'[0-9]*.[0-9]*.[0-9]*' release-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]bool{
+		"1.4.0":       true,
+		"release-1":   true,
+		"latest":      false,
+		"1.4":         false,
+		"dev-release": false,
+	}
+	for tag, want := range tests {
+		if got := matchesAnyPattern(tag, patterns); got != want {
+			t.Errorf("tag %s: want match %v, got %v", tag, want, got)
+		}
+	}
+}
+
+func TestParseTagPatternsInvalid(t *testing.T) {
+	if _, err := parseTagPatterns("v[1"); err == nil {
+		t.Fatal("want error for invalid pattern, got none")
+	}
+}
+
+func TestCheckImmutableTag(t *testing.T) {
+	tests := map[string]struct {
+		existingDigest string
+		wantPush       bool
+		wantErr        bool
+	}{
+		"tag does not exist": {
+			existingDigest: "",
+			wantPush:       true,
+		},
+		"tag references same digest": {
+			existingDigest: "sha256:aaa",
+			wantPush:       false,
+		},
+		"tag references other digest": {
+			existingDigest: "sha256:bbb",
+			wantErr:        true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			push, err := checkImmutableTag("1.4.0", tc.existingDigest, "sha256:aaa")
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("want error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if push != tc.wantPush {
+				t.Fatalf("want push %v, got %v", tc.wantPush, push)
+			}
+		})
+	}
+}
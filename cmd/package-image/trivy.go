@@ -1,9 +1,17 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/google/shlex"
 	"github.com/opendevstack/ods-pipeline/pkg/pipelinectxt"
@@ -12,6 +20,9 @@ import (
 const (
 	trivyBin     = "trivy"
 	trivyWorkdir = "/tmp"
+	// trivyDefaultDBRepository is the OCI repository trivy downloads its
+	// vulnerability DB from by default.
+	trivyDefaultDBRepository = "ghcr.io/aquasecurity/trivy-db"
 )
 
 func (p *packageImage) generateImageSBOM() error {
@@ -22,17 +33,214 @@ func (p *packageImage) generateImageSBOM() error {
 	if err != nil {
 		p.logger.Errorf("could not parse extra args (%s): %s", p.opts.trivySBOMExtraArgs, err)
 	}
+	input, err := p.trivyInput()
+	if err != nil {
+		return err
+	}
 	sbomFilename := fmt.Sprintf("%s.%s", p.imageNameNoSha(), pipelinectxt.SBOMsFormat)
 	p.sbomFile = filepath.Join(trivyWorkdir, sbomFilename)
 	args := []string{
 		"image",
 		fmt.Sprintf("--format=%s", pipelinectxt.SBOMsFormat),
-		fmt.Sprintf("--input=%s", filepath.Join(buildahWorkdir, p.imageNameNoSha())),
+		// The image is read from the OCI layout written by buildahPushTar.
+		fmt.Sprintf("--input=%s", input),
 		fmt.Sprintf("--output=%s", p.sbomFile),
 	}
+	dbArgs, err := p.trivyDBArgs()
+	if err != nil {
+		return err
+	}
+	args = append(args, dbArgs...)
 	if p.opts.debug {
 		args = append(args, "--debug=true")
 	}
 	args = append(args, extraArgs...)
-	return runCmdInDir(trivyBin, args, []string{}, trivyWorkdir, os.Stdout, os.Stderr)
+	return p.runTrivy(args, os.Stdout, os.Stderr)
+}
+
+// runTrivy runs trivy, failing if it does not finish within the trivy
+// timeout.
+func (p *packageImage) runTrivy(args []string, outWriter, errWriter io.Writer) error {
+	timeout, err := time.ParseDuration(p.opts.trivyTimeout)
+	if err != nil {
+		return fmt.Errorf("invalid trivy timeout %q: %w", p.opts.trivyTimeout, err)
+	}
+	err = runCmdInDirWithTimeout(timeout, trivyBin, args, []string{}, trivyWorkdir, outWriter, errWriter)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%w, check that the trivy DB repositories are reachable or use a pre-seeded DB", err)
+	}
+	return err
+}
+
+// trivyInput returns the input of trivy image selecting the image in the
+// local OCI layout by the tag it is written with.
+func (p *packageImage) trivyInput() (string, error) {
+	dir, err := p.ociLayoutDir()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s@%s", dir, p.imageId.GitCommitSHA), nil
+}
+
+// trivyCacheDir returns the cache dir of trivy holding its DBs, or an empty
+// string for the default of trivy. Relative dirs are relative to the checkout
+// dir. The returned dir is absolute as trivy does not run in the checkout dir.
+func (p *packageImage) trivyCacheDir() (string, error) {
+	dir := p.opts.trivyCacheDir
+	if dir == "" || filepath.IsAbs(dir) {
+		return dir, nil
+	}
+	absDir, err := filepath.Abs(p.opts.checkoutDir)
+	if err != nil {
+		return "", fmt.Errorf("abs dir: %w", err)
+	}
+	return filepath.Join(absDir, dir), nil
+}
+
+// trivyDBArgs returns the args of trivy image selecting the cache dir and DB
+// repositories. The DBs are not updated if they are pre-seeded or have been
+// downloaded already by prepareTrivyDB.
+func (p *packageImage) trivyDBArgs() ([]string, error) {
+	dir, err := p.trivyCacheDir()
+	if err != nil {
+		return nil, err
+	}
+	var args []string
+	if dir != "" {
+		args = append(args, fmt.Sprintf("--cache-dir=%s", dir))
+	}
+	if p.opts.trivyDBRepository != "" {
+		args = append(args, fmt.Sprintf("--db-repository=%s", p.opts.trivyDBRepository))
+	}
+	if p.opts.trivyJavaDBRepository != "" {
+		args = append(args, fmt.Sprintf("--java-db-repository=%s", p.opts.trivyJavaDBRepository))
+	}
+	args = append(args, fmt.Sprintf("--timeout=%s", p.opts.trivyTimeout))
+	if p.opts.trivySkipDBUpdate {
+		args = append(args, "--skip-db-update", "--skip-java-db-update", "--offline-scan")
+	} else if p.trivyDB != nil {
+		args = append(args, "--skip-db-update")
+	}
+	return args, nil
+}
+
+// trivyDBRepository returns the repository the vulnerability DB is
+// downloaded from.
+func (p *packageImage) trivyDBRepository() string {
+	if p.opts.trivyDBRepository != "" {
+		return p.opts.trivyDBRepository
+	}
+	return trivyDefaultDBRepository
+}
+
+// prepareTrivyDB downloads the vulnerability DB unless it is pre-seeded,
+// reports its version and checks that it is not older than the maximum age.
+func (p *packageImage) prepareTrivyDB() error {
+	if !p.opts.trivySkipDBUpdate {
+		p.logger.Infof("Downloading trivy vulnerability DB from %s ...", p.trivyDBRepository())
+		dbArgs, err := p.trivyDBArgs()
+		if err != nil {
+			return err
+		}
+		args := append([]string{"image", "--download-db-only"}, dbArgs...)
+		if err := p.runTrivy(args, os.Stdout, os.Stderr); err != nil {
+			return fmt.Errorf("download trivy vulnerability DB from %s: %w", p.trivyDBRepository(), err)
+		}
+	}
+	v, err := p.trivyVersion()
+	if err != nil {
+		return err
+	}
+	if v.VulnerabilityDB == nil {
+		dir, err := p.trivyCacheDir()
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("no trivy vulnerability DB in cache dir %s", dir)
+	}
+	db := v.VulnerabilityDB
+	p.logger.Infof(
+		"Using trivy %s with vulnerability DB version %d, updated at %s, downloaded at %s",
+		v.Version, db.Version, db.UpdatedAt.Format(time.RFC3339), db.DownloadedAt.Format(time.RFC3339),
+	)
+	if v.JavaDB != nil {
+		p.logger.Infof(
+			"Using trivy Java DB version %d, updated at %s, downloaded at %s",
+			v.JavaDB.Version, v.JavaDB.UpdatedAt.Format(time.RFC3339), v.JavaDB.DownloadedAt.Format(time.RFC3339),
+		)
+	}
+	if err := checkTrivyDBAge(db.UpdatedAt, p.opts.trivyDBMaxAge, time.Now()); err != nil {
+		return err
+	}
+	p.trivyDB = v
+	return nil
+}
+
+// checkTrivyDBAge fails if the DB updated at updatedAt is older than maxAge
+// at now. maxAge is a duration such as "72h" or "3d", empty disables the
+// check.
+func checkTrivyDBAge(updatedAt time.Time, maxAge string, now time.Time) error {
+	if maxAge == "" {
+		return nil
+	}
+	age, err := parseDays(maxAge)
+	if err != nil {
+		return fmt.Errorf("invalid trivy DB max age %q: %w", maxAge, err)
+	}
+	if now.Sub(updatedAt) > age {
+		return fmt.Errorf(
+			"trivy vulnerability DB was updated at %s, which is more than the maximum age of %s ago, update the DB mirror or pre-seeded DB",
+			updatedAt.Format(time.RFC3339), maxAge,
+		)
+	}
+	return nil
+}
+
+// parseDays parses a duration like time.ParseDuration, additionally
+// accepting a number of days such as "3d".
+func parseDays(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid number of days %q", days)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// trivyDBInfo describes a DB of trivy.
+type trivyDBInfo struct {
+	Version      int       `json:"Version"`
+	NextUpdate   time.Time `json:"NextUpdate"`
+	UpdatedAt    time.Time `json:"UpdatedAt"`
+	DownloadedAt time.Time `json:"DownloadedAt"`
+}
+
+// trivyVersionInfo is the output of trivy --version --format=json.
+type trivyVersionInfo struct {
+	Version         string       `json:"Version"`
+	VulnerabilityDB *trivyDBInfo `json:"VulnerabilityDB"`
+	JavaDB          *trivyDBInfo `json:"JavaDB"`
+}
+
+// trivyVersion returns the version of trivy and its DBs in the cache dir.
+func (p *packageImage) trivyVersion() (*trivyVersionInfo, error) {
+	var stdout, stderr bytes.Buffer
+	dir, err := p.trivyCacheDir()
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"--version", "--format=json"}
+	if dir != "" {
+		args = append(args, fmt.Sprintf("--cache-dir=%s", dir))
+	}
+	if err := p.runTrivy(args, &stdout, &stderr); err != nil {
+		return nil, fmt.Errorf("determine trivy version: %w: %s", err, stderr.String())
+	}
+	var v trivyVersionInfo
+	if err := json.Unmarshal(stdout.Bytes(), &v); err != nil {
+		return nil, fmt.Errorf("parse trivy version: %w", err)
+	}
+	return &v, nil
 }
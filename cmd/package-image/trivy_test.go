@@ -0,0 +1,158 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/opendevstack/ods-pipeline-image/internal/image"
+)
+
+func TestTrivyInput(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &packageImage{
+		opts:    options{checkoutDir: "."},
+		imageId: image.Identity{ImageStream: "foo", GitCommitSHA: "abc123"},
+	}
+	dir, err := p.ociLayoutDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(wd, "foo"); dir != want {
+		t.Fatalf("want OCI layout dir %s, got %s", want, dir)
+	}
+	got, err := p.trivyInput()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(wd, "foo") + "@abc123"; got != want {
+		t.Fatalf("want trivy input %s, got %s", want, got)
+	}
+}
+
+func TestTrivyDBArgs(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]struct {
+		opts     options
+		prepared bool
+		want     []string
+	}{
+		"defaults": {
+			opts: options{trivyTimeout: "10m"},
+			want: []string{"--timeout=10m"},
+		},
+		"prepared DB is not updated again": {
+			opts:     options{trivyTimeout: "10m"},
+			prepared: true,
+			want:     []string{"--timeout=10m", "--skip-db-update"},
+		},
+		"mirrors and relative cache dir": {
+			opts: options{
+				checkoutDir:           "/workspace/source",
+				trivyCacheDir:         ".trivy",
+				trivyDBRepository:     "registry.example.com/mirror/trivy-db",
+				trivyJavaDBRepository: "registry.example.com/mirror/trivy-java-db",
+				trivyTimeout:          "5m",
+			},
+			want: []string{
+				"--cache-dir=/workspace/source/.trivy",
+				"--db-repository=registry.example.com/mirror/trivy-db",
+				"--java-db-repository=registry.example.com/mirror/trivy-java-db",
+				"--timeout=5m",
+			},
+		},
+		"cache dir in relative checkout dir": {
+			opts: options{
+				checkoutDir:   ".",
+				trivyCacheDir: ".trivy",
+				trivyTimeout:  "10m",
+			},
+			want: []string{
+				"--cache-dir=" + filepath.Join(wd, ".trivy"),
+				"--timeout=10m",
+			},
+		},
+		"pre-seeded DB in absolute cache dir": {
+			opts: options{
+				checkoutDir:       "/workspace/source",
+				trivyCacheDir:     "/var/cache/trivy",
+				trivySkipDBUpdate: true,
+				trivyTimeout:      "10m",
+			},
+			want: []string{
+				"--cache-dir=/var/cache/trivy",
+				"--timeout=10m",
+				"--skip-db-update",
+				"--skip-java-db-update",
+				"--offline-scan",
+			},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			p := &packageImage{opts: tc.opts}
+			if tc.prepared {
+				p.trivyDB = &trivyVersionInfo{}
+			}
+			got, err := p.trivyDBArgs()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Fatalf("args mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCheckTrivyDBAge(t *testing.T) {
+	now := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	tests := map[string]struct {
+		updatedAt time.Time
+		maxAge    string
+		wantErr   bool
+	}{
+		"no max age": {
+			updatedAt: now.Add(-30 * 24 * time.Hour),
+			maxAge:    "",
+		},
+		"within max age in days": {
+			updatedAt: now.Add(-47 * time.Hour),
+			maxAge:    "2d",
+		},
+		"older than max age in days": {
+			updatedAt: now.Add(-49 * time.Hour),
+			maxAge:    "2d",
+			wantErr:   true,
+		},
+		"older than max age in hours": {
+			updatedAt: now.Add(-13 * time.Hour),
+			maxAge:    "12h",
+			wantErr:   true,
+		},
+		"invalid max age": {
+			updatedAt: now,
+			maxAge:    "xd",
+			wantErr:   true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := checkTrivyDBAge(tc.updatedAt, tc.maxAge, now)
+			if tc.wantErr && err == nil {
+				t.Fatal("want error, got none")
+			}
+			if !tc.wantErr && err != nil {
+				t.Fatalf("want no error, got %s", err)
+			}
+		})
+	}
+}
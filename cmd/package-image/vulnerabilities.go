@@ -0,0 +1,340 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/shlex"
+	"github.com/opendevstack/ods-pipeline-image/internal/vex"
+	"github.com/opendevstack/ods-pipeline/pkg/pipelinectxt"
+)
+
+const (
+	// vulnerabilityReportsPath is the artifacts path of vulnerability reports.
+	vulnerabilityReportsPath = pipelinectxt.ArtifactsPath + "/vulnerability-reports"
+	// vulnAttestationType is the cosign attestation type of vulnerability
+	// reports.
+	vulnAttestationType = "vuln"
+	// vulnArtifactType is the artifact type of vulnerability reports
+	// attached to images.
+	vulnArtifactType = "application/vnd.cosign.vuln.v1+json"
+)
+
+// cosignVulnPredicate is the predicate of cosign vulnerability attestations,
+// see https://github.com/sigstore/cosign/blob/main/specs/COSIGN_VULN_ATTESTATION_SPEC.md.
+type cosignVulnPredicate struct {
+	Invocation cosignVulnInvocation `json:"invocation"`
+	Scanner    cosignVulnScanner    `json:"scanner"`
+	Metadata   cosignVulnMetadata   `json:"metadata"`
+}
+
+type cosignVulnInvocation struct {
+	Parameters interface{} `json:"parameters"`
+	URI        string      `json:"uri"`
+	EventID    string      `json:"event_id"`
+	BuilderID  string      `json:"builder.id"`
+}
+
+type cosignVulnScanner struct {
+	URI     string       `json:"uri"`
+	Version string       `json:"version"`
+	DB      cosignVulnDB `json:"db"`
+	// Result is the trivy JSON report.
+	Result json.RawMessage `json:"result"`
+}
+
+type cosignVulnDB struct {
+	URI     string `json:"uri"`
+	Version string `json:"version"`
+}
+
+type cosignVulnMetadata struct {
+	ScanStartedOn  time.Time `json:"scanStartedOn"`
+	ScanFinishedOn time.Time `json:"scanFinishedOn"`
+}
+
+// trivyVulnerability holds the fields of vulnerabilities in trivy JSON
+// reports needed to match them against VEX statements.
+type trivyVulnerability struct {
+	VulnerabilityID string `json:"VulnerabilityID"`
+	PkgName         string `json:"PkgName"`
+	Severity        string `json:"Severity"`
+	PkgIdentifier   struct {
+		PURL string `json:"PURL"`
+	} `json:"PkgIdentifier"`
+	PkgRef string `json:"PkgRef"`
+}
+
+func (v trivyVulnerability) purl() string {
+	if v.PkgIdentifier.PURL != "" {
+		return v.PkgIdentifier.PURL
+	}
+	return v.PkgRef
+}
+
+// modifiedFinding records a vulnerability suppressed by a VEX statement, in
+// the format used by later trivy versions.
+type modifiedFinding struct {
+	Type            string          `json:"Type"`
+	Status          string          `json:"Status"`
+	Statement       string          `json:"Statement,omitempty"`
+	ImpactStatement string          `json:"ImpactStatement,omitempty"`
+	Source          string          `json:"Source"`
+	Finding         json.RawMessage `json:"Finding"`
+}
+
+// vulnSummary counts the vulnerabilities of a report.
+type vulnSummary struct {
+	bySeverity map[string]int
+	suppressed int
+}
+
+func (s vulnSummary) String() string {
+	var severities []string
+	total := 0
+	for severity, n := range s.bySeverity {
+		severities = append(severities, severity)
+		total += n
+	}
+	order := map[string]int{"CRITICAL": 0, "HIGH": 1, "MEDIUM": 2, "LOW": 3, "UNKNOWN": 4}
+	sort.Slice(severities, func(i, j int) bool {
+		oi, ok := order[severities[i]]
+		if !ok {
+			oi = len(order)
+		}
+		oj, ok := order[severities[j]]
+		if !ok {
+			oj = len(order)
+		}
+		if oi != oj {
+			return oi < oj
+		}
+		return severities[i] < severities[j]
+	})
+	var parts []string
+	for _, severity := range severities {
+		parts = append(parts, fmt.Sprintf("%d %s", s.bySeverity[severity], severity))
+	}
+	summary := fmt.Sprintf("%d vulnerabilities", total)
+	if len(parts) > 0 {
+		summary += fmt.Sprintf(" (%s)", strings.Join(parts, ", "))
+	}
+	return fmt.Sprintf("%s, %d suppressed by VEX statements", summary, s.suppressed)
+}
+
+// scanVulnerabilities scans the image in the local OCI layout with trivy,
+// suppresses vulnerabilities the VEX documents declare as not affecting the
+// image, and writes the result as cosign vulnerability predicate artifact.
+func (p *packageImage) scanVulnerabilities() error {
+	docs, sources, err := readVEXDocuments(p.opts.checkoutDir, p.opts.vexFiles)
+	if err != nil {
+		return err
+	}
+	for _, pattern := range strings.Fields(p.opts.vexFiles) {
+		if !containsMatch(sources, p.opts.checkoutDir, pattern) {
+			p.logger.Warnf("No VEX documents match %s", pattern)
+		}
+	}
+
+	if err := p.prepareTrivyDB(); err != nil {
+		return err
+	}
+	started := time.Now().UTC()
+	trivyReport := filepath.Join(trivyWorkdir, fmt.Sprintf("%s-vulnerabilities.json", p.imageNameNoSha()))
+	if err := p.runTrivyVulnScan(trivyReport); err != nil {
+		return err
+	}
+	finished := time.Now().UTC()
+	report, err := os.ReadFile(trivyReport)
+	if err != nil {
+		return err
+	}
+	imagePURL := fmt.Sprintf("pkg:oci/%s@%s", p.imageNameNoSha(), strings.Replace(p.imageDigest, ":", "%3A", 1))
+	result, summary, err := applyVEX(report, docs, sources, imagePURL)
+	if err != nil {
+		return err
+	}
+
+	predicate := cosignVulnPredicate{
+		Scanner: cosignVulnScanner{
+			URI:    "pkg:github/aquasecurity/trivy",
+			Result: result,
+		},
+		Metadata: cosignVulnMetadata{ScanStartedOn: started, ScanFinishedOn: finished},
+	}
+	if p.ctxt != nil {
+		predicate.Invocation.URI = p.ctxt.GitURL
+	}
+	if v := p.trivyDB; v != nil {
+		predicate.Scanner.URI = fmt.Sprintf("pkg:github/aquasecurity/trivy@%s", v.Version)
+		predicate.Scanner.Version = v.Version
+		predicate.Scanner.DB = cosignVulnDB{
+			URI:     p.trivyDBRepository(),
+			Version: fmt.Sprintf("%d (updated at %s)", v.VulnerabilityDB.Version, v.VulnerabilityDB.UpdatedAt.Format(time.RFC3339)),
+		}
+	}
+	reportsDir := filepath.Join(p.opts.checkoutDir, vulnerabilityReportsPath)
+	filename := fmt.Sprintf("%s.json", p.imageNameNoSha())
+	if err := pipelinectxt.WriteJsonArtifact(predicate, reportsDir, filename); err != nil {
+		return err
+	}
+	p.vulnReportFile = filepath.Join(reportsDir, filename)
+	p.logger.Infof("Image %s has %s", p.imageName(), summary)
+	return nil
+}
+
+// runTrivyVulnScan scans the image in the local OCI layout for
+// vulnerabilities and writes the trivy JSON report to output.
+func (p *packageImage) runTrivyVulnScan(output string) error {
+	extraArgs, err := shlex.Split(p.opts.trivyVulnExtraArgs)
+	if err != nil {
+		return fmt.Errorf("parse extra args (%s): %w", p.opts.trivyVulnExtraArgs, err)
+	}
+	input, err := p.trivyInput()
+	if err != nil {
+		return err
+	}
+	args := []string{
+		"image",
+		"--format=json",
+		"--scanners=vuln",
+		fmt.Sprintf("--input=%s", input),
+		fmt.Sprintf("--output=%s", output),
+	}
+	dbArgs, err := p.trivyDBArgs()
+	if err != nil {
+		return err
+	}
+	args = append(args, dbArgs...)
+	if p.opts.debug {
+		args = append(args, "--debug=true")
+	}
+	args = append(args, extraArgs...)
+	return p.runTrivy(args, os.Stdout, os.Stderr)
+}
+
+// readVEXDocuments reads the OpenVEX documents matching the space separated
+// glob patterns relative to dir, and returns them with their paths.
+func readVEXDocuments(dir, patterns string) ([]*vex.Document, []string, error) {
+	var docs []*vex.Document
+	var sources []string
+	for _, pattern := range strings.Fields(patterns) {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid VEX file pattern %s: %w", pattern, err)
+		}
+		for _, m := range matches {
+			d, err := vex.ReadFile(m)
+			if err != nil {
+				return nil, nil, err
+			}
+			rel, err := filepath.Rel(dir, m)
+			if err != nil {
+				rel = m
+			}
+			docs = append(docs, d)
+			sources = append(sources, rel)
+		}
+	}
+	return docs, sources, nil
+}
+
+// containsMatch returns whether one of the paths relative to dir matches
+// pattern.
+func containsMatch(paths []string, dir, pattern string) bool {
+	for _, p := range paths {
+		if ok, _ := filepath.Match(filepath.Join(dir, pattern), filepath.Join(dir, p)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// applyVEX removes the vulnerabilities of the trivy JSON report which a VEX
+// statement declares as not affecting the image, and records them with the
+// justification as modified findings of their result.
+func applyVEX(report []byte, docs []*vex.Document, sources []string, imagePURL string) (json.RawMessage, vulnSummary, error) {
+	summary := vulnSummary{bySeverity: map[string]int{}}
+	var r map[string]json.RawMessage
+	if err := json.Unmarshal(report, &r); err != nil {
+		return nil, summary, fmt.Errorf("parse vulnerability report: %w", err)
+	}
+	var results []map[string]json.RawMessage
+	if len(r["Results"]) > 0 {
+		if err := json.Unmarshal(r["Results"], &results); err != nil {
+			return nil, summary, fmt.Errorf("parse vulnerability report results: %w", err)
+		}
+	}
+	for _, result := range results {
+		var raws []json.RawMessage
+		if len(result["Vulnerabilities"]) > 0 {
+			if err := json.Unmarshal(result["Vulnerabilities"], &raws); err != nil {
+				return nil, summary, fmt.Errorf("parse vulnerabilities: %w", err)
+			}
+		}
+		var kept []json.RawMessage
+		var modified []modifiedFinding
+		for _, raw := range raws {
+			var v trivyVulnerability
+			if err := json.Unmarshal(raw, &v); err != nil {
+				return nil, summary, fmt.Errorf("parse vulnerability: %w", err)
+			}
+			s, source := findVEXStatement(docs, sources, v.VulnerabilityID, v.purl(), imagePURL)
+			if s == nil || s.Status != vex.StatusNotAffected {
+				kept = append(kept, raw)
+				summary.bySeverity[v.Severity]++
+				continue
+			}
+			modified = append(modified, modifiedFinding{
+				Type:            "vulnerability",
+				Status:          s.Status,
+				Statement:       s.Justification,
+				ImpactStatement: s.ImpactStatement,
+				Source:          source,
+				Finding:         raw,
+			})
+			summary.suppressed++
+		}
+		if len(modified) == 0 {
+			continue
+		}
+		b, err := json.Marshal(kept)
+		if err != nil {
+			return nil, summary, err
+		}
+		result["Vulnerabilities"] = b
+		if len(kept) == 0 {
+			delete(result, "Vulnerabilities")
+		}
+		b, err = json.Marshal(modified)
+		if err != nil {
+			return nil, summary, err
+		}
+		result["ModifiedFindings"] = b
+	}
+	if results != nil {
+		b, err := json.Marshal(results)
+		if err != nil {
+			return nil, summary, err
+		}
+		r["Results"] = b
+	}
+	b, err := json.Marshal(r)
+	return b, summary, err
+}
+
+// findVEXStatement returns the last statement of docs about the
+// vulnerability and the path of the document containing it.
+func findVEXStatement(docs []*vex.Document, sources []string, vulnID, purl, imagePURL string) (*vex.Statement, string) {
+	for i := len(docs) - 1; i >= 0; i-- {
+		if s := vex.Find(docs[i:i+1], vulnID, purl, imagePURL); s != nil {
+			return s, sources[i]
+		}
+	}
+	return nil, ""
+}
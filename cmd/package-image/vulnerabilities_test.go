@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/opendevstack/ods-pipeline-image/internal/vex"
+)
+
+const trivyVulnReport = `{
+  "SchemaVersion": 2,
+  "ArtifactName": "/workspace/source/app:abc",
+  "Results": [
+    {
+      "Target": "app (redhat 9.3)",
+      "Class": "os-pkgs",
+      "Vulnerabilities": [
+        {"VulnerabilityID": "CVE-2023-0001", "PkgName": "openssl-libs", "PkgIdentifier": {"PURL": "pkg:rpm/redhat/openssl-libs@3.0.7-24.el9?arch=x86_64"}, "Severity": "HIGH"},
+        {"VulnerabilityID": "CVE-2023-0002", "PkgName": "zlib", "PkgIdentifier": {"PURL": "pkg:rpm/redhat/zlib@1.2.11-40.el9?arch=x86_64"}, "Severity": "MEDIUM"}
+      ]
+    },
+    {
+      "Target": "app/app.jar",
+      "Class": "lang-pkgs",
+      "Vulnerabilities": [
+        {"VulnerabilityID": "CVE-2023-0003", "PkgName": "com.example:lib", "PkgIdentifier": {"PURL": "pkg:maven/com.example/lib@1.0"}, "Severity": "CRITICAL"}
+      ]
+    },
+    {
+      "Target": "Java",
+      "Class": "lang-pkgs"
+    }
+  ]
+}`
+
+func TestApplyVEX(t *testing.T) {
+	docs := []*vex.Document{
+		{Statements: []vex.Statement{
+			{
+				Vulnerability: vex.Vulnerability{Name: "CVE-2023-0003"},
+				Products:      []vex.Product{{ID: "pkg:maven/com.example/lib"}},
+				Status:        vex.StatusNotAffected,
+				Justification: "vulnerable_code_not_in_execute_path",
+			},
+			{
+				Vulnerability: vex.Vulnerability{Name: "CVE-2023-0002"},
+				Products:      []vex.Product{{ID: "pkg:oci/app"}},
+				Status:        "under_investigation",
+			},
+		}},
+		{Statements: []vex.Statement{
+			{
+				Vulnerability:   vex.Vulnerability{Name: "CVE-2023-0001"},
+				Products:        []vex.Product{{ID: "pkg:oci/app@sha256%3Aabc", Subcomponents: []vex.Product{{ID: "pkg:rpm/redhat/openssl-libs"}}}},
+				Status:          vex.StatusNotAffected,
+				Justification:   "inline_mitigations_already_exist",
+				ImpactStatement: "FIPS mode is enforced",
+			},
+		}},
+	}
+	sources := []string{".vex/app.openvex.json", ".vex/base.openvex.json"}
+	got, summary, err := applyVEX([]byte(trivyVulnReport), docs, sources, "pkg:oci/app@sha256%3Aabc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "1 vulnerabilities (1 MEDIUM), 2 suppressed by VEX statements"; summary.String() != want {
+		t.Fatalf("want summary %q, got %q", want, summary.String())
+	}
+
+	var report struct {
+		Results []struct {
+			Target           string
+			Vulnerabilities  []trivyVulnerability
+			ModifiedFindings []modifiedFinding
+		}
+	}
+	if err := json.Unmarshal(got, &report); err != nil {
+		t.Fatal(err)
+	}
+	type result struct {
+		target     string
+		vulns      []string
+		suppressed []string
+	}
+	var results []result
+	for _, r := range report.Results {
+		res := result{target: r.Target}
+		for _, v := range r.Vulnerabilities {
+			res.vulns = append(res.vulns, v.VulnerabilityID)
+		}
+		for _, m := range r.ModifiedFindings {
+			var v trivyVulnerability
+			if err := json.Unmarshal(m.Finding, &v); err != nil {
+				t.Fatal(err)
+			}
+			res.suppressed = append(res.suppressed, v.VulnerabilityID+" "+m.Status+" "+m.Statement+" "+m.ImpactStatement+" "+m.Source)
+		}
+		results = append(results, res)
+	}
+	want := []result{
+		{
+			target:     "app (redhat 9.3)",
+			vulns:      []string{"CVE-2023-0002"},
+			suppressed: []string{"CVE-2023-0001 not_affected inline_mitigations_already_exist FIPS mode is enforced .vex/base.openvex.json"},
+		},
+		{
+			target:     "app/app.jar",
+			suppressed: []string{"CVE-2023-0003 not_affected vulnerable_code_not_in_execute_path  .vex/app.openvex.json"},
+		},
+		{target: "Java"},
+	}
+	if diff := cmp.Diff(want, results, cmp.AllowUnexported(result{})); diff != "" {
+		t.Fatalf("results mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestVulnSummary(t *testing.T) {
+	s := vulnSummary{bySeverity: map[string]int{"LOW": 3, "CRITICAL": 1, "UNKNOWN": 2, "HIGH": 4}, suppressed: 1}
+	want := "10 vulnerabilities (1 CRITICAL, 4 HIGH, 3 LOW, 2 UNKNOWN), 1 suppressed by VEX statements"
+	if got := s.String(); got != want {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+	if got := (vulnSummary{bySeverity: map[string]int{}}).String(); got != "0 vulnerabilities, 0 suppressed by VEX statements" {
+		t.Fatalf("unexpected summary of empty report: %q", got)
+	}
+}
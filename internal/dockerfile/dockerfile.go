@@ -0,0 +1,253 @@
+// Package dockerfile parses Dockerfiles into instructions and build stages
+// using the parser of BuildKit, and renders them with modified base images.
+package dockerfile
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+	"github.com/moby/buildkit/frontend/dockerfile/shell"
+)
+
+// Scratch is the reserved name of the empty base image.
+const Scratch = "scratch"
+
+// Dockerfile is a parsed Dockerfile.
+type Dockerfile struct {
+	// Lines holds the raw lines of the Dockerfile.
+	Lines []string
+	// Instructions holds all instructions in order.
+	Instructions []Instruction
+	// Args holds the ARG instructions declared before the first FROM.
+	Args []Arg
+	// Stages holds the build stages in order.
+	Stages []Stage
+
+	escape rune
+}
+
+// Instruction is a single (possibly multi-line) instruction.
+type Instruction struct {
+	// Command is the upper-cased instruction, e.g. "FROM".
+	Command string
+	// Flags holds the leading flags of the instruction, e.g. "--from=build".
+	Flags []string
+	// Args is the remainder of the instruction with continuations joined.
+	Args string
+	// Values holds the arguments as split by the parser, e.g. the sources
+	// and destination of COPY, or alternating keys and values of ENV.
+	Values []string
+	// Heredocs holds the content of heredocs following the instruction.
+	Heredocs []string
+	// StartLine and EndLine are the 1-based lines the instruction spans.
+	StartLine int
+	EndLine   int
+}
+
+// Flag returns the value of the flag with given name (without leading
+// dashes) and whether it is set.
+func (i Instruction) Flag(name string) (string, bool) {
+	for _, f := range i.Flags {
+		k, v, _ := strings.Cut(strings.TrimPrefix(f, "--"), "=")
+		if k == name {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// Arg is a build argument declared by an ARG instruction.
+type Arg struct {
+	Name string
+	// Default is nil if the ARG has no default value.
+	Default *string
+}
+
+// Stage is a build stage started by a FROM instruction.
+type Stage struct {
+	// Index is the position of the stage in the Dockerfile.
+	Index int
+	// Name is the name given with "AS", if any.
+	Name string
+	// Base is the unexpanded base image expression.
+	Base string
+	// From is the FROM instruction starting the stage.
+	From Instruction
+	// Instructions holds the instructions of the stage following FROM.
+	Instructions []Instruction
+}
+
+// ParseFile parses the Dockerfile at filename.
+func ParseFile(filename string) (*Dockerfile, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	df, err := Parse(b)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", filename, err)
+	}
+	return df, nil
+}
+
+// Parse parses the given Dockerfile content with the parser of BuildKit.
+func Parse(content []byte) (*Dockerfile, error) {
+	result, err := parser.Parse(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	df := &Dockerfile{escape: result.EscapeToken}
+	sc := bufio.NewScanner(bytes.NewReader(content))
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for sc.Scan() {
+		df.Lines = append(df.Lines, strings.TrimSuffix(sc.Text(), "\r"))
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	for _, node := range result.AST.Children {
+		inst := newInstruction(node)
+		if err := df.add(inst); err != nil {
+			return nil, fmt.Errorf("line %d: %w", inst.StartLine, err)
+		}
+	}
+	return df, nil
+}
+
+func newInstruction(node *parser.Node) Instruction {
+	inst := Instruction{
+		Command:   strings.ToUpper(node.Value),
+		Flags:     node.Flags,
+		StartLine: node.StartLine,
+		EndLine:   node.EndLine,
+	}
+	// The parser keeps the original line with continuations joined, which
+	// starts with the command and flags.
+	_, rest, _ := strings.Cut(strings.TrimSpace(node.Original), " ")
+	rest = strings.TrimSpace(rest)
+	for range node.Flags {
+		_, rest, _ = strings.Cut(rest, " ")
+		rest = strings.TrimSpace(rest)
+	}
+	inst.Args = rest
+	for n := node.Next; n != nil; n = n.Next {
+		inst.Values = append(inst.Values, n.Value)
+	}
+	for _, h := range node.Heredocs {
+		inst.Heredocs = append(inst.Heredocs, strings.TrimSuffix(h.Content, "\n"))
+	}
+	return inst
+}
+
+func (df *Dockerfile) add(inst Instruction) error {
+	df.Instructions = append(df.Instructions, inst)
+	switch {
+	case inst.Command == "FROM":
+		s := Stage{Index: len(df.Stages), From: inst}
+		switch {
+		case len(inst.Values) == 1:
+			s.Base = inst.Values[0]
+		case len(inst.Values) == 3 && strings.EqualFold(inst.Values[1], "AS"):
+			s.Base, s.Name = inst.Values[0], strings.ToLower(inst.Values[2])
+		default:
+			return fmt.Errorf("invalid FROM instruction %q", inst.Args)
+		}
+		df.Stages = append(df.Stages, s)
+	case len(df.Stages) == 0:
+		if inst.Command != "ARG" {
+			return fmt.Errorf("%s instruction before FROM", inst.Command)
+		}
+		for _, v := range inst.Values {
+			name, value, ok := strings.Cut(v, "=")
+			a := Arg{Name: name}
+			if ok {
+				a.Default = &value
+			}
+			df.Args = append(df.Args, a)
+		}
+	default:
+		s := &df.Stages[len(df.Stages)-1]
+		s.Instructions = append(s.Instructions, inst)
+	}
+	return nil
+}
+
+// GlobalArgs returns the values of the ARGs declared before the first FROM.
+// Values given in buildArgs override defaults of declared ARGs. Build args
+// which are not declared are ignored, as they are by the builder.
+func (df *Dockerfile) GlobalArgs(buildArgs map[string]string) map[string]string {
+	values := map[string]string{}
+	for _, a := range df.Args {
+		if v, ok := buildArgs[a.Name]; ok {
+			values[a.Name] = v
+		} else if a.Default != nil {
+			values[a.Name] = df.expand(*a.Default, values)
+		}
+	}
+	return values
+}
+
+// Base returns the base image of stage i with ARGs expanded, and the index
+// of the earlier stage it refers to, or -1 if it refers to an image.
+func (df *Dockerfile) Base(i int, buildArgs map[string]string) (string, int) {
+	base := df.expand(df.Stages[i].Base, df.GlobalArgs(buildArgs))
+	for j := 0; j < i; j++ {
+		if df.Stages[j].Name != "" && strings.EqualFold(df.Stages[j].Name, base) {
+			return base, j
+		}
+	}
+	return base, -1
+}
+
+// WithBases renders the Dockerfile with the base images of the stages given
+// as keys of bases replaced by the values. Flags and stage names of the FROM
+// instructions are kept.
+func (df *Dockerfile) WithBases(bases map[int]string) []byte {
+	replace := map[int]Stage{}
+	for i, s := range df.Stages {
+		if _, ok := bases[i]; ok {
+			replace[s.From.StartLine] = s
+		}
+	}
+	var buf bytes.Buffer
+	for n := 1; n <= len(df.Lines); n++ {
+		s, ok := replace[n]
+		if !ok {
+			buf.WriteString(df.Lines[n-1])
+			buf.WriteString("\n")
+			continue
+		}
+		fields := append([]string{"FROM"}, s.From.Flags...)
+		fields = append(fields, bases[s.Index])
+		if s.Name != "" {
+			fields = append(fields, "AS", s.Name)
+		}
+		buf.WriteString(strings.Join(fields, " "))
+		buf.WriteString("\n")
+		n = s.From.EndLine
+	}
+	return buf.Bytes()
+}
+
+// Expand expands variables in s with the given values like the builder
+// does, using the default escape character. Unset variables expand to the
+// empty string. If s cannot be expanded, it is returned unchanged.
+func Expand(s string, values map[string]string) string {
+	return expand(shell.NewLex(parser.DefaultEscapeToken), s, values)
+}
+
+func (df *Dockerfile) expand(s string, values map[string]string) string {
+	return expand(shell.NewLex(df.escape), s, values)
+}
+
+func expand(lex *shell.Lex, s string, values map[string]string) string {
+	v, err := lex.ProcessWordWithMap(s, values)
+	if err != nil {
+		return s
+	}
+	return v
+}
@@ -0,0 +1,145 @@
+package dockerfile_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/opendevstack/ods-pipeline-image/internal/dockerfile"
+)
+
+const multiStage = `# syntax=docker/dockerfile:1
+ARG REGISTRY=docker.io
+ARG GO_VERSION
+ARG BASE=${REGISTRY}/library/alpine
+
+FROM --platform=linux/amd64 ${REGISTRY}/library/golang:${GO_VERSION:-1.21} AS Build
+RUN go build \
+    # build the server
+    -o /server .
+
+FROM build as test
+RUN go test ./...
+
+FROM $BASE:3.19
+COPY --from=build /server /server
+RUN <<EOF
+echo done
+EOF
+CMD ["/server"]
+`
+
+func TestParse(t *testing.T) {
+	df, err := dockerfile.Parse([]byte(multiStage))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(df.Stages) != 3 {
+		t.Fatalf("want 3 stages, got %d", len(df.Stages))
+	}
+	build := df.Stages[0]
+	if build.Name != "build" || build.From.StartLine != 6 {
+		t.Fatalf("unexpected first stage: %+v", build)
+	}
+	if v, _ := build.From.Flag("platform"); v != "linux/amd64" {
+		t.Fatalf("want platform flag, got %q", v)
+	}
+	run := build.Instructions[0]
+	if run.Args != "go build     -o /server ." || run.StartLine != 7 || run.EndLine != 9 {
+		t.Fatalf("unexpected continued instruction: %+v", run)
+	}
+	final := df.Stages[2]
+	if diff := cmp.Diff([]string{"/server", "/server"}, final.Instructions[0].Values); diff != "" {
+		t.Fatalf("COPY values mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"echo done"}, final.Instructions[1].Heredocs); diff != "" {
+		t.Fatalf("heredoc mismatch (-want +got):\n%s", diff)
+	}
+	if final.Instructions[2].Command != "CMD" {
+		t.Fatalf("want CMD after heredoc, got %s", final.Instructions[2].Command)
+	}
+
+	type base struct {
+		Ref   string
+		Stage int
+	}
+	var got []base
+	for i := range df.Stages {
+		ref, stage := df.Base(i, map[string]string{"REGISTRY": "mirror.example.com", "UNDECLARED": "x"})
+		got = append(got, base{ref, stage})
+	}
+	want := []base{
+		{"mirror.example.com/library/golang:1.21", -1},
+		{"build", 0},
+		{"mirror.example.com/library/alpine:3.19", -1},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("bases mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := map[string]string{
+		"instruction before FROM": "RUN true\nFROM alpine\n",
+		"invalid FROM":            "FROM alpine AS\n",
+		"invalid escape":          "# escape=x\nFROM alpine\n",
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := dockerfile.Parse([]byte(content)); err == nil {
+				t.Fatal("want error, got none")
+			}
+		})
+	}
+}
+
+func TestWithBases(t *testing.T) {
+	df, err := dockerfile.Parse([]byte(multiStage))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(df.WithBases(map[int]string{
+		0: "docker.io/library/golang@sha256:aaa",
+		2: "docker.io/library/alpine@sha256:bbb",
+	}))
+	want := `# syntax=docker/dockerfile:1
+ARG REGISTRY=docker.io
+ARG GO_VERSION
+ARG BASE=${REGISTRY}/library/alpine
+
+FROM --platform=linux/amd64 docker.io/library/golang@sha256:aaa AS build
+RUN go build \
+    # build the server
+    -o /server .
+
+FROM build as test
+RUN go test ./...
+
+FROM docker.io/library/alpine@sha256:bbb
+COPY --from=build /server /server
+RUN <<EOF
+echo done
+EOF
+CMD ["/server"]
+`
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("rendered Dockerfile mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestExpand(t *testing.T) {
+	values := map[string]string{"A": "a", "EMPTY": ""}
+	tests := map[string]string{
+		"$A/${A}":              "a/a",
+		"${EMPTY:-default}":    "default",
+		"${UNSET:-$A}":         "a",
+		"${A:+set}${EMPTY:+x}": "set",
+		`\$A`:                  "$A",
+		"$":                    "$",
+		"${A":                  "${A",
+	}
+	for in, want := range tests {
+		if got := dockerfile.Expand(in, values); got != want {
+			t.Errorf("Expand(%q): want %q, got %q", in, want, got)
+		}
+	}
+}
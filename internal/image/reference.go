@@ -0,0 +1,104 @@
+package image
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultRegistry is the registry of image references without registry.
+const DefaultRegistry = "docker.io"
+
+// legacyDefaultRegistry is an alias of DefaultRegistry.
+const legacyDefaultRegistry = "index.docker.io"
+
+// officialRepositoryPrefix is the namespace of the official images of the
+// Docker Hub.
+const officialRepositoryPrefix = "library/"
+
+// Reference is a parsed image reference such as
+// registry.example.com/foo/bar:1.0@sha256:abc.
+type Reference struct {
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// ParseReference parses an image reference. References to the Docker Hub are
+// normalized like the distribution reference library does: references
+// without registry and with the index.docker.io registry are located in
+// docker.io, and official images in its library namespace (e.g. "ubuntu" and
+// "docker.io/ubuntu" to "docker.io/library/ubuntu").
+func ParseReference(s string) (Reference, error) {
+	if s == "" || strings.ContainsAny(s, " \t\n") {
+		return Reference{}, fmt.Errorf("invalid image reference %q", s)
+	}
+	r := Reference{}
+	rest := s
+	if before, digest, ok := strings.Cut(rest, "@"); ok {
+		rest, r.Digest = before, digest
+	}
+	// A colon after the last slash separates the tag.
+	if i := strings.LastIndex(rest, ":"); i > strings.LastIndex(rest, "/") {
+		rest, r.Tag = rest[:i], rest[i+1:]
+	}
+	first, remainder, hasSlash := strings.Cut(rest, "/")
+	if hasSlash && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		r.Registry, r.Repository = normalizeRegistry(first), remainder
+	} else {
+		r.Registry, r.Repository = DefaultRegistry, rest
+	}
+	if r.Registry == DefaultRegistry && r.Repository != "" && !strings.Contains(r.Repository, "/") {
+		r.Repository = officialRepositoryPrefix + r.Repository
+	}
+	if r.Repository == "" {
+		return Reference{}, fmt.Errorf("invalid image reference %q", s)
+	}
+	return r, nil
+}
+
+// Name renders Registry/Repository.
+func (r Reference) Name() string {
+	return fmt.Sprintf("%s/%s", r.Registry, r.Repository)
+}
+
+// String renders the full reference, Registry/Repository[:Tag][@Digest].
+func (r Reference) String() string {
+	s := r.Name()
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		s += "@" + r.Digest
+	}
+	return s
+}
+
+// MatchesPrefix returns whether the reference is located within the given
+// registry or registry/repository prefix (e.g. "registry.example.com" or
+// "registry.example.com/foo"). The prefix is normalized with NormalizePrefix.
+func (r Reference) MatchesPrefix(prefix string) bool {
+	prefix = NormalizePrefix(prefix)
+	name := r.Name()
+	return name == prefix || strings.HasPrefix(name, prefix+"/")
+}
+
+// NormalizePrefix normalizes a registry or registry/repository prefix so that
+// it can be compared with the names of parsed references: a trailing slash is
+// removed and the index.docker.io registry is replaced by docker.io.
+func NormalizePrefix(prefix string) string {
+	prefix = strings.TrimSuffix(prefix, "/")
+	registry, rest, hasSlash := strings.Cut(prefix, "/")
+	registry = normalizeRegistry(registry)
+	if hasSlash {
+		return registry + "/" + rest
+	}
+	return registry
+}
+
+func normalizeRegistry(registry string) string {
+	if registry == legacyDefaultRegistry {
+		return DefaultRegistry
+	}
+	return registry
+}
@@ -0,0 +1,91 @@
+package image
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseReference(t *testing.T) {
+	tests := map[string]Reference{
+		"ubuntu": {
+			Registry: "docker.io", Repository: "library/ubuntu",
+		},
+		"docker.io/ubuntu:22.04": {
+			Registry: "docker.io", Repository: "library/ubuntu", Tag: "22.04",
+		},
+		"index.docker.io/library/ubuntu": {
+			Registry: "docker.io", Repository: "library/ubuntu",
+		},
+		"index.docker.io/bitnami/nginx": {
+			Registry: "docker.io", Repository: "bitnami/nginx",
+		},
+		"bitnami/nginx:1.25": {
+			Registry: "docker.io", Repository: "bitnami/nginx", Tag: "1.25",
+		},
+		"registry.access.redhat.com/ubi8/ubi-minimal:8.9": {
+			Registry: "registry.access.redhat.com", Repository: "ubi8/ubi-minimal", Tag: "8.9",
+		},
+		"localhost:5000/foo/bar@sha256:abc": {
+			Registry: "localhost:5000", Repository: "foo/bar", Digest: "sha256:abc",
+		},
+		"nexus.example.com:8443/dockerhub/golang:1.21@sha256:abc": {
+			Registry: "nexus.example.com:8443", Repository: "dockerhub/golang", Tag: "1.21", Digest: "sha256:abc",
+		},
+	}
+	for in, want := range tests {
+		t.Run(in, func(t *testing.T) {
+			got, err := ParseReference(in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Fatalf("reference mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+	if _, err := ParseReference("foo bar"); err == nil {
+		t.Fatal("want error for invalid reference, got none")
+	}
+}
+
+func TestReferenceMatchesPrefix(t *testing.T) {
+	r, err := ParseReference("registry.example.com/foo/bar:1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]bool{
+		"registry.example.com":          true,
+		"registry.example.com/":         true,
+		"registry.example.com/foo":      true,
+		"registry.example.com/foo/bar":  true,
+		"registry.example.com/fo":       false,
+		"registry.example":              false,
+		"other.example.com/foo":         false,
+		"registry.example.com/foo/bar2": false,
+	}
+	for prefix, want := range tests {
+		if got := r.MatchesPrefix(prefix); got != want {
+			t.Errorf("prefix %q: want %v, got %v", prefix, want, got)
+		}
+	}
+
+	hub := map[string]bool{
+		"docker.io":               true,
+		"index.docker.io":         true,
+		"docker.io/library":       true,
+		"index.docker.io/library": true,
+		"docker.io/bitnami":       false,
+	}
+	for _, ref := range []string{"ubuntu", "docker.io/ubuntu", "index.docker.io/library/ubuntu"} {
+		r, err := ParseReference(ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for prefix, want := range hub {
+			if got := r.MatchesPrefix(prefix); got != want {
+				t.Errorf("%s with prefix %q: want %v, got %v", ref, prefix, want, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package oci_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/opendevstack/ods-pipeline-image/internal/oci"
+	"github.com/opendevstack/ods-pipeline-image/internal/oci/ocitest"
+)
+
+func TestWriteArchive(t *testing.T) {
+	dir := t.TempDir()
+	l := ocitest.WriteImage(t, dir, "abc", oci.ContainerConfig{},
+		ocitest.Layer{Files: map[string]string{"app/server": "binary"}, CreatedBy: "COPY server /app/server"},
+	)
+	m, desc, err := l.Manifest("abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := oci.WriteArchive(dir, &buf); err != nil {
+		t.Fatal(err)
+	}
+	var again bytes.Buffer
+	if err := oci.WriteArchive(dir, &again); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), again.Bytes()) {
+		t.Fatal("want reproducible archive")
+	}
+
+	var got []string
+	tr := tar.NewReader(&buf)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, hdr.Name)
+	}
+	var blobs []string
+	for _, d := range []string{desc.Digest, m.Config.Digest, m.Layers[0].Digest} {
+		blobs = append(blobs, "blobs/sha256/"+strings.TrimPrefix(d, "sha256:"))
+	}
+	sort.Strings(blobs)
+	want := append([]string{"blobs/", "blobs/sha256/"}, blobs...)
+	want = append(want, "index.json", "oci-layout")
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("archive entries mismatch (-want +got):\n%s", diff)
+	}
+}
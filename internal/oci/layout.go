@@ -0,0 +1,361 @@
+// Package oci reads images from OCI image layout directories as written by
+// "buildah push <image> oci:<dir>:<ref>".
+package oci
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// RefNameAnnotation is the annotation of index.json entries holding the
+	// reference (tag) of the image.
+	RefNameAnnotation = "org.opencontainers.image.ref.name"
+	// BaseNameAnnotation is the manifest annotation holding the reference of
+	// the base image, as set by buildah.
+	BaseNameAnnotation = "org.opencontainers.image.base.name"
+	// BaseDigestAnnotation is the manifest annotation holding the digest of
+	// the base image, as set by buildah.
+	BaseDigestAnnotation = "org.opencontainers.image.base.digest"
+	// TitleAnnotation is the descriptor annotation holding the file name of
+	// a blob.
+	TitleAnnotation = "org.opencontainers.image.title"
+	// CreatedAnnotation is the manifest annotation holding the creation time.
+	CreatedAnnotation = "org.opencontainers.image.created"
+
+	MediaTypeImageIndex    = "application/vnd.oci.image.index.v1+json"
+	MediaTypeImageManifest = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeImageConfig   = "application/vnd.oci.image.config.v1+json"
+)
+
+// Descriptor references content in the layout.
+type Descriptor struct {
+	MediaType    string            `json:"mediaType"`
+	ArtifactType string            `json:"artifactType,omitempty"`
+	Digest       string            `json:"digest"`
+	Size         int64             `json:"size"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+}
+
+// Index is the content of index.json.
+type Index struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType,omitempty"`
+	Manifests     []Descriptor      `json:"manifests"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// Manifest is an OCI image manifest.
+type Manifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType,omitempty"`
+	ArtifactType  string            `json:"artifactType,omitempty"`
+	Config        Descriptor        `json:"config"`
+	Layers        []Descriptor      `json:"layers"`
+	Subject       *Descriptor       `json:"subject,omitempty"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// ImageConfig is the OCI image configuration.
+type ImageConfig struct {
+	Created      *time.Time      `json:"created,omitempty"`
+	Author       string          `json:"author,omitempty"`
+	Architecture string          `json:"architecture"`
+	OS           string          `json:"os"`
+	Config       ContainerConfig `json:"config"`
+	RootFS       RootFS          `json:"rootfs"`
+	History      []History       `json:"history,omitempty"`
+}
+
+// ContainerConfig holds the execution parameters of the image.
+type ContainerConfig struct {
+	User         string              `json:"User,omitempty"`
+	ExposedPorts map[string]struct{} `json:"ExposedPorts,omitempty"`
+	Env          []string            `json:"Env,omitempty"`
+	Entrypoint   []string            `json:"Entrypoint,omitempty"`
+	Cmd          []string            `json:"Cmd,omitempty"`
+	Volumes      map[string]struct{} `json:"Volumes,omitempty"`
+	WorkingDir   string              `json:"WorkingDir,omitempty"`
+	Labels       map[string]string   `json:"Labels,omitempty"`
+	StopSignal   string              `json:"StopSignal,omitempty"`
+}
+
+// RootFS references the layer content addresses used by the image.
+type RootFS struct {
+	Type    string   `json:"type"`
+	DiffIDs []string `json:"diff_ids"`
+}
+
+// History describes the history of a layer.
+type History struct {
+	Created    *time.Time `json:"created,omitempty"`
+	CreatedBy  string     `json:"created_by,omitempty"`
+	Author     string     `json:"author,omitempty"`
+	Comment    string     `json:"comment,omitempty"`
+	EmptyLayer bool       `json:"empty_layer,omitempty"`
+}
+
+// Layout is an OCI image layout directory.
+type Layout struct {
+	Dir   string
+	Index Index
+}
+
+// Open reads the OCI image layout located at dir.
+func Open(dir string) (*Layout, error) {
+	l := &Layout{Dir: dir}
+	if err := readJSON(filepath.Join(dir, "index.json"), &l.Index); err != nil {
+		return nil, fmt.Errorf("read index of OCI layout %s: %w", dir, err)
+	}
+	return l, nil
+}
+
+// ManifestDescriptor returns the descriptor of the image manifest with the
+// given reference. If ref is empty, the layout must contain exactly one
+// manifest.
+func (l *Layout) ManifestDescriptor(ref string) (Descriptor, error) {
+	if ref == "" {
+		if len(l.Index.Manifests) != 1 {
+			return Descriptor{}, fmt.Errorf("expected one manifest in %s, found %d", l.Dir, len(l.Index.Manifests))
+		}
+		return l.Index.Manifests[0], nil
+	}
+	for _, m := range l.Index.Manifests {
+		if m.Annotations[RefNameAnnotation] == ref {
+			return m, nil
+		}
+	}
+	return Descriptor{}, fmt.Errorf("no manifest with reference %q found in %s", ref, l.Dir)
+}
+
+// Manifest reads the image manifest with given reference.
+func (l *Layout) Manifest(ref string) (*Manifest, Descriptor, error) {
+	desc, err := l.ManifestDescriptor(ref)
+	if err != nil {
+		return nil, Descriptor{}, err
+	}
+	var m Manifest
+	if err := l.readBlobJSON(desc.Digest, &m); err != nil {
+		return nil, Descriptor{}, fmt.Errorf("read manifest: %w", err)
+	}
+	return &m, desc, nil
+}
+
+// Config reads the image configuration referenced by m.
+func (l *Layout) Config(m *Manifest) (*ImageConfig, error) {
+	var c ImageConfig
+	if err := l.readBlobJSON(m.Config.Digest, &c); err != nil {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+	return &c, nil
+}
+
+// BlobPath returns the path of the blob with given digest.
+func (l *Layout) BlobPath(digest string) (string, error) {
+	algo, hex, ok := strings.Cut(digest, ":")
+	if !ok || algo == "" || hex == "" || strings.ContainsAny(digest, `/\`) {
+		return "", fmt.Errorf("invalid digest %q", digest)
+	}
+	return filepath.Join(l.Dir, "blobs", algo, hex), nil
+}
+
+// OpenBlob opens the blob with given digest.
+func (l *Layout) OpenBlob(digest string) (*os.File, error) {
+	p, err := l.BlobPath(digest)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(p)
+}
+
+// ReadBlob reads the blob with given digest.
+func (l *Layout) ReadBlob(digest string) ([]byte, error) {
+	p, err := l.BlobPath(digest)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(p)
+}
+
+// WalkLayer calls fn for each entry of the layer described by desc.
+// r reads the content of the entry. Gzip compressed and uncompressed layers
+// are supported.
+func (l *Layout) WalkLayer(desc Descriptor, fn func(hdr *tar.Header, r io.Reader) error) error {
+	f, err := l.OpenBlob(desc.Digest)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	br := bufio.NewReader(f)
+	var r io.Reader = br
+	magic, err := br.Peek(2)
+	if err == nil && bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return fmt.Errorf("decompress layer %s: %w", desc.Digest, err)
+		}
+		defer gz.Close()
+		r = gz
+	} else if strings.Contains(desc.MediaType, "zstd") {
+		return fmt.Errorf("layer %s: zstd compression is not supported", desc.Digest)
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read layer %s: %w", desc.Digest, err)
+		}
+		if err := fn(hdr, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// LayerHistory returns the history entry which created each layer of the
+// image, in layer order. Entries are empty if the history is incomplete.
+func LayerHistory(c *ImageConfig, layerCount int) []History {
+	hs := make([]History, layerCount)
+	i := 0
+	for _, h := range c.History {
+		if h.EmptyLayer {
+			continue
+		}
+		if i >= layerCount {
+			break
+		}
+		hs[i] = h
+		i++
+	}
+	return hs
+}
+
+func (l *Layout) readBlobJSON(digest string, v interface{}) error {
+	p, err := l.BlobPath(digest)
+	if err != nil {
+		return err
+	}
+	return readJSON(p, v)
+}
+
+func readJSON(filename string, v interface{}) error {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// File is a file in the filesystem of an image.
+type File struct {
+	// Layer is the index of the layer which contains the file.
+	Layer  int
+	Header *tar.Header
+}
+
+// Files returns the files of the filesystem of the image described by m,
+// keyed by absolute path. Whiteouts of upper layers are applied.
+func (l *Layout) Files(m *Manifest) (map[string]File, error) {
+	files := map[string]File{}
+	for i, layer := range m.Layers {
+		err := l.WalkLayer(layer, func(hdr *tar.Header, r io.Reader) error {
+			p := cleanPath(hdr.Name)
+			dir, base := path.Split(p)
+			dir = path.Clean(dir)
+			switch {
+			case base == ".wh..wh..opq":
+				for f, info := range files {
+					if info.Layer < i && strings.HasPrefix(f, strings.TrimSuffix(dir, "/")+"/") {
+						delete(files, f)
+					}
+				}
+			case strings.HasPrefix(base, ".wh."):
+				removed := path.Join(dir, strings.TrimPrefix(base, ".wh."))
+				for f := range files {
+					if f == removed || strings.HasPrefix(f, removed+"/") {
+						delete(files, f)
+					}
+				}
+			default:
+				files[p] = File{Layer: i, Header: hdr}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// ReadFile reads the content of the file at path p in the filesystem of the
+// image described by m.
+func (l *Layout) ReadFile(m *Manifest, p string) ([]byte, error) {
+	files, err := l.Files(m)
+	if err != nil {
+		return nil, err
+	}
+	contents, err := l.ReadFiles(m, files, []string{p})
+	if err != nil {
+		return nil, err
+	}
+	return contents[cleanPath(p)], nil
+}
+
+// ReadFiles reads the content of the files at paths in the filesystem of
+// the image described by m, keyed by absolute path. files must have been
+// obtained from Files. Each layer is read at most once.
+func (l *Layout) ReadFiles(m *Manifest, files map[string]File, paths []string) (map[string][]byte, error) {
+	wanted := map[int]map[string]bool{}
+	for _, p := range paths {
+		cp := cleanPath(p)
+		f, ok := files[cp]
+		if !ok {
+			return nil, fmt.Errorf("file %s does not exist: %w", p, os.ErrNotExist)
+		}
+		if f.Header.Typeflag != tar.TypeReg {
+			return nil, fmt.Errorf("%s is not a regular file", p)
+		}
+		if wanted[f.Layer] == nil {
+			wanted[f.Layer] = map[string]bool{}
+		}
+		wanted[f.Layer][cp] = true
+	}
+	contents := map[string][]byte{}
+	for i, ps := range wanted {
+		err := l.WalkLayer(m.Layers[i], func(hdr *tar.Header, r io.Reader) error {
+			p := cleanPath(hdr.Name)
+			if !ps[p] {
+				return nil
+			}
+			b, err := io.ReadAll(r)
+			if err != nil {
+				return err
+			}
+			contents[p] = b
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return contents, nil
+}
+
+// cleanPath turns tar entry names into absolute paths.
+func cleanPath(name string) string {
+	return path.Clean("/" + strings.TrimPrefix(name, "./"))
+}
@@ -0,0 +1,103 @@
+package oci_test
+
+import (
+	"archive/tar"
+	"io"
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/opendevstack/ods-pipeline-image/internal/oci"
+	"github.com/opendevstack/ods-pipeline-image/internal/oci/ocitest"
+)
+
+func TestReadLayout(t *testing.T) {
+	dir := t.TempDir()
+	ocitest.WriteImage(t, dir, "abc", oci.ContainerConfig{User: "1001", Labels: map[string]string{"a": "b"}},
+		ocitest.Layer{Files: map[string]string{"etc/os-release": "ID=test"}, CreatedBy: "ADD rootfs"},
+		ocitest.Layer{Files: map[string]string{"app/bin/server": "binary", "app/README": "readme"}, CreatedBy: "COPY . /app"},
+	)
+
+	l, err := oci.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := l.Manifest("other"); err == nil {
+		t.Fatal("want error for unknown reference, got none")
+	}
+	m, _, err := l.Manifest("abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := l.Config(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Config.User != "1001" {
+		t.Fatalf("want user 1001, got %q", c.Config.User)
+	}
+	hs := oci.LayerHistory(c, len(m.Layers))
+	if hs[1].CreatedBy != "COPY . /app" {
+		t.Fatalf("want second layer created by COPY, got %q", hs[1].CreatedBy)
+	}
+
+	got := map[string]string{}
+	err = l.WalkLayer(m.Layers[1], func(hdr *tar.Header, r io.Reader) error {
+		b, err := io.ReadAll(r)
+		got[hdr.Name] = string(b)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"app/bin/server": "binary", "app/README": "readme"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("layer content mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestFiles(t *testing.T) {
+	dir := t.TempDir()
+	l := ocitest.WriteImage(t, dir, "abc", oci.ContainerConfig{},
+		ocitest.Layer{Files: map[string]string{
+			"etc/app.conf":     "v1",
+			"etc/removed.conf": "gone",
+			"opt/old/a":        "a",
+			"tmp/cache/x":      "x",
+		}},
+		ocitest.Layer{Files: map[string]string{
+			"etc/app.conf":           "v2",
+			"etc/.wh.removed.conf":   "",
+			"opt/.wh.old":            "",
+			"tmp/cache/.wh..wh..opq": "",
+			"tmp/cache/y":            "y",
+		}},
+	)
+	m, _, err := l.Manifest("abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := l.Files(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for f := range files {
+		got = append(got, f)
+	}
+	sort.Strings(got)
+	want := []string{"/etc/app.conf", "/tmp/cache/y"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("files mismatch (-want +got):\n%s", diff)
+	}
+	content, err := l.ReadFile(m, "/etc/app.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "v2" {
+		t.Fatalf("want content v2, got %q", content)
+	}
+	if _, err := l.ReadFile(m, "/etc/removed.conf"); err == nil {
+		t.Fatal("want error for removed file, got none")
+	}
+}
@@ -0,0 +1,89 @@
+// Package ocitest provides helpers to create OCI image layouts in tests.
+package ocitest
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"sort"
+	"testing"
+
+	"github.com/opendevstack/ods-pipeline-image/internal/oci"
+)
+
+// Layer describes the files of a layer (path to content) and the history
+// entry which created it.
+type Layer struct {
+	Files     map[string]string
+	CreatedBy string
+}
+
+// WriteImage writes an image with given config and layers into the OCI
+// layout at dir, referenced by ref. History entries are generated from
+// the layers. The layout is returned.
+func WriteImage(t *testing.T, dir, ref string, config oci.ContainerConfig, layers ...Layer) *oci.Layout {
+	t.Helper()
+	l, err := oci.Init(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := oci.ImageConfig{
+		Architecture: "amd64",
+		OS:           "linux",
+		Config:       config,
+		RootFS:       oci.RootFS{Type: "layers"},
+	}
+	m := oci.Manifest{SchemaVersion: 2, MediaType: oci.MediaTypeImageManifest}
+	for _, layer := range layers {
+		content := GzipTar(t, layer.Files)
+		d, err := l.WriteBlob("application/vnd.oci.image.layer.v1.tar+gzip", content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.Layers = append(m.Layers, d)
+		cfg.RootFS.DiffIDs = append(cfg.RootFS.DiffIDs, d.Digest)
+		cfg.History = append(cfg.History, oci.History{CreatedBy: layer.CreatedBy})
+	}
+	m.Config, err = l.WriteJSONBlob(oci.MediaTypeImageConfig, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	md, err := l.WriteJSONBlob(oci.MediaTypeImageManifest, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.AddManifest(md, ref); err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+// GzipTar returns a gzip compressed tar archive containing files.
+func GzipTar(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		content := files[name]
+		hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
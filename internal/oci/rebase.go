@@ -0,0 +1,120 @@
+package oci
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Rebase writes a copy of the image referenced by imageRef, in which the
+// layers of the base image oldBaseRef are replaced by the layers of the base
+// image newBaseRef, into the layout under ref. All three images must be
+// present in the layout. The layers on top of the base and the image
+// configuration are retained, except for the layer diff IDs and the history
+// of the base. annotations are added to the manifest. The descriptor of the
+// written manifest is returned.
+func (l *Layout) Rebase(imageRef, oldBaseRef, newBaseRef, ref string, annotations map[string]string) (Descriptor, error) {
+	img, _, err := l.Manifest(imageRef)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	oldBase, _, err := l.Manifest(oldBaseRef)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	newBase, _, err := l.Manifest(newBaseRef)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	imgConfig, err := l.Config(img)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	oldConfig, err := l.Config(oldBase)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	newConfig, err := l.Config(newBase)
+	if err != nil {
+		return Descriptor{}, err
+	}
+
+	n := len(oldBase.Layers)
+	if len(img.Layers) < n || len(imgConfig.RootFS.DiffIDs) < n || len(oldConfig.RootFS.DiffIDs) != n {
+		return Descriptor{}, fmt.Errorf("image has fewer layers than old base image")
+	}
+	// Layers are compared by diff ID, which identifies the uncompressed
+	// content, as base layers may have been recompressed when the image was
+	// pushed.
+	for i, diffID := range oldConfig.RootFS.DiffIDs {
+		if imgConfig.RootFS.DiffIDs[i] != diffID {
+			return Descriptor{}, fmt.Errorf("image is not based on old base image, layer %d differs (diff ID %s, base has %s)", i, imgConfig.RootFS.DiffIDs[i], diffID)
+		}
+	}
+	if imgConfig.OS != newConfig.OS || imgConfig.Architecture != newConfig.Architecture {
+		return Descriptor{}, fmt.Errorf("platform of new base image (%s/%s) differs from platform of image (%s/%s)", newConfig.OS, newConfig.Architecture, imgConfig.OS, imgConfig.Architecture)
+	}
+	history := newConfig.History
+	if len(imgConfig.History) > 0 {
+		h := len(oldConfig.History)
+		if len(imgConfig.History) < h {
+			return Descriptor{}, fmt.Errorf("image has a shorter history than old base image")
+		}
+		for i, entry := range oldConfig.History {
+			if imgConfig.History[i].CreatedBy != entry.CreatedBy {
+				return Descriptor{}, fmt.Errorf("history of image differs from history of old base image at entry %d", i)
+			}
+		}
+		history = append(append([]History{}, newConfig.History...), imgConfig.History[h:]...)
+	}
+
+	// The config is modified as raw JSON to retain fields not covered by
+	// ImageConfig.
+	raw, err := l.ReadBlob(img.Config.Digest)
+	if err != nil {
+		return Descriptor{}, fmt.Errorf("read config: %w", err)
+	}
+	var config map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &config); err != nil {
+		return Descriptor{}, fmt.Errorf("read config: %w", err)
+	}
+	rootFS := imgConfig.RootFS
+	rootFS.DiffIDs = append(append([]string{}, newConfig.RootFS.DiffIDs...), imgConfig.RootFS.DiffIDs[n:]...)
+	if config["rootfs"], err = json.Marshal(rootFS); err != nil {
+		return Descriptor{}, err
+	}
+	if len(history) > 0 {
+		if config["history"], err = json.Marshal(history); err != nil {
+			return Descriptor{}, err
+		}
+	}
+	b, err := json.Marshal(config)
+	if err != nil {
+		return Descriptor{}, fmt.Errorf("marshal config: %w", err)
+	}
+	configDesc, err := l.WriteBlob(img.Config.MediaType, b)
+	if err != nil {
+		return Descriptor{}, err
+	}
+
+	m := *img
+	m.Config = configDesc
+	m.Layers = append(append([]Descriptor{}, newBase.Layers...), img.Layers[n:]...)
+	if len(annotations) > 0 {
+		m.Annotations = map[string]string{}
+		for k, v := range img.Annotations {
+			m.Annotations[k] = v
+		}
+		for k, v := range annotations {
+			m.Annotations[k] = v
+		}
+	}
+	mediaType := m.MediaType
+	if mediaType == "" {
+		mediaType = MediaTypeImageManifest
+	}
+	desc, err := l.WriteJSONBlob(mediaType, m)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	return desc, l.AddManifest(desc, ref)
+}
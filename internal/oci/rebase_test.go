@@ -0,0 +1,129 @@
+package oci_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/opendevstack/ods-pipeline-image/internal/oci"
+	"github.com/opendevstack/ods-pipeline-image/internal/oci/ocitest"
+)
+
+func TestRebase(t *testing.T) {
+	dir := t.TempDir()
+	oldBaseLayer := ocitest.Layer{Files: map[string]string{"etc/os-release": "VERSION=1"}, CreatedBy: "ADD rootfs-1"}
+	newBaseLayers := []ocitest.Layer{
+		{Files: map[string]string{"etc/os-release": "VERSION=2"}, CreatedBy: "ADD rootfs-2"},
+		{Files: map[string]string{"etc/fix": "fixed"}, CreatedBy: "RUN fix"},
+	}
+	appLayer := ocitest.Layer{Files: map[string]string{"app/server": "binary"}, CreatedBy: "COPY server /app/server"}
+	ocitest.WriteImage(t, dir, "old-base", oci.ContainerConfig{}, oldBaseLayer)
+	ocitest.WriteImage(t, dir, "new-base", oci.ContainerConfig{}, newBaseLayers...)
+	ocitest.WriteImage(t, dir, "other-base", oci.ContainerConfig{}, newBaseLayers[1])
+	ocitest.WriteImage(t, dir, "image", oci.ContainerConfig{User: "1001", Entrypoint: []string{"/app/server"}}, oldBaseLayer, appLayer)
+
+	l, err := oci.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Rebase("image", "other-base", "new-base", "rebased", nil); err == nil {
+		t.Fatal("want error for image not based on old base, got none")
+	}
+	desc, err := l.Rebase("image", "old-base", "new-base", "rebased", map[string]string{oci.BaseDigestAnnotation: "sha256:abc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, got, err := l.Manifest("rebased")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Digest != desc.Digest {
+		t.Fatalf("want manifest %s, got %s", desc.Digest, got.Digest)
+	}
+	if m.Annotations[oci.BaseDigestAnnotation] != "sha256:abc" {
+		t.Fatalf("want base digest annotation, got %v", m.Annotations)
+	}
+	newBase, _, err := l.Manifest("new-base")
+	if err != nil {
+		t.Fatal(err)
+	}
+	image, _, err := l.Manifest("image")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantLayers := []string{newBase.Layers[0].Digest, newBase.Layers[1].Digest, image.Layers[1].Digest}
+	var gotLayers []string
+	for _, layer := range m.Layers {
+		gotLayers = append(gotLayers, layer.Digest)
+	}
+	if diff := cmp.Diff(wantLayers, gotLayers); diff != "" {
+		t.Fatalf("layers mismatch (-want +got):\n%s", diff)
+	}
+
+	c, err := l.Config(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(wantLayers, c.RootFS.DiffIDs); diff != "" {
+		t.Fatalf("diff IDs mismatch (-want +got):\n%s", diff)
+	}
+	var gotHistory []string
+	for _, h := range c.History {
+		gotHistory = append(gotHistory, h.CreatedBy)
+	}
+	wantHistory := []string{"ADD rootfs-2", "RUN fix", "COPY server /app/server"}
+	if diff := cmp.Diff(wantHistory, gotHistory); diff != "" {
+		t.Fatalf("history mismatch (-want +got):\n%s", diff)
+	}
+	if c.Config.User != "1001" || len(c.Config.Entrypoint) != 1 {
+		t.Fatalf("want config of image to be retained, got %+v", c.Config)
+	}
+
+	files, err := l.Files(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := l.ReadFile(m, "/etc/os-release")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "VERSION=2" {
+		t.Fatalf("want os-release of new base, got %q", content)
+	}
+	if _, ok := files["/app/server"]; !ok {
+		t.Fatal("want application layer to be retained")
+	}
+}
+
+func TestRebaseRecompressedBaseLayer(t *testing.T) {
+	dir := t.TempDir()
+	oldBaseLayer := ocitest.Layer{Files: map[string]string{"etc/os-release": "VERSION=1"}, CreatedBy: "ADD rootfs-1"}
+	appLayer := ocitest.Layer{Files: map[string]string{"app/server": "binary"}, CreatedBy: "COPY server /app/server"}
+	ocitest.WriteImage(t, dir, "old-base", oci.ContainerConfig{}, oldBaseLayer)
+	ocitest.WriteImage(t, dir, "new-base", oci.ContainerConfig{}, ocitest.Layer{Files: map[string]string{"etc/os-release": "VERSION=2"}})
+	l := ocitest.WriteImage(t, dir, "image", oci.ContainerConfig{}, oldBaseLayer, appLayer)
+
+	// Replace the compressed base layer of the image by a differently
+	// compressed blob, keeping its diff ID.
+	image, _, err := l.Manifest("image")
+	if err != nil {
+		t.Fatal(err)
+	}
+	recompressed, err := l.WriteBlob(image.Layers[0].MediaType, append(ocitest.GzipTar(t, oldBaseLayer.Files), 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := *image
+	m.Layers = append([]oci.Descriptor{recompressed}, image.Layers[1:]...)
+	md, err := l.WriteJSONBlob(oci.MediaTypeImageManifest, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.AddManifest(md, "recompressed"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := l.Rebase("recompressed", "old-base", "new-base", "rebased", nil); err != nil {
+		t.Fatalf("want image with recompressed base layer to be rebased, got %s", err)
+	}
+}
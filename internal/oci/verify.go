@@ -0,0 +1,60 @@
+package oci
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Verify checks that the content of each blob of the layout matches its
+// digest, and that the blobs of all image manifests referenced by the index
+// exist.
+func (l *Layout) Verify() error {
+	dir := filepath.Join(l.Dir, "blobs", "sha256")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("read blobs of %s: %w", l.Dir, err)
+	}
+	for _, e := range entries {
+		if err := verifyBlob(filepath.Join(dir, e.Name()), e.Name()); err != nil {
+			return err
+		}
+	}
+	for _, m := range l.Index.Manifests {
+		var manifest Manifest
+		if err := l.readBlobJSON(m.Digest, &manifest); err != nil {
+			return fmt.Errorf("read manifest %s: %w", m.Digest, err)
+		}
+		if m.MediaType == MediaTypeImageIndex {
+			continue
+		}
+		for _, d := range append([]Descriptor{manifest.Config}, manifest.Layers...) {
+			p, err := l.BlobPath(d.Digest)
+			if err != nil {
+				return err
+			}
+			if _, err := os.Stat(p); err != nil {
+				return fmt.Errorf("blob %s of manifest %s is missing", d.Digest, m.Digest)
+			}
+		}
+	}
+	return nil
+}
+
+func verifyBlob(filename, hex string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return fmt.Errorf("read blob sha256:%s: %w", hex, err)
+	}
+	if got := fmt.Sprintf("%x", h.Sum(nil)); got != hex {
+		return fmt.Errorf("blob sha256:%s is corrupt, its content has digest sha256:%s", hex, got)
+	}
+	return nil
+}
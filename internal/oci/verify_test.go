@@ -0,0 +1,39 @@
+package oci_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/opendevstack/ods-pipeline-image/internal/oci"
+	"github.com/opendevstack/ods-pipeline-image/internal/oci/ocitest"
+)
+
+func TestVerify(t *testing.T) {
+	dir := t.TempDir()
+	l := ocitest.WriteImage(t, dir, "abc", oci.ContainerConfig{},
+		ocitest.Layer{Files: map[string]string{"app/server": "binary"}},
+	)
+	if err := l.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	m, _, err := l.Manifest("abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := l.BlobPath(m.Layers[0].Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, []byte("tampered"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Verify(); err == nil {
+		t.Fatal("want error for tampered blob, got none")
+	}
+	if err := os.Remove(p); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Verify(); err == nil {
+		t.Fatal("want error for missing blob, got none")
+	}
+}
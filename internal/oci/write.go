@@ -0,0 +1,82 @@
+package oci
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const layoutFileContent = `{"imageLayoutVersion":"1.0.0"}`
+
+// Init creates an empty OCI image layout at dir. If dir contains a layout
+// already, it is opened instead.
+func Init(dir string) (*Layout, error) {
+	if _, err := os.Stat(filepath.Join(dir, "index.json")); err == nil {
+		return Open(dir)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "blobs", "sha256"), 0755); err != nil {
+		return nil, fmt.Errorf("create OCI layout %s: %w", dir, err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "oci-layout"), []byte(layoutFileContent), 0644); err != nil {
+		return nil, fmt.Errorf("create OCI layout %s: %w", dir, err)
+	}
+	l := &Layout{Dir: dir, Index: Index{SchemaVersion: 2, MediaType: MediaTypeImageIndex}}
+	return l, l.WriteIndex()
+}
+
+// WriteBlob stores content as blob and returns its descriptor.
+func (l *Layout) WriteBlob(mediaType string, content []byte) (Descriptor, error) {
+	d := Descriptor{
+		MediaType: mediaType,
+		Digest:    fmt.Sprintf("sha256:%x", sha256.Sum256(content)),
+		Size:      int64(len(content)),
+	}
+	p, err := l.BlobPath(d.Digest)
+	if err != nil {
+		return d, err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return d, err
+	}
+	return d, os.WriteFile(p, content, 0644)
+}
+
+// WriteJSONBlob marshals v and stores it as blob.
+func (l *Layout) WriteJSONBlob(mediaType string, v interface{}) (Descriptor, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return Descriptor{}, fmt.Errorf("marshal %s: %w", mediaType, err)
+	}
+	return l.WriteBlob(mediaType, b)
+}
+
+// AddManifest adds desc to the index, replacing an existing entry with the
+// same reference (if ref is non-empty), and writes the index.
+func (l *Layout) AddManifest(desc Descriptor, ref string) error {
+	if ref != "" {
+		if desc.Annotations == nil {
+			desc.Annotations = map[string]string{}
+		}
+		desc.Annotations[RefNameAnnotation] = ref
+		ms := l.Index.Manifests[:0]
+		for _, m := range l.Index.Manifests {
+			if m.Annotations[RefNameAnnotation] != ref {
+				ms = append(ms, m)
+			}
+		}
+		l.Index.Manifests = ms
+	}
+	l.Index.Manifests = append(l.Index.Manifests, desc)
+	return l.WriteIndex()
+}
+
+// WriteIndex writes index.json.
+func (l *Layout) WriteIndex() error {
+	b, err := json.Marshal(l.Index)
+	if err != nil {
+		return fmt.Errorf("marshal index: %w", err)
+	}
+	return os.WriteFile(filepath.Join(l.Dir, "index.json"), b, 0644)
+}
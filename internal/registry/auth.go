@@ -0,0 +1,71 @@
+package registry
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// authFile is the content of a containers auth.json or Docker config.json.
+type authFile struct {
+	Auths map[string]struct {
+		Auth string `json:"auth"`
+	} `json:"auths"`
+}
+
+// authFiles returns the files credentials are looked up in, in the order of
+// precedence used by skopeo and buildah.
+func authFiles() []string {
+	var files []string
+	if f := os.Getenv("REGISTRY_AUTH_FILE"); f != "" {
+		files = append(files, f)
+	}
+	if d := os.Getenv("XDG_RUNTIME_DIR"); d != "" {
+		files = append(files, filepath.Join(d, "containers", "auth.json"))
+	}
+	if d := os.Getenv("DOCKER_CONFIG"); d != "" {
+		files = append(files, filepath.Join(d, "config.json"))
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		files = append(files, filepath.Join(home, ".docker", "config.json"))
+	}
+	return files
+}
+
+// lookupCredentials returns the username and password for host from the
+// first of files with an entry for host. Entries may be keyed by host or by
+// URL.
+func lookupCredentials(host string, files []string) (string, string, error) {
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", "", err
+		}
+		var af authFile
+		if err := json.Unmarshal(b, &af); err != nil {
+			return "", "", fmt.Errorf("parse %s: %w", f, err)
+		}
+		for key, entry := range af.Auths {
+			k := strings.TrimPrefix(strings.TrimPrefix(key, "https://"), "http://")
+			k, _, _ = strings.Cut(k, "/")
+			if k != host || entry.Auth == "" {
+				continue
+			}
+			decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+			if err != nil {
+				return "", "", fmt.Errorf("decode credentials for %s in %s: %w", host, f, err)
+			}
+			username, password, _ := strings.Cut(string(decoded), ":")
+			return username, password, nil
+		}
+	}
+	return "", "", nil
+}
@@ -0,0 +1,41 @@
+package registry
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLookupCredentials(t *testing.T) {
+	dir := t.TempDir()
+	containersAuth := filepath.Join(dir, "auth.json")
+	dockerConfig := filepath.Join(dir, "config.json")
+	// "dXNlcjpwYXNz" is "user:pass", "ZG9ja2VyOnNlY3JldA==" is "docker:secret".
+	if err := os.WriteFile(containersAuth, []byte(`{"auths":{"registry.example.com":{"auth":"dXNlcjpwYXNz"}}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dockerConfig, []byte(`{"auths":{"https://registry.example.com/v1/":{"auth":"ZG9ja2VyOnNlY3JldA=="},"other.example.com":{"auth":"ZG9ja2VyOnNlY3JldA=="}}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	files := []string{filepath.Join(dir, "missing.json"), containersAuth, dockerConfig}
+	tests := map[string]struct {
+		host         string
+		wantUsername string
+		wantPassword string
+	}{
+		"first file wins": {host: "registry.example.com", wantUsername: "user", wantPassword: "pass"},
+		"later file":      {host: "other.example.com", wantUsername: "docker", wantPassword: "secret"},
+		"no credentials":  {host: "unknown.example.com"},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			username, password, err := lookupCredentials(tc.host, files)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if username != tc.wantUsername || password != tc.wantPassword {
+				t.Fatalf("want %s:%s, got %s:%s", tc.wantUsername, tc.wantPassword, username, password)
+			}
+		})
+	}
+}
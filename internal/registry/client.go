@@ -0,0 +1,290 @@
+// Package registry implements the parts of the OCI distribution API which
+// are not covered by skopeo, such as pushing artifacts referring to an image
+// and listing the referrers of an image.
+package registry
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/opendevstack/ods-pipeline-image/internal/oci"
+)
+
+// ErrNotFound is returned if a manifest or blob does not exist.
+var ErrNotFound = errors.New("not found")
+
+// Client accesses the repositories of a registry.
+type Client struct {
+	host      string
+	scheme    string
+	tlsVerify bool
+	http      *http.Client
+	username  string
+	password  string
+	// basicAuth is set once the registry asked for basic authentication.
+	basicAuth bool
+	// tokens are bearer tokens by scope.
+	tokens map[string]string
+}
+
+// NewClient creates a client for the registry at host. If tlsVerify is
+// true, the certificates in certDir (*.crt files) are trusted in addition to
+// the system certificates. Otherwise certificates are not verified, and like
+// skopeo, the client falls back to plain HTTP if the registry does not serve
+// HTTPS. Credentials are read from the auth files used by skopeo and buildah.
+func NewClient(host string, tlsVerify bool, certDir string) (*Client, error) {
+	username, password, err := lookupCredentials(host, authFiles())
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{host: host, scheme: "https", tlsVerify: tlsVerify, username: username, password: password, tokens: map[string]string{}}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if tlsVerify {
+		pool, err := certPool(certDir)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	} else {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	c.http = &http.Client{Transport: transport, Timeout: 5 * time.Minute}
+	return c, nil
+}
+
+// certPool returns the system certificates together with the certificates
+// in dir.
+func certPool(dir string) (*x509.CertPool, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if dir == "" {
+		return pool, nil
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.crt"))
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		pool.AppendCertsFromPEM(b)
+	}
+	return pool, nil
+}
+
+// Manifest returns the content and descriptor of the manifest of repository
+// referenced by ref (a tag or digest). The digest is taken from the
+// Docker-Content-Digest header, as the registry may have reformatted the
+// content, and computed from the content only if the header is missing.
+func (c *Client) Manifest(repository, ref string) ([]byte, oci.Descriptor, error) {
+	header := http.Header{"Accept": {
+		oci.MediaTypeImageManifest,
+		oci.MediaTypeImageIndex,
+		"application/vnd.docker.distribution.manifest.v2+json",
+		"application/vnd.docker.distribution.manifest.list.v2+json",
+	}}
+	resp, body, err := c.do(http.MethodGet, repository, "/manifests/"+ref, header, nil)
+	if err != nil {
+		return nil, oci.Descriptor{}, err
+	}
+	desc := oci.Descriptor{
+		MediaType: resp.Header.Get("Content-Type"),
+		Digest:    resp.Header.Get("Docker-Content-Digest"),
+		Size:      int64(len(body)),
+	}
+	if desc.Digest == "" {
+		desc.Digest = digestOf(body)
+	}
+	return body, desc, nil
+}
+
+// Blob returns the content of the blob with given digest.
+func (c *Client) Blob(repository, digest string) ([]byte, error) {
+	_, body, err := c.do(http.MethodGet, repository, "/blobs/"+digest, nil, nil)
+	return body, err
+}
+
+// PushBlob uploads content unless a blob with the same digest exists already.
+func (c *Client) PushBlob(repository string, desc oci.Descriptor, content []byte) error {
+	_, _, err := c.do(http.MethodHead, repository, "/blobs/"+desc.Digest, nil, nil)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	resp, _, err := c.do(http.MethodPost, repository, "/blobs/uploads/", nil, nil)
+	if err != nil {
+		return fmt.Errorf("start upload of %s: %w", desc.Digest, err)
+	}
+	location, err := resp.Location()
+	if err != nil {
+		return fmt.Errorf("start upload of %s: %w", desc.Digest, err)
+	}
+	q := location.Query()
+	q.Set("digest", desc.Digest)
+	location.RawQuery = q.Encode()
+	header := http.Header{"Content-Type": {"application/octet-stream"}}
+	if _, _, err := c.doURL(http.MethodPut, location, repository, header, content); err != nil {
+		return fmt.Errorf("upload %s: %w", desc.Digest, err)
+	}
+	return nil
+}
+
+// PushManifest uploads a manifest under ref (a tag or its digest). It
+// returns whether the registry processed the subject of the manifest, which
+// is the case if it supports the referrers API.
+func (c *Client) PushManifest(repository, ref, mediaType string, content []byte) (bool, error) {
+	header := http.Header{"Content-Type": {mediaType}}
+	resp, _, err := c.do(http.MethodPut, repository, "/manifests/"+ref, header, content)
+	if err != nil {
+		return false, fmt.Errorf("push manifest %s: %w", ref, err)
+	}
+	return resp.Header.Get("OCI-Subject") != "", nil
+}
+
+func (c *Client) do(method, repository, path string, header http.Header, body []byte) (*http.Response, []byte, error) {
+	u := &url.URL{Scheme: c.scheme, Host: c.host, Path: fmt.Sprintf("/v2/%s%s", repository, path)}
+	if i := strings.Index(path, "?"); i >= 0 {
+		u.Path = fmt.Sprintf("/v2/%s%s", repository, path[:i])
+		u.RawQuery = path[i+1:]
+	}
+	return c.doURL(method, u, repository, header, body)
+}
+
+// doURL sends a request, authenticating as requested by the registry. An
+// error is returned for unsuccessful responses, wrapping ErrNotFound for 404.
+func (c *Client) doURL(method string, u *url.URL, repository string, header http.Header, body []byte) (*http.Response, []byte, error) {
+	scope := fmt.Sprintf("repository:%s:pull,push", repository)
+	var resp *http.Response
+	var respBody []byte
+	for attempt := 0; attempt < 2; attempt++ {
+		req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+		if err != nil {
+			return nil, nil, err
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		if token := c.tokens[scope]; token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		} else if c.basicAuth {
+			req.SetBasicAuth(c.username, c.password)
+		}
+		resp, err = c.http.Do(req)
+		if err != nil && !c.tlsVerify && u.Scheme == "https" && strings.Contains(err.Error(), "server gave HTTP response to HTTPS client") {
+			c.scheme, u.Scheme = "http", "http"
+			attempt--
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		respBody, err = io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+		if resp.StatusCode != http.StatusUnauthorized || attempt > 0 {
+			break
+		}
+		if err := c.authenticate(resp.Header.Get("WWW-Authenticate"), scope); err != nil {
+			return nil, nil, err
+		}
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return resp, respBody, fmt.Errorf("%s %s: %w", method, u.Path, ErrNotFound)
+	case resp.StatusCode >= 300:
+		return resp, respBody, fmt.Errorf("%s %s: %s: %s", method, u.Path, resp.Status, strings.TrimSpace(string(respBody)))
+	}
+	return resp, respBody, nil
+}
+
+// authenticate handles a challenge of the registry. For bearer challenges, a
+// token for scope is requested with the credentials of the client. Basic
+// challenges are answered by sending the credentials with the next request.
+func (c *Client) authenticate(challenge, scope string) error {
+	scheme, params := parseChallenge(challenge)
+	switch scheme {
+	case "basic":
+		if c.username == "" {
+			return fmt.Errorf("registry %s requires credentials", c.host)
+		}
+		c.basicAuth = true
+		return nil
+	case "bearer":
+	default:
+		return fmt.Errorf("unsupported authentication challenge %q of registry %s", challenge, c.host)
+	}
+	u, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return fmt.Errorf("invalid realm in authentication challenge %q", challenge)
+	}
+	q := u.Query()
+	if params["service"] != "" {
+		q.Set("service", params["service"])
+	}
+	q.Set("scope", scope)
+	u.RawQuery = q.Encode()
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("request token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("request token: %s", resp.Status)
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return fmt.Errorf("decode token: %w", err)
+	}
+	c.tokens[scope] = token.Token
+	if c.tokens[scope] == "" {
+		c.tokens[scope] = token.AccessToken
+	}
+	return nil
+}
+
+// parseChallenge parses a WWW-Authenticate header into the lower-cased
+// scheme and its parameters.
+func parseChallenge(challenge string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(challenge), " ")
+	params := map[string]string{}
+	for rest != "" {
+		var key, value string
+		key, rest, _ = strings.Cut(strings.TrimLeft(rest, ", "), "=")
+		if strings.HasPrefix(rest, `"`) {
+			value, rest, _ = strings.Cut(rest[1:], `"`)
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		params[strings.ToLower(strings.TrimSpace(key))] = value
+	}
+	return strings.ToLower(scheme), params
+}
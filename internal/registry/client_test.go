@@ -0,0 +1,63 @@
+package registry_test
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/opendevstack/ods-pipeline-image/internal/oci"
+	"github.com/opendevstack/ods-pipeline-image/internal/registry"
+)
+
+func TestManifest(t *testing.T) {
+	body := []byte(`{"schemaVersion":2}`)
+	tests := map[string]struct {
+		digestHeader string
+		want         oci.Descriptor
+	}{
+		"digest from header": {
+			digestHeader: "sha256:abc",
+			want:         oci.Descriptor{MediaType: oci.MediaTypeImageManifest, Digest: "sha256:abc", Size: int64(len(body))},
+		},
+		"digest computed without header": {
+			want: oci.Descriptor{MediaType: oci.MediaTypeImageManifest, Digest: fmt.Sprintf("sha256:%x", sha256.Sum256(body)), Size: int64(len(body))},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("REGISTRY_AUTH_FILE", "")
+			t.Setenv("XDG_RUNTIME_DIR", "")
+			t.Setenv("DOCKER_CONFIG", t.TempDir())
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tc.digestHeader != "" {
+					w.Header().Set("Docker-Content-Digest", tc.digestHeader)
+				}
+				w.Header().Set("Content-Type", oci.MediaTypeImageManifest)
+				w.Write(body)
+			}))
+			defer srv.Close()
+			u, err := url.Parse(srv.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c, err := registry.NewClient(u.Host, false, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, got, err := c.Manifest("repo", "latest")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != string(body) {
+				t.Fatalf("unexpected manifest %q", b)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Fatalf("descriptor mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
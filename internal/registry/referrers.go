@@ -0,0 +1,283 @@
+package registry
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/opendevstack/ods-pipeline-image/internal/oci"
+)
+
+const (
+	// MediaTypeEmptyJSON is the media type of the empty config of artifacts.
+	MediaTypeEmptyJSON = "application/vnd.oci.empty.v1+json"
+
+	emptyJSON = "{}"
+)
+
+// FallbackTag returns the tag under which the index of the referrers of the
+// manifest with given digest is stored in registries without support for the
+// referrers API, as defined by the referrers tag schema.
+func FallbackTag(digest string) string {
+	return strings.Replace(digest, ":", "-", 1)
+}
+
+// Referrers returns the descriptors of the manifests referring to the
+// manifest with given digest, optionally filtered by artifactType. If the
+// registry does not support the referrers API, the index stored under the
+// fallback tag is read instead.
+func (c *Client) Referrers(repository, digest, artifactType string) ([]oci.Descriptor, error) {
+	path := "/referrers/" + digest
+	if artifactType != "" {
+		path += "?artifactType=" + url.QueryEscape(artifactType)
+	}
+	_, body, err := c.do(http.MethodGet, repository, path, nil, nil)
+	if errors.Is(err, ErrNotFound) {
+		body, _, err = c.Manifest(repository, FallbackTag(digest))
+		if errors.Is(err, ErrNotFound) {
+			return nil, nil
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("list referrers of %s: %w", digest, err)
+	}
+	var idx oci.Index
+	if err := json.Unmarshal(body, &idx); err != nil {
+		return nil, fmt.Errorf("parse referrers of %s: %w", digest, err)
+	}
+	return filterArtifactType(idx.Manifests, artifactType), nil
+}
+
+// filterArtifactType returns the descriptors with given artifact type, or
+// all of them if artifactType is empty. Registries may ignore the filter of
+// the referrers API, and the fallback index is not filtered at all.
+func filterArtifactType(descs []oci.Descriptor, artifactType string) []oci.Descriptor {
+	if artifactType == "" {
+		return descs
+	}
+	var filtered []oci.Descriptor
+	for _, d := range descs {
+		if d.ArtifactType == artifactType {
+			filtered = append(filtered, d)
+		}
+	}
+	return filtered
+}
+
+// Attach pushes content as single-layer artifact of given type referring to
+// subject, and returns the descriptor of the artifact manifest. The layer is
+// annotated with filename as title. If the
+// registry does not support the referrers API, the artifact is added to the
+// index stored under the fallback tag of the subject.
+func (c *Client) Attach(repository string, subject oci.Descriptor, artifactType, mediaType, filename string, content []byte, annotations map[string]string) (oci.Descriptor, error) {
+	config := oci.Descriptor{MediaType: MediaTypeEmptyJSON, Digest: digestOf([]byte(emptyJSON)), Size: int64(len(emptyJSON))}
+	if err := c.PushBlob(repository, config, []byte(emptyJSON)); err != nil {
+		return oci.Descriptor{}, err
+	}
+	layer := oci.Descriptor{
+		MediaType:   mediaType,
+		Digest:      digestOf(content),
+		Size:        int64(len(content)),
+		Annotations: map[string]string{oci.TitleAnnotation: filename},
+	}
+	if err := c.PushBlob(repository, layer, content); err != nil {
+		return oci.Descriptor{}, err
+	}
+	subject = oci.Descriptor{MediaType: subject.MediaType, Digest: subject.Digest, Size: subject.Size}
+	m := oci.Manifest{
+		SchemaVersion: 2,
+		MediaType:     oci.MediaTypeImageManifest,
+		ArtifactType:  artifactType,
+		Config:        config,
+		Layers:        []oci.Descriptor{layer},
+		Subject:       &subject,
+		Annotations:   annotations,
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return oci.Descriptor{}, err
+	}
+	desc := oci.Descriptor{
+		MediaType:    oci.MediaTypeImageManifest,
+		ArtifactType: artifactType,
+		Digest:       digestOf(b),
+		Size:         int64(len(b)),
+		Annotations:  annotations,
+	}
+	subjectProcessed, err := c.PushManifest(repository, desc.Digest, desc.MediaType, b)
+	if err != nil {
+		return oci.Descriptor{}, err
+	}
+	if subjectProcessed {
+		return desc, nil
+	}
+	return desc, c.addToFallbackIndex(repository, subject.Digest, desc)
+}
+
+// addToFallbackIndex adds desc to the referrers index stored under the
+// fallback tag of the manifest with digest subject.
+func (c *Client) addToFallbackIndex(repository, subject string, desc oci.Descriptor) error {
+	tag := FallbackTag(subject)
+	idx := oci.Index{SchemaVersion: 2, MediaType: oci.MediaTypeImageIndex}
+	b, _, err := c.Manifest(repository, tag)
+	switch {
+	case errors.Is(err, ErrNotFound):
+	case err != nil:
+		return err
+	default:
+		if err := json.Unmarshal(b, &idx); err != nil {
+			return fmt.Errorf("parse referrers index %s: %w", tag, err)
+		}
+	}
+	for _, d := range idx.Manifests {
+		if d.Digest == desc.Digest {
+			return nil
+		}
+	}
+	idx.Manifests = append(idx.Manifests, desc)
+	b, err = json.Marshal(idx)
+	if err != nil {
+		return err
+	}
+	_, err = c.PushManifest(repository, tag, oci.MediaTypeImageIndex, b)
+	return err
+}
+
+// CopyReferrers copies the artifacts referring to the manifest with given
+// digest from srcRepository of src to repository, retaining their digests.
+// The subject manifest must exist in repository already. If the registry
+// does not support the referrers API, the artifacts are added to the index
+// stored under the fallback tag of the subject. It returns the descriptors
+// of the copied artifacts.
+func (c *Client) CopyReferrers(src *Client, srcRepository, repository, digest string) ([]oci.Descriptor, error) {
+	descs, err := src.Referrers(srcRepository, digest, "")
+	if err != nil {
+		return nil, err
+	}
+	blob := func(d string) ([]byte, error) { return src.Blob(srcRepository, d) }
+	for _, desc := range descs {
+		b, got, err := src.Manifest(srcRepository, desc.Digest)
+		if err != nil {
+			return nil, fmt.Errorf("get referrer %s: %w", desc.Digest, err)
+		}
+		if got.MediaType != "" {
+			desc.MediaType = got.MediaType
+		}
+		if err := c.PushReferrer(repository, digest, desc, b, blob); err != nil {
+			return nil, err
+		}
+	}
+	return descs, nil
+}
+
+// PushReferrer pushes the artifact described by desc with given manifest to
+// repository, retaining its digest. blob returns the content of the config
+// and layers of the artifact. If the registry does not support the
+// referrers API, the artifact is added to the index stored under the
+// fallback tag of subject.
+func (c *Client) PushReferrer(repository, subject string, desc oci.Descriptor, manifest []byte, blob func(digest string) ([]byte, error)) error {
+	var m oci.Manifest
+	if err := json.Unmarshal(manifest, &m); err != nil {
+		return fmt.Errorf("parse referrer %s: %w", desc.Digest, err)
+	}
+	for _, d := range append([]oci.Descriptor{m.Config}, m.Layers...) {
+		content, err := blob(d.Digest)
+		if err != nil {
+			return fmt.Errorf("get blob %s of referrer %s: %w", d.Digest, desc.Digest, err)
+		}
+		if err := c.PushBlob(repository, d, content); err != nil {
+			return err
+		}
+	}
+	subjectProcessed, err := c.PushManifest(repository, desc.Digest, desc.MediaType, manifest)
+	if err != nil {
+		return err
+	}
+	if !subjectProcessed {
+		return c.addToFallbackIndex(repository, subject, desc)
+	}
+	return nil
+}
+
+// SaveReferrers writes the artifacts referring to the manifest with given
+// digest in repository into the OCI layout l, and adds them to its index.
+// It returns the descriptors of the saved artifacts.
+func (c *Client) SaveReferrers(repository, digest string, l *oci.Layout) ([]oci.Descriptor, error) {
+	descs, err := c.Referrers(repository, digest, "")
+	if err != nil {
+		return nil, err
+	}
+	for i, desc := range descs {
+		b, got, err := c.Manifest(repository, desc.Digest)
+		if err != nil {
+			return nil, fmt.Errorf("get referrer %s: %w", desc.Digest, err)
+		}
+		if d := digestOf(b); d != desc.Digest {
+			return nil, fmt.Errorf("referrer %s has digest %s", desc.Digest, d)
+		}
+		var m oci.Manifest
+		if err := json.Unmarshal(b, &m); err != nil {
+			return nil, fmt.Errorf("parse referrer %s: %w", desc.Digest, err)
+		}
+		for _, d := range append([]oci.Descriptor{m.Config}, m.Layers...) {
+			content, err := c.Blob(repository, d.Digest)
+			if err != nil {
+				return nil, fmt.Errorf("get blob %s of referrer %s: %w", d.Digest, desc.Digest, err)
+			}
+			if _, err := l.WriteBlob(d.MediaType, content); err != nil {
+				return nil, err
+			}
+		}
+		if got.MediaType != "" {
+			desc.MediaType = got.MediaType
+		}
+		if _, err := l.WriteBlob(desc.MediaType, b); err != nil {
+			return nil, err
+		}
+		if err := l.AddManifest(desc, ""); err != nil {
+			return nil, err
+		}
+		descs[i] = desc
+	}
+	return descs, nil
+}
+
+// LoadReferrers pushes the artifacts described by descs from the OCI layout
+// l to repository, with the manifest with given digest as subject.
+func (c *Client) LoadReferrers(l *oci.Layout, repository, digest string, descs []oci.Descriptor) error {
+	for _, desc := range descs {
+		b, err := l.ReadBlob(desc.Digest)
+		if err != nil {
+			return fmt.Errorf("read referrer %s: %w", desc.Digest, err)
+		}
+		if err := c.PushReferrer(repository, digest, desc, b, l.ReadBlob); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func digestOf(content []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(content))
+}
+
+// ArtifactContent returns the content of the first layer of the artifact
+// described by desc, e.g. a descriptor returned by Referrers.
+func (c *Client) ArtifactContent(repository string, desc oci.Descriptor) ([]byte, error) {
+	b, _, err := c.Manifest(repository, desc.Digest)
+	if err != nil {
+		return nil, err
+	}
+	var m oci.Manifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("parse manifest %s: %w", desc.Digest, err)
+	}
+	if len(m.Layers) == 0 {
+		return nil, fmt.Errorf("artifact %s has no layers", desc.Digest)
+	}
+	return c.Blob(repository, m.Layers[0].Digest)
+}
@@ -0,0 +1,341 @@
+package registry_test
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/opendevstack/ods-pipeline-image/internal/oci"
+	"github.com/opendevstack/ods-pipeline-image/internal/registry"
+)
+
+// fakeRegistry is a minimal in-memory registry of a single repository.
+type fakeRegistry struct {
+	mu        sync.Mutex
+	referrers bool
+	token     string
+	blobs     map[string][]byte
+	manifests map[string][]byte
+}
+
+func newFakeRegistry(referrers bool) *fakeRegistry {
+	return &fakeRegistry{referrers: referrers, blobs: map[string][]byte{}, manifests: map[string][]byte{}}
+}
+
+func (f *fakeRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.URL.Path == "/token" {
+		fmt.Fprintf(w, `{"token":"secret"}`)
+		return
+	}
+	if f.token != "" && r.Header.Get("Authorization") != "Bearer "+f.token {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="http://%s/token",service="fake"`, r.Host))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/v2/repo")
+	switch {
+	case path == "/blobs/uploads/" && r.Method == http.MethodPost:
+		w.Header().Set("Location", "/v2/repo/blobs/uploads/1")
+		w.WriteHeader(http.StatusAccepted)
+	case path == "/blobs/uploads/1" && r.Method == http.MethodPut:
+		b, _ := io.ReadAll(r.Body)
+		f.blobs[r.URL.Query().Get("digest")] = b
+		w.WriteHeader(http.StatusCreated)
+	case strings.HasPrefix(path, "/blobs/"):
+		b, ok := f.blobs[strings.TrimPrefix(path, "/blobs/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(b)
+	case strings.HasPrefix(path, "/manifests/") && r.Method == http.MethodPut:
+		b, _ := io.ReadAll(r.Body)
+		ref := strings.TrimPrefix(path, "/manifests/")
+		f.manifests[ref] = b
+		f.manifests[fmt.Sprintf("sha256:%x", sha256.Sum256(b))] = b
+		var m oci.Manifest
+		if err := json.Unmarshal(b, &m); err == nil && m.Subject != nil && f.referrers {
+			w.Header().Set("OCI-Subject", m.Subject.Digest)
+		}
+		w.WriteHeader(http.StatusCreated)
+	case strings.HasPrefix(path, "/manifests/"):
+		b, ok := f.manifests[strings.TrimPrefix(path, "/manifests/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", oci.MediaTypeImageManifest)
+		w.Write(b)
+	case strings.HasPrefix(path, "/referrers/") && f.referrers:
+		subject := strings.TrimPrefix(path, "/referrers/")
+		idx := oci.Index{SchemaVersion: 2, MediaType: oci.MediaTypeImageIndex, Manifests: []oci.Descriptor{}}
+		for digest, b := range f.manifests {
+			var m oci.Manifest
+			if !strings.HasPrefix(digest, "sha256:") || json.Unmarshal(b, &m) != nil || m.Subject == nil || m.Subject.Digest != subject {
+				continue
+			}
+			idx.Manifests = append(idx.Manifests, oci.Descriptor{MediaType: m.MediaType, ArtifactType: m.ArtifactType, Digest: digest, Size: int64(len(b)), Annotations: m.Annotations})
+		}
+		json.NewEncoder(w).Encode(idx)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestAttach(t *testing.T) {
+	tests := map[string]struct {
+		referrers bool
+		token     string
+	}{
+		"referrers API":       {referrers: true},
+		"tag schema fallback": {referrers: false},
+		"bearer token":        {referrers: true, token: "secret"},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			fake := newFakeRegistry(tc.referrers)
+			fake.token = tc.token
+			srv := httptest.NewServer(fake)
+			defer srv.Close()
+			u, err := url.Parse(srv.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Setenv("REGISTRY_AUTH_FILE", "")
+			t.Setenv("XDG_RUNTIME_DIR", "")
+			t.Setenv("DOCKER_CONFIG", t.TempDir())
+			c, err := registry.NewClient(u.Host, false, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			image := []byte(`{"schemaVersion":2}`)
+			if _, err := c.PushManifest("repo", "latest", oci.MediaTypeImageManifest, image); err != nil {
+				t.Fatal(err)
+			}
+			subject := oci.Descriptor{MediaType: oci.MediaTypeImageManifest, Digest: fmt.Sprintf("sha256:%x", sha256.Sum256(image)), Size: int64(len(image))}
+
+			annotations := map[string]string{oci.CreatedAnnotation: "2024-01-01T00:00:00Z"}
+			sbom, err := c.Attach("repo", subject, "text/spdx", "text/spdx", "app.spdx", []byte("SPDXVersion: SPDX-2.3"), annotations)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Attaching the same artifact again must not duplicate it.
+			if _, err := c.Attach("repo", subject, "text/spdx", "text/spdx", "app.spdx", []byte("SPDXVersion: SPDX-2.3"), annotations); err != nil {
+				t.Fatal(err)
+			}
+			report, err := c.Attach("repo", subject, "application/json", "application/json", "report.json", []byte(`{}`), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, hasFallbackIndex := fake.manifests[registry.FallbackTag(subject.Digest)]
+			if hasFallbackIndex == tc.referrers {
+				t.Fatalf("want fallback index: %v, got %v", !tc.referrers, hasFallbackIndex)
+			}
+
+			got, err := c.Referrers("repo", subject.Digest, "text/spdx")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff([]oci.Descriptor{sbom}, got); diff != "" {
+				t.Fatalf("referrers mismatch (-want +got):\n%s", diff)
+			}
+			got, err = c.Referrers("repo", subject.Digest, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != 2 || (got[0].Digest != report.Digest && got[1].Digest != report.Digest) {
+				t.Fatalf("want SBOM and report as referrers, got %v", got)
+			}
+
+			b, _, err := c.Manifest("repo", sbom.Digest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var m oci.Manifest
+			if err := json.Unmarshal(b, &m); err != nil {
+				t.Fatal(err)
+			}
+			if m.Subject == nil || m.Subject.Digest != subject.Digest {
+				t.Fatalf("want subject %s, got %v", subject.Digest, m.Subject)
+			}
+			content, err := c.ArtifactContent("repo", sbom)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(content) != "SPDXVersion: SPDX-2.3" {
+				t.Fatalf("unexpected layer content %q", content)
+			}
+		})
+	}
+}
+
+func TestCopyReferrers(t *testing.T) {
+	tests := map[string]struct {
+		srcReferrers bool
+		dstReferrers bool
+	}{
+		"referrers API to tag schema fallback": {srcReferrers: true, dstReferrers: false},
+		"tag schema fallback to referrers API": {srcReferrers: false, dstReferrers: true},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("REGISTRY_AUTH_FILE", "")
+			t.Setenv("XDG_RUNTIME_DIR", "")
+			t.Setenv("DOCKER_CONFIG", t.TempDir())
+			clients := map[bool]*registry.Client{}
+			fakes := map[bool]*fakeRegistry{}
+			for _, isSrc := range []bool{true, false} {
+				referrers := tc.dstReferrers
+				if isSrc {
+					referrers = tc.srcReferrers
+				}
+				fakes[isSrc] = newFakeRegistry(referrers)
+				srv := httptest.NewServer(fakes[isSrc])
+				defer srv.Close()
+				u, err := url.Parse(srv.URL)
+				if err != nil {
+					t.Fatal(err)
+				}
+				c, err := registry.NewClient(u.Host, false, "")
+				if err != nil {
+					t.Fatal(err)
+				}
+				clients[isSrc] = c
+			}
+			src, dst := clients[true], clients[false]
+			image := []byte(`{"schemaVersion":2}`)
+			for _, c := range []*registry.Client{src, dst} {
+				if _, err := c.PushManifest("repo", "latest", oci.MediaTypeImageManifest, image); err != nil {
+					t.Fatal(err)
+				}
+			}
+			subject := oci.Descriptor{MediaType: oci.MediaTypeImageManifest, Digest: fmt.Sprintf("sha256:%x", sha256.Sum256(image)), Size: int64(len(image))}
+			sbom, err := src.Attach("repo", subject, "text/spdx", "text/spdx", "app.spdx", []byte("SPDXVersion: SPDX-2.3"), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			copied, err := dst.CopyReferrers(src, "repo", "repo", subject.Digest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(copied) != 1 || copied[0].Digest != sbom.Digest {
+				t.Fatalf("want SBOM copied, got %v", copied)
+			}
+			_, hasFallbackIndex := fakes[false].manifests[registry.FallbackTag(subject.Digest)]
+			if hasFallbackIndex == tc.dstReferrers {
+				t.Fatalf("want fallback index: %v, got %v", !tc.dstReferrers, hasFallbackIndex)
+			}
+			got, err := dst.Referrers("repo", subject.Digest, "text/spdx")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != 1 || got[0].Digest != sbom.Digest {
+				t.Fatalf("want SBOM as referrer, got %v", got)
+			}
+			content, err := dst.ArtifactContent("repo", got[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(content) != "SPDXVersion: SPDX-2.3" {
+				t.Fatalf("unexpected layer content %q", content)
+			}
+		})
+	}
+}
+
+func TestSaveAndLoadReferrers(t *testing.T) {
+	t.Setenv("REGISTRY_AUTH_FILE", "")
+	t.Setenv("XDG_RUNTIME_DIR", "")
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+	var clients []*registry.Client
+	for _, referrers := range []bool{true, false} {
+		srv := httptest.NewServer(newFakeRegistry(referrers))
+		defer srv.Close()
+		u, err := url.Parse(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := registry.NewClient(u.Host, false, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		clients = append(clients, c)
+	}
+	src, dst := clients[0], clients[1]
+	image := []byte(`{"schemaVersion":2}`)
+	for _, c := range clients {
+		if _, err := c.PushManifest("repo", "latest", oci.MediaTypeImageManifest, image); err != nil {
+			t.Fatal(err)
+		}
+	}
+	subject := oci.Descriptor{MediaType: oci.MediaTypeImageManifest, Digest: fmt.Sprintf("sha256:%x", sha256.Sum256(image)), Size: int64(len(image))}
+	sbom, err := src.Attach("repo", subject, "text/spdx", "text/spdx", "app.spdx", []byte("SPDXVersion: SPDX-2.3"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := oci.Init(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved, err := src.SaveReferrers("repo", subject.Digest, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved) != 1 || saved[0].Digest != sbom.Digest {
+		t.Fatalf("want SBOM saved, got %v", saved)
+	}
+	if err := l.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(saved, l.Index.Manifests); diff != "" {
+		t.Fatalf("index mismatch (-want +got):\n%s", diff)
+	}
+
+	if err := dst.LoadReferrers(l, "repo", subject.Digest, saved); err != nil {
+		t.Fatal(err)
+	}
+	got, err := dst.Referrers("repo", subject.Digest, "text/spdx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Digest != sbom.Digest {
+		t.Fatalf("want SBOM as referrer, got %v", got)
+	}
+	content, err := dst.ArtifactContent("repo", got[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "SPDXVersion: SPDX-2.3" {
+		t.Fatalf("unexpected layer content %q", content)
+	}
+}
+
+func TestReferrersNone(t *testing.T) {
+	srv := httptest.NewServer(newFakeRegistry(false))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+	c, err := registry.NewClient(u.Host, false, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := c.Referrers("repo", "sha256:abc", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Fatalf("want no referrers, got %v", got)
+	}
+}
@@ -0,0 +1,138 @@
+package spdx
+
+import (
+	"sort"
+	"strings"
+)
+
+// Diff holds the packages which differ between two SBOMs.
+type Diff struct {
+	Added   []PackageChange `json:"added"`
+	Removed []PackageChange `json:"removed"`
+	Changed []PackageChange `json:"changed"`
+}
+
+// PackageChange describes a package which was added, removed or changed.
+// Versions and licenses of packages present multiple times (e.g. libraries
+// bundled by several applications) are joined by ", ".
+type PackageChange struct {
+	Name       string `json:"name"`
+	Type       string `json:"type,omitempty"`
+	OldVersion string `json:"oldVersion,omitempty"`
+	NewVersion string `json:"newVersion,omitempty"`
+	OldLicense string `json:"oldLicense,omitempty"`
+	NewLicense string `json:"newLicense,omitempty"`
+}
+
+// Empty returns whether there are no differences.
+func (d Diff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// License returns the concluded license of the package, or the declared one
+// if no license was concluded.
+func (p Package) License() string {
+	if p.LicenseConcluded != "" && p.LicenseConcluded != NoAssertion {
+		return p.LicenseConcluded
+	}
+	if p.LicenseDeclared == NoAssertion {
+		return ""
+	}
+	return p.LicenseDeclared
+}
+
+// Type returns the type of the package URL of the package, e.g. "rpm" or
+// "maven", or an empty string if it has none.
+func (p Package) Type() string {
+	t, _, _ := strings.Cut(strings.TrimPrefix(p.PURL, "pkg:"), "/")
+	return t
+}
+
+// packageKey identifies a package independent of its version.
+type packageKey struct {
+	name string
+	typ  string
+}
+
+type packageVersions struct {
+	versions []string
+	licenses []string
+}
+
+// Compare returns the packages of newDoc which were added, removed or
+// changed in version or license compared to oldDoc. Packages are matched by
+// name and package URL type, the package describing the image itself is
+// ignored.
+func Compare(oldDoc, newDoc *Document) Diff {
+	oldPkgs := indexPackages(oldDoc)
+	newPkgs := indexPackages(newDoc)
+	var d Diff
+	for k, n := range newPkgs {
+		o, ok := oldPkgs[k]
+		switch {
+		case !ok:
+			d.Added = append(d.Added, PackageChange{Name: k.name, Type: k.typ, NewVersion: join(n.versions), NewLicense: join(n.licenses)})
+		case join(o.versions) != join(n.versions) || join(o.licenses) != join(n.licenses):
+			d.Changed = append(d.Changed, PackageChange{
+				Name: k.name, Type: k.typ,
+				OldVersion: join(o.versions), NewVersion: join(n.versions),
+				OldLicense: join(o.licenses), NewLicense: join(n.licenses),
+			})
+		}
+	}
+	for k, o := range oldPkgs {
+		if _, ok := newPkgs[k]; !ok {
+			d.Removed = append(d.Removed, PackageChange{Name: k.name, Type: k.typ, OldVersion: join(o.versions), OldLicense: join(o.licenses)})
+		}
+	}
+	for _, changes := range [][]PackageChange{d.Added, d.Removed, d.Changed} {
+		sort.Slice(changes, func(i, j int) bool {
+			if changes[i].Name != changes[j].Name {
+				return changes[i].Name < changes[j].Name
+			}
+			return changes[i].Type < changes[j].Type
+		})
+	}
+	return d
+}
+
+func indexPackages(doc *Document) map[packageKey]*packageVersions {
+	pkgs := map[packageKey]*packageVersions{}
+	for _, p := range doc.Packages {
+		if p.Purpose == PurposeContainer {
+			continue
+		}
+		k := packageKey{name: p.Name, typ: p.Type()}
+		if pkgs[k] == nil {
+			pkgs[k] = &packageVersions{}
+		}
+		pkgs[k].versions = appendUnique(pkgs[k].versions, p.Version)
+		pkgs[k].licenses = appendUnique(pkgs[k].licenses, p.License())
+	}
+	return pkgs
+}
+
+func appendUnique(values []string, add ...string) []string {
+	for _, v := range add {
+		if v == "" || contains(values, v) {
+			continue
+		}
+		values = append(values, v)
+	}
+	return values
+}
+
+func contains(values []string, v string) bool {
+	for _, existing := range values {
+		if existing == v {
+			return true
+		}
+	}
+	return false
+}
+
+func join(values []string) string {
+	sorted := append([]string{}, values...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ", ")
+}
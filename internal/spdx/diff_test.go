@@ -0,0 +1,48 @@
+package spdx_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/opendevstack/ods-pipeline-image/internal/spdx"
+)
+
+func TestCompare(t *testing.T) {
+	oldDoc := &spdx.Document{Packages: []spdx.Package{
+		{Name: "app", Purpose: spdx.PurposeContainer},
+		{Name: "openssl-libs", Version: "3.0.7-24.el9", LicenseConcluded: "Apache-2.0", PURL: "pkg:rpm/redhat/openssl-libs@3.0.7-24.el9"},
+		{Name: "zlib", Version: "1.2.11", LicenseConcluded: spdx.NoAssertion, LicenseDeclared: "Zlib", PURL: "pkg:rpm/redhat/zlib@1.2.11"},
+		{Name: "jackson-databind", Version: "2.15.0", LicenseDeclared: "Apache-2.0", PURL: "pkg:maven/com.fasterxml.jackson.core/jackson-databind@2.15.0"},
+		{Name: "commons-io", Version: "2.11.0", LicenseDeclared: "Apache-2.0", PURL: "pkg:maven/commons-io/commons-io@2.11.0"},
+		{Name: "guava", Version: "31.0", PURL: "pkg:maven/com.google.guava/guava@31.0"},
+		{Name: "guava", Version: "32.0", PURL: "pkg:maven/com.google.guava/guava@32.0"},
+	}}
+	newDoc := &spdx.Document{Packages: []spdx.Package{
+		{Name: "app", Purpose: spdx.PurposeContainer},
+		{Name: "openssl-libs", Version: "3.0.7-25.el9", LicenseConcluded: "Apache-2.0", PURL: "pkg:rpm/redhat/openssl-libs@3.0.7-25.el9"},
+		{Name: "zlib", Version: "1.2.11", LicenseDeclared: "Zlib", PURL: "pkg:rpm/redhat/zlib@1.2.11"},
+		{Name: "jackson-databind", Version: "2.15.0", LicenseDeclared: "MIT", PURL: "pkg:maven/com.fasterxml.jackson.core/jackson-databind@2.15.0"},
+		{Name: "slf4j-api", Version: "2.0.9", LicenseDeclared: "MIT", PURL: "pkg:maven/org.slf4j/slf4j-api@2.0.9"},
+		{Name: "guava", Version: "32.0", PURL: "pkg:maven/com.google.guava/guava@32.0"},
+		{Name: "guava", Version: "31.0", PURL: "pkg:maven/com.google.guava/guava@31.0"},
+	}}
+	want := spdx.Diff{
+		Added: []spdx.PackageChange{
+			{Name: "slf4j-api", Type: "maven", NewVersion: "2.0.9", NewLicense: "MIT"},
+		},
+		Removed: []spdx.PackageChange{
+			{Name: "commons-io", Type: "maven", OldVersion: "2.11.0", OldLicense: "Apache-2.0"},
+		},
+		Changed: []spdx.PackageChange{
+			{Name: "jackson-databind", Type: "maven", OldVersion: "2.15.0", NewVersion: "2.15.0", OldLicense: "Apache-2.0", NewLicense: "MIT"},
+			{Name: "openssl-libs", Type: "rpm", OldVersion: "3.0.7-24.el9", NewVersion: "3.0.7-25.el9", OldLicense: "Apache-2.0", NewLicense: "Apache-2.0"},
+		},
+	}
+	got := spdx.Compare(oldDoc, newDoc)
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("diff mismatch (-want +got):\n%s", diff)
+	}
+	if !spdx.Compare(newDoc, newDoc).Empty() {
+		t.Fatal("want no differences between identical documents")
+	}
+}
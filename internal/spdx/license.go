@@ -0,0 +1,254 @@
+package spdx
+
+import (
+	"fmt"
+	"strings"
+)
+
+// licenseAliases maps lower-cased license names commonly found in package
+// metadata (e.g. RPM, Maven POMs) and deprecated SPDX identifiers to SPDX
+// license identifiers.
+var licenseAliases = map[string]string{
+	"apache 2":                    "Apache-2.0",
+	"apache 2.0":                  "Apache-2.0",
+	"apache-2":                    "Apache-2.0",
+	"apache license 2.0":          "Apache-2.0",
+	"apache license, version 2.0": "Apache-2.0",
+	"apache software license 2.0": "Apache-2.0",
+	"the apache software license, version 2.0": "Apache-2.0",
+	"the apache license, version 2.0":          "Apache-2.0",
+	"asl 2.0":                                  "Apache-2.0",
+	"mit license":                              "MIT",
+	"the mit license":                          "MIT",
+	"expat":                                    "MIT",
+	"isc license":                              "ISC",
+	"bsd 2-clause":                             "BSD-2-Clause",
+	"simplified bsd":                           "BSD-2-Clause",
+	"bsd 3-clause":                             "BSD-3-Clause",
+	"new bsd license":                          "BSD-3-Clause",
+	"the bsd 3-clause license":                 "BSD-3-Clause",
+	"mpl 2.0":                                  "MPL-2.0",
+	"mplv2.0":                                  "MPL-2.0",
+	"mozilla public license 2.0":               "MPL-2.0",
+	"epl 2.0":                                  "EPL-2.0",
+	"eclipse public license 2.0":               "EPL-2.0",
+	"eclipse public license - v 2.0":           "EPL-2.0",
+	"epl 1.0":                                  "EPL-1.0",
+	"eclipse public license 1.0":               "EPL-1.0",
+	"cc0":                                      "CC0-1.0",
+	"zlib":                                     "Zlib",
+	"gpl-1.0":                                  "GPL-1.0-only",
+	"gpl-1.0+":                                 "GPL-1.0-or-later",
+	"gplv2":                                    "GPL-2.0-only",
+	"gpl-2.0":                                  "GPL-2.0-only",
+	"gplv2+":                                   "GPL-2.0-or-later",
+	"gpl-2.0+":                                 "GPL-2.0-or-later",
+	"gplv3":                                    "GPL-3.0-only",
+	"gpl-3.0":                                  "GPL-3.0-only",
+	"gplv3+":                                   "GPL-3.0-or-later",
+	"gpl-3.0+":                                 "GPL-3.0-or-later",
+	"lgplv2":                                   "LGPL-2.0-only",
+	"lgpl-2.0":                                 "LGPL-2.0-only",
+	"lgplv2+":                                  "LGPL-2.0-or-later",
+	"lgpl-2.0+":                                "LGPL-2.0-or-later",
+	"lgplv2.1":                                 "LGPL-2.1-only",
+	"lgpl-2.1":                                 "LGPL-2.1-only",
+	"lgplv2.1+":                                "LGPL-2.1-or-later",
+	"lgpl-2.1+":                                "LGPL-2.1-or-later",
+	"lgplv3":                                   "LGPL-3.0-only",
+	"lgpl-3.0":                                 "LGPL-3.0-only",
+	"lgplv3+":                                  "LGPL-3.0-or-later",
+	"lgpl-3.0+":                                "LGPL-3.0-or-later",
+	"agplv3":                                   "AGPL-3.0-only",
+	"agpl-3.0":                                 "AGPL-3.0-only",
+	"agplv3+":                                  "AGPL-3.0-or-later",
+	"agpl-3.0+":                                "AGPL-3.0-or-later",
+	"gnu affero general public license v3":     "AGPL-3.0-only",
+	"sspl":                                     "SSPL-1.0",
+	"sspl-1.0":                                 "SSPL-1.0",
+	"server side public license":               "SSPL-1.0",
+	"server side public license, v 1":          "SSPL-1.0",
+}
+
+// NormalizeLicense returns the SPDX identifier of the license name, or the
+// name itself if it is not known.
+func NormalizeLicense(name string) string {
+	name = strings.TrimSpace(name)
+	if id, ok := licenseAliases[strings.ToLower(name)]; ok {
+		return id
+	}
+	return name
+}
+
+// LicenseExpression is a parsed SPDX license expression. It is either a
+// single license, or a conjunction (AND) or disjunction (OR) of operands.
+type LicenseExpression struct {
+	// Operator is "AND", "OR" or empty for a single license.
+	Operator string
+	// License is the SPDX identifier of a single license.
+	License  string
+	Operands []*LicenseExpression
+}
+
+// ParseLicenseExpression parses expr, e.g. "(MIT OR Apache-2.0) AND BSD-3-Clause".
+// Operators are case insensitive, as package metadata such as RPM license
+// tags uses lower-case operators. License names may contain spaces, and are
+// normalized to SPDX identifiers. References to other licenses
+// (LicenseRef-...) are resolved with otherLicenses. License exceptions
+// (WITH ...) are dropped.
+func ParseLicenseExpression(expr string, otherLicenses map[string]string) (*LicenseExpression, error) {
+	p := &licenseParser{tokens: tokenizeLicenseExpression(expr), otherLicenses: otherLicenses}
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, fmt.Errorf("parse license expression %q: %w", expr, err)
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("parse license expression %q: unexpected %q", expr, p.tokens[p.pos])
+	}
+	return e, nil
+}
+
+// Licenses returns the licenses within the expression.
+func (e *LicenseExpression) Licenses() []string {
+	if e.Operator == "" {
+		return []string{e.License}
+	}
+	var licenses []string
+	for _, o := range e.Operands {
+		licenses = appendUnique(licenses, o.Licenses()...)
+	}
+	return licenses
+}
+
+// Violations returns the licenses violating a policy, given by violates,
+// which cannot be avoided: all violating licenses of a conjunction, and for
+// a disjunction, none if any of its operands has no violations.
+func (e *LicenseExpression) Violations(violates func(license string) bool) []string {
+	switch e.Operator {
+	case "":
+		if violates(e.License) {
+			return []string{e.License}
+		}
+		return nil
+	case "OR":
+		var violations []string
+		for _, o := range e.Operands {
+			v := o.Violations(violates)
+			if len(v) == 0 {
+				return nil
+			}
+			violations = appendUnique(violations, v...)
+		}
+		return violations
+	default:
+		var violations []string
+		for _, o := range e.Operands {
+			violations = appendUnique(violations, o.Violations(violates)...)
+		}
+		return violations
+	}
+}
+
+func tokenizeLicenseExpression(expr string) []string {
+	var tokens []string
+	var name []string
+	flush := func() {
+		if len(name) > 0 {
+			tokens = append(tokens, strings.Join(name, " "))
+			name = nil
+		}
+	}
+	expr = strings.NewReplacer("(", " ( ", ")", " ) ").Replace(expr)
+	for _, word := range strings.Fields(expr) {
+		switch strings.ToUpper(word) {
+		case "(", ")", "AND", "OR", "WITH":
+			flush()
+			tokens = append(tokens, strings.ToUpper(word))
+		default:
+			name = append(name, word)
+		}
+	}
+	flush()
+	return tokens
+}
+
+type licenseParser struct {
+	tokens        []string
+	pos           int
+	otherLicenses map[string]string
+}
+
+func (p *licenseParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *licenseParser) parseOr() (*LicenseExpression, error) {
+	return p.parseBinary("OR", p.parseAnd)
+}
+
+func (p *licenseParser) parseAnd() (*LicenseExpression, error) {
+	return p.parseBinary("AND", p.parseOperand)
+}
+
+func (p *licenseParser) parseBinary(operator string, operand func() (*LicenseExpression, error)) (*LicenseExpression, error) {
+	first, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	e := &LicenseExpression{Operator: operator, Operands: []*LicenseExpression{first}}
+	for p.peek() == operator {
+		p.pos++
+		o, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		e.Operands = append(e.Operands, o)
+	}
+	if len(e.Operands) == 1 {
+		return first, nil
+	}
+	return e, nil
+}
+
+func (p *licenseParser) parseOperand() (*LicenseExpression, error) {
+	var e *LicenseExpression
+	switch t := p.peek(); t {
+	case "":
+		return nil, fmt.Errorf("unexpected end")
+	case "(":
+		p.pos++
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		p.pos++
+		e = inner
+	case ")", "AND", "OR", "WITH":
+		return nil, fmt.Errorf("unexpected %q", t)
+	default:
+		p.pos++
+		e = &LicenseExpression{License: NormalizeLicense(t)}
+		// The names of other licenses may be expressions themselves, e.g.
+		// "GPLv2+ and LGPLv2+".
+		if name, ok := p.otherLicenses[t]; ok {
+			e = &LicenseExpression{License: NormalizeLicense(name)}
+			if parsed, err := ParseLicenseExpression(name, nil); err == nil {
+				e = parsed
+			}
+		}
+	}
+	if p.peek() == "WITH" {
+		p.pos++
+		if t := p.peek(); t == "" || t == "(" || t == ")" || t == "AND" || t == "OR" || t == "WITH" {
+			return nil, fmt.Errorf("missing license exception after WITH")
+		}
+		p.pos++
+	}
+	return e, nil
+}
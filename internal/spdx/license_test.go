@@ -0,0 +1,87 @@
+package spdx_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/opendevstack/ods-pipeline-image/internal/spdx"
+)
+
+func TestParseLicenseExpression(t *testing.T) {
+	otherLicenses := map[string]string{
+		"LicenseRef-1": "GPLv2+ and LGPLv2+",
+		"LicenseRef-2": "Custom License",
+	}
+	tests := map[string]struct {
+		expr         string
+		wantLicenses []string
+		// wantViolations are the violations if licenses starting with GPL
+		// or AGPL violate the policy.
+		wantViolations []string
+	}{
+		"single": {
+			expr:         "MIT",
+			wantLicenses: []string{"MIT"},
+		},
+		"alias with spaces": {
+			expr:         "Apache License 2.0",
+			wantLicenses: []string{"Apache-2.0"},
+		},
+		"disjunction with allowed alternative": {
+			expr:         "GPL-2.0-only OR MIT",
+			wantLicenses: []string{"GPL-2.0-only", "MIT"},
+		},
+		"disjunction without allowed alternative": {
+			expr:           "GPL-2.0-only or AGPLv3",
+			wantLicenses:   []string{"GPL-2.0-only", "AGPL-3.0-only"},
+			wantViolations: []string{"GPL-2.0-only", "AGPL-3.0-only"},
+		},
+		"conjunction": {
+			expr:           "(MIT OR Apache-2.0) AND GPLv2+",
+			wantLicenses:   []string{"MIT", "Apache-2.0", "GPL-2.0-or-later"},
+			wantViolations: []string{"GPL-2.0-or-later"},
+		},
+		"exception": {
+			expr:           "GPL-2.0-only WITH Classpath-exception-2.0",
+			wantLicenses:   []string{"GPL-2.0-only"},
+			wantViolations: []string{"GPL-2.0-only"},
+		},
+		"reference to expression": {
+			expr:           "LicenseRef-1",
+			wantLicenses:   []string{"GPL-2.0-or-later", "LGPL-2.0-or-later"},
+			wantViolations: []string{"GPL-2.0-or-later"},
+		},
+		"reference to name": {
+			expr:         "LicenseRef-2 AND BSD-3-Clause",
+			wantLicenses: []string{"Custom License", "BSD-3-Clause"},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			e, err := spdx.ParseLicenseExpression(tc.expr, otherLicenses)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.wantLicenses, e.Licenses()); diff != "" {
+				t.Fatalf("licenses mismatch (-want +got):\n%s", diff)
+			}
+			violations := e.Violations(func(license string) bool {
+				return strings.HasPrefix(license, "GPL") || strings.HasPrefix(license, "AGPL")
+			})
+			if diff := cmp.Diff(tc.wantViolations, violations); diff != "" {
+				t.Fatalf("violations mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseLicenseExpressionInvalid(t *testing.T) {
+	for _, expr := range []string{"", "MIT AND", "(MIT OR Apache-2.0", "MIT) OR Apache-2.0", "GPL-2.0-only WITH"} {
+		t.Run(expr, func(t *testing.T) {
+			if _, err := spdx.ParseLicenseExpression(expr, nil); err == nil {
+				t.Fatal("want error, got none")
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+// Package spdx reads SBOMs in the SPDX tag-value format as written by trivy.
+package spdx
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	// PurposeContainer is the primary package purpose of the package
+	// describing the image itself.
+	PurposeContainer = "CONTAINER"
+	// NoAssertion is the value of fields without information, e.g. of
+	// license fields of packages without license information.
+	NoAssertion = "NOASSERTION"
+)
+
+// Document is an SPDX document.
+type Document struct {
+	SPDXVersion       string
+	DocumentName      string
+	DocumentNamespace string
+	// Creators are the creators of the document, e.g. "Tool: trivy-0.47.0".
+	Creators []string
+	Created  string
+	Packages []Package
+	// OtherLicenses maps the IDs of licenses not on the SPDX license list
+	// (LicenseRef-...) to their names.
+	OtherLicenses map[string]string
+}
+
+// Package is a package listed in an SPDX document.
+type Package struct {
+	SPDXID           string
+	Name             string
+	Version          string
+	Purpose          string
+	LicenseConcluded string
+	LicenseDeclared  string
+	// PURL is the package URL of the package, if any.
+	PURL string
+	// AttributionTexts hold further information on the package, e.g. trivy
+	// records the image ID as "ImageID: sha256:...".
+	AttributionTexts []string
+}
+
+// ReadFile parses the SPDX tag-value document in filename.
+func ReadFile(filename string) (*Document, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+// Parse parses an SPDX tag-value document. Tags which are not represented in
+// Document are ignored.
+func Parse(r io.Reader) (*Document, error) {
+	doc := &Document{OtherLicenses: map[string]string{}}
+	var pkg *Package
+	var licenseID string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		tag, value, ok := strings.Cut(text, ":")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected <tag>: <value>, got %q", line, text)
+		}
+		value = strings.TrimSpace(value)
+		// Multi-line values are enclosed in <text> and </text>.
+		if strings.HasPrefix(value, "<text>") {
+			value = strings.TrimPrefix(value, "<text>")
+			for !strings.Contains(value, "</text>") {
+				if !scanner.Scan() {
+					return nil, fmt.Errorf("line %d: unterminated <text> value of %s", line, tag)
+				}
+				line++
+				value += "\n" + scanner.Text()
+			}
+			value, _, _ = strings.Cut(value, "</text>")
+			value = strings.TrimSpace(value)
+		}
+		if tag == "PackageName" {
+			doc.Packages = append(doc.Packages, Package{Name: value})
+			pkg = &doc.Packages[len(doc.Packages)-1]
+			continue
+		}
+		if tag == "FileName" || tag == "SnippetSPDXID" || tag == "LicenseID" || tag == "Relationship" {
+			// Tags after these do not describe the current package.
+			pkg = nil
+		}
+		if pkg != nil {
+			pkg.set(tag, value)
+			continue
+		}
+		switch tag {
+		case "LicenseID":
+			licenseID = value
+			doc.OtherLicenses[licenseID] = value
+		case "ExtractedText":
+			// The name, if any, takes precedence over the extracted text.
+			if licenseID != "" && doc.OtherLicenses[licenseID] == licenseID {
+				doc.OtherLicenses[licenseID] = value
+			}
+		case "LicenseName":
+			if licenseID != "" && value != NoAssertion {
+				doc.OtherLicenses[licenseID] = value
+			}
+		case "SPDXVersion":
+			doc.SPDXVersion = value
+		case "DocumentName":
+			doc.DocumentName = value
+		case "DocumentNamespace":
+			doc.DocumentNamespace = value
+		case "Creator":
+			doc.Creators = append(doc.Creators, value)
+		case "Created":
+			doc.Created = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func (p *Package) set(tag, value string) {
+	switch tag {
+	case "SPDXID":
+		p.SPDXID = value
+	case "PackageVersion":
+		p.Version = value
+	case "PrimaryPackagePurpose":
+		p.Purpose = value
+	case "PackageLicenseConcluded":
+		p.LicenseConcluded = value
+	case "PackageLicenseDeclared":
+		p.LicenseDeclared = value
+	case "PackageAttributionText":
+		p.AttributionTexts = append(p.AttributionTexts, value)
+	case "ExternalRef":
+		// ExternalRef: <category> <type> <locator>
+		fields := strings.Fields(value)
+		if len(fields) == 3 && fields[1] == "purl" {
+			p.PURL = fields[2]
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package spdx_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/opendevstack/ods-pipeline-image/internal/spdx"
+)
+
+const trivySBOM = `SPDXVersion: SPDX-2.3
+DataLicense: CC0-1.0
+SPDXID: SPDXRef-DOCUMENT
+DocumentName: app
+DocumentNamespace: http://aquasecurity.github.io/trivy/container_image/app-1234
+Creator: Organization: aquasecurity
+Creator: Tool: trivy-0.47.0
+Created: 2023-11-20T10:00:00Z
+
+##### Package: app
+
+PackageName: app
+SPDXID: SPDXRef-ContainerImage-1
+PackageDownloadLocation: NONE
+PrimaryPackagePurpose: CONTAINER
+FilesAnalyzed: false
+PackageAttributionText: SchemaVersion: 2
+PackageAttributionText: ImageID: sha256:abc
+
+##### Package: openssl-libs
+
+PackageName: openssl-libs
+SPDXID: SPDXRef-Package-2
+PackageVersion: 3.0.7-24.el9
+PackageDownloadLocation: NONE
+PackageLicenseConcluded: Apache-2.0
+PackageLicenseDeclared: Apache-2.0
+ExternalRef: PACKAGE-MANAGER purl pkg:rpm/redhat/openssl-libs@3.0.7-24.el9?arch=x86_64
+PrimaryPackagePurpose: LIBRARY
+PackageComment: <text>first line
+second line</text>
+
+##### Other Licensing Information
+
+LicenseID: LicenseRef-1
+ExtractedText: <text>GPLv2+</text>
+LicenseName: NOASSERTION
+
+LicenseID: LicenseRef-2
+ExtractedText: <text>see LICENSE.txt</text>
+LicenseName: Custom License
+
+##### Relationships
+
+Relationship: SPDXRef-DOCUMENT DESCRIBES SPDXRef-ContainerImage-1
+`
+
+func TestParse(t *testing.T) {
+	got, err := spdx.Parse(strings.NewReader(trivySBOM))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &spdx.Document{
+		SPDXVersion:       "SPDX-2.3",
+		DocumentName:      "app",
+		DocumentNamespace: "http://aquasecurity.github.io/trivy/container_image/app-1234",
+		Creators:          []string{"Organization: aquasecurity", "Tool: trivy-0.47.0"},
+		Created:           "2023-11-20T10:00:00Z",
+		Packages: []spdx.Package{
+			{
+				SPDXID:           "SPDXRef-ContainerImage-1",
+				Name:             "app",
+				Purpose:          spdx.PurposeContainer,
+				AttributionTexts: []string{"SchemaVersion: 2", "ImageID: sha256:abc"},
+			},
+			{
+				SPDXID:           "SPDXRef-Package-2",
+				Name:             "openssl-libs",
+				Version:          "3.0.7-24.el9",
+				Purpose:          "LIBRARY",
+				LicenseConcluded: "Apache-2.0",
+				LicenseDeclared:  "Apache-2.0",
+				PURL:             "pkg:rpm/redhat/openssl-libs@3.0.7-24.el9?arch=x86_64",
+			},
+		},
+		OtherLicenses: map[string]string{
+			"LicenseRef-1": "GPLv2+",
+			"LicenseRef-2": "Custom License",
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("document mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestParseMalformed(t *testing.T) {
+	tests := map[string]string{
+		"no tag":            "SPDXVersion: SPDX-2.3\nnot a tag-value pair\n",
+		"unterminated text": "SPDXVersion: SPDX-2.3\nDocumentComment: <text>never ends\n",
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := spdx.Parse(strings.NewReader(content)); err == nil {
+				t.Fatal("want error, got none")
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+// Package vex reads OpenVEX documents and matches their statements against
+// vulnerability findings.
+package vex
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// StatusNotAffected is the status of statements declaring that a product is
+// not affected by a vulnerability.
+const StatusNotAffected = "not_affected"
+
+// Document is an OpenVEX document.
+type Document struct {
+	ID         string      `json:"@id"`
+	Statements []Statement `json:"statements"`
+}
+
+// Statement declares the status of products regarding a vulnerability.
+type Statement struct {
+	Vulnerability   Vulnerability `json:"vulnerability"`
+	Products        []Product     `json:"products"`
+	Status          string        `json:"status"`
+	Justification   string        `json:"justification,omitempty"`
+	ImpactStatement string        `json:"impact_statement,omitempty"`
+}
+
+// Vulnerability identifies a vulnerability by name (e.g. a CVE ID) and
+// aliases.
+type Vulnerability struct {
+	Name    string   `json:"name"`
+	Aliases []string `json:"aliases,omitempty"`
+}
+
+// UnmarshalJSON accepts the vulnerability as object (OpenVEX 0.2) or as
+// string (earlier versions).
+func (v *Vulnerability) UnmarshalJSON(b []byte) error {
+	var name string
+	if err := json.Unmarshal(b, &name); err == nil {
+		v.Name = name
+		return nil
+	}
+	type vulnerability Vulnerability
+	return json.Unmarshal(b, (*vulnerability)(v))
+}
+
+// Product is identified by a package URL, optionally narrowed down to some
+// of its subcomponents, e.g. packages within an image.
+type Product struct {
+	ID            string    `json:"@id"`
+	Subcomponents []Product `json:"subcomponents,omitempty"`
+}
+
+// UnmarshalJSON accepts the product as object (OpenVEX 0.2) or as string
+// (earlier versions).
+func (p *Product) UnmarshalJSON(b []byte) error {
+	var id string
+	if err := json.Unmarshal(b, &id); err == nil {
+		p.ID = id
+		return nil
+	}
+	type product Product
+	return json.Unmarshal(b, (*product)(p))
+}
+
+// ReadFile reads the OpenVEX document in filename.
+func ReadFile(filename string) (*Document, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var d Document
+	if err := json.Unmarshal(b, &d); err != nil {
+		return nil, fmt.Errorf("parse OpenVEX document %s: %w", filename, err)
+	}
+	return &d, nil
+}
+
+// Find returns the last statement of docs about vulnerability vulnID of the
+// package with package URL purl, within the image with package URL
+// imagePURL. A statement applies if one of its products matches the package,
+// or matches the image without subcomponents or with a subcomponent matching
+// the package.
+func Find(docs []*Document, vulnID, purl, imagePURL string) *Statement {
+	var found *Statement
+	for _, d := range docs {
+		for i, s := range d.Statements {
+			if !s.Vulnerability.matches(vulnID) {
+				continue
+			}
+			for _, p := range s.Products {
+				if p.matches(purl, imagePURL) {
+					found = &d.Statements[i]
+					break
+				}
+			}
+		}
+	}
+	return found
+}
+
+func (v Vulnerability) matches(id string) bool {
+	if strings.EqualFold(v.Name, id) {
+		return true
+	}
+	for _, a := range v.Aliases {
+		if strings.EqualFold(a, id) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p Product) matches(purl, imagePURL string) bool {
+	if purl != "" && matchPURL(p.ID, purl) {
+		return true
+	}
+	if imagePURL == "" || !matchPURL(p.ID, imagePURL) {
+		return false
+	}
+	if len(p.Subcomponents) == 0 {
+		return true
+	}
+	for _, sc := range p.Subcomponents {
+		if purl != "" && matchPURL(sc.ID, purl) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPURL returns whether the package URL pattern refers to purl. Patterns
+// without version match all versions, qualifiers and subpaths are ignored.
+func matchPURL(pattern, purl string) bool {
+	patternName, patternVersion := splitPURL(pattern)
+	name, version := splitPURL(purl)
+	return patternName != "" && patternName == name && (patternVersion == "" || patternVersion == version)
+}
+
+// splitPURL returns the package URL without version, qualifiers and subpath,
+// and its unescaped version.
+func splitPURL(purl string) (string, string) {
+	purl, _, _ = strings.Cut(purl, "#")
+	purl, _, _ = strings.Cut(purl, "?")
+	i := strings.LastIndex(purl, "@")
+	if i < 0 {
+		return purl, ""
+	}
+	version, err := url.PathUnescape(purl[i+1:])
+	if err != nil {
+		version = purl[i+1:]
+	}
+	return purl[:i], version
+}
@@ -0,0 +1,123 @@
+package vex_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opendevstack/ods-pipeline-image/internal/vex"
+)
+
+const openVEX = `{
+  "@context": "https://openvex.dev/ns/v0.2.0",
+  "@id": "https://example.com/vex/app-1",
+  "author": "ACME",
+  "timestamp": "2024-01-01T00:00:00Z",
+  "version": 1,
+  "statements": [
+    {
+      "vulnerability": {"name": "CVE-2023-0001"},
+      "products": [{"@id": "pkg:maven/com.example/lib"}],
+      "status": "not_affected",
+      "justification": "vulnerable_code_not_in_execute_path"
+    },
+    {
+      "vulnerability": {"name": "CVE-2023-0002", "aliases": ["GHSA-xxxx"]},
+      "products": [
+        {
+          "@id": "pkg:oci/app",
+          "subcomponents": [{"@id": "pkg:rpm/redhat/openssl-libs@3.0.7-24.el9?arch=x86_64"}]
+        }
+      ],
+      "status": "not_affected",
+      "justification": "vulnerable_code_cannot_be_controlled_by_adversary"
+    },
+    {
+      "vulnerability": {"name": "CVE-2023-0003"},
+      "products": [{"@id": "pkg:oci/app@sha256%3Aabc"}],
+      "status": "not_affected",
+      "impact_statement": "not used"
+    },
+    {
+      "vulnerability": {"name": "CVE-2023-0001"},
+      "products": [{"@id": "pkg:maven/com.example/lib@2.0"}],
+      "status": "affected"
+    }
+  ]
+}`
+
+func TestFind(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.openvex.json")
+	if err := os.WriteFile(filename, []byte(openVEX), 0644); err != nil {
+		t.Fatal(err)
+	}
+	doc, err := vex.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs := []*vex.Document{doc}
+	imagePURL := "pkg:oci/app@sha256%3Aabc?repository_url=registry.example.com%2Ffoo%2Fapp"
+	tests := map[string]struct {
+		vulnID     string
+		purl       string
+		wantStatus string
+	}{
+		"package without version": {
+			vulnID:     "CVE-2023-0001",
+			purl:       "pkg:maven/com.example/lib@1.0",
+			wantStatus: vex.StatusNotAffected,
+		},
+		"later statement wins": {
+			vulnID:     "CVE-2023-0001",
+			purl:       "pkg:maven/com.example/lib@2.0",
+			wantStatus: "affected",
+		},
+		"subcomponent of image": {
+			vulnID:     "GHSA-xxxx",
+			purl:       "pkg:rpm/redhat/openssl-libs@3.0.7-24.el9?arch=aarch64",
+			wantStatus: vex.StatusNotAffected,
+		},
+		"other subcomponent of image": {
+			vulnID: "CVE-2023-0002",
+			purl:   "pkg:rpm/redhat/zlib@1.2.11",
+		},
+		"image with digest": {
+			vulnID:     "CVE-2023-0003",
+			purl:       "pkg:rpm/redhat/zlib@1.2.11",
+			wantStatus: vex.StatusNotAffected,
+		},
+		"other vulnerability": {
+			vulnID: "CVE-2023-9999",
+			purl:   "pkg:maven/com.example/lib@1.0",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			s := vex.Find(docs, tc.vulnID, tc.purl, imagePURL)
+			status := ""
+			if s != nil {
+				status = s.Status
+			}
+			if status != tc.wantStatus {
+				t.Fatalf("want status %q, got %q", tc.wantStatus, status)
+			}
+		})
+	}
+}
+
+func TestReadFileLegacyFormat(t *testing.T) {
+	// Earlier OpenVEX versions use plain strings for vulnerabilities and
+	// products.
+	filename := filepath.Join(t.TempDir(), "app.openvex.json")
+	content := `{"statements":[{"vulnerability":"CVE-2023-0001","products":["pkg:maven/com.example/lib"],"status":"not_affected"}]}`
+	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	doc, err := vex.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := vex.Find([]*vex.Document{doc}, "CVE-2023-0001", "pkg:maven/com.example/lib@1.0", ""); s == nil || s.Status != vex.StatusNotAffected {
+		t.Fatalf("want not_affected statement, got %v", s)
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/opendevstack/ods-pipeline-image/internal/spdx"
 	"github.com/opendevstack/ods-pipeline/pkg/artifact"
 	"github.com/opendevstack/ods-pipeline/pkg/logging"
 	"github.com/opendevstack/ods-pipeline/pkg/nexus"
@@ -39,6 +40,7 @@ func TestPackageImageTask(t *testing.T) {
 		ttr.AfterRun(func(config *ttr.TaskRunConfig, run *tekton.TaskRun, logs bytes.Buffer) {
 			wsDir, ctxt := ott.GetSourceWorkspaceContext(t, config)
 			checkResultingFiles(t, ctxt, wsDir)
+			checkResultingSBOM(t, ctxt, wsDir)
 			checkResultingImageHelloWorld(t, ctxt, wsDir)
 
 			var resultImageDigest string
@@ -100,6 +102,24 @@ func checkResultingFiles(t *testing.T, ctxt *pipelinectxt.ODSContext, wsDir stri
 	}
 }
 
+// checkResultingSBOM checks that trivy read the image from the local OCI
+// layout, which results in an SBOM listing the packages of the image.
+func checkResultingSBOM(t *testing.T, ctxt *pipelinectxt.ODSContext, wsDir string) {
+	doc, err := spdx.ReadFile(filepath.Join(wsDir, pipelinectxt.SBOMsPath, fmt.Sprintf("%s.%s", ctxt.Component, pipelinectxt.SBOMsFormat)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	packages := 0
+	for _, p := range doc.Packages {
+		if p.Purpose != spdx.PurposeContainer {
+			packages++
+		}
+	}
+	if packages == 0 {
+		t.Fatal("want SBOM listing the packages of the image, got none")
+	}
+}
+
 func checkTagFiles(t *testing.T, ctxt *pipelinectxt.ODSContext, wsDir string, tags []string) {
 	wantFiles := []string{}
 	for _, tag := range tags {